@@ -2,6 +2,9 @@ package config
 
 import (
 	"log"
+	"os"
+	"path/filepath"
+	"testing"
 
 	"github.com/spf13/viper"
 )
@@ -22,6 +25,9 @@ var (
 
 // init 初始化配置系统
 func init() {
+	if testing.Testing() {
+		chdirToProjectRoot()
+	}
 	if err := initConfig(); err != nil {
 		log.Fatalf("配置初始化失败: %v", err)
 	}
@@ -109,3 +115,23 @@ func GetConfigPath() string {
 func ValidateConfig() bool {
 	return Config != nil && Config.ConfigFileUsed() != ""
 }
+
+// chdirToProjectRoot 测试二进制的工作目录是被测包所在目录：向上查找 config.json 所在的目录（项目根目录）
+// 并切换过去，与正常启动时的工作目录一致（子配置、GeoIP 数据库等相对路径同样生效）
+func chdirToProjectRoot() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "config.json")); err == nil {
+			_ = os.Chdir(dir)
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
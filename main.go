@@ -35,8 +35,18 @@ func main() {
 			node = config.Config.GetString("server_name")
 			host = config.Config.GetString("gin.ip")
 		}
+		registerShellFuncs()
 		shell.Start(node, host) // Shell 在前台运行
 	} else {
 		request.Start() // 正常模式，只运行 Gin
 	}
 }
+
+// registerShellFuncs 注册可在 Shell 中通过 shell.<name>(...) 调用的排查函数
+func registerShellFuncs() {
+	if err := shell.RegisterFuncs(map[string]any{
+		"explainAccess": request.ExplainAccess, // shell.explainAccess("1.2.3.4", "/loginServer/reportServerList")
+	}); err != nil {
+		log.Error("register shell funcs failed: %v", err)
+	}
+}
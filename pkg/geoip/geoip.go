@@ -0,0 +1,443 @@
+// Package geoip MaxMind DB（.mmdb）格式的 IP 归属地查询
+//
+// 只实现按 IP 查询国家代码所需的部分：读取元数据、遍历搜索树、按路径解码数据区中的字段，
+// 兼容 GeoLite2-Country / GeoIP2-Country / GeoIP2-City 等 MaxMind 格式的数据库。
+// 数据库文件整体读入内存，Reader 创建后只读，可以在多个协程中并发查询；
+// 文件更新时重新 Open 一个新的 Reader 替换即可。
+//
+// 格式说明：https://maxmind.github.io/MaxMind-DB/
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// metadataMarker 元数据区的起始标记（位于文件末尾 128KB 内）
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	dataSeparatorSize = 16 // 搜索树与数据区之间的 16 个 0 字节
+	maxDecodeDepth    = 32 // 嵌套 map / array 的最大深度，防止损坏的文件导致无限递归
+)
+
+// 数据类型
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// ErrInvalidDatabase 文件不是有效的 MaxMind DB
+var ErrInvalidDatabase = errors.New("geoip: invalid MaxMind DB file")
+
+// Metadata 数据库元数据
+type Metadata struct {
+	DatabaseType string // 如 GeoLite2-Country
+	BuildEpoch   int64  // 生成时间（Unix 秒）
+	IPVersion    int    // 4 或 6
+	NodeCount    uint
+	RecordSize   uint // 24 / 28 / 32
+}
+
+// Reader 数据库读取器
+type Reader struct {
+	meta      Metadata
+	tree      []byte // 搜索树
+	data      []byte // 数据区
+	ipv4Start uint   // IPv6 数据库中 IPv4 地址（::/96）对应的起始节点
+}
+
+// Open 读取数据库文件
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes 从内存中的数据库内容创建读取器（buf 之后不能再修改）
+func FromBytes(buf []byte) (*Reader, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	raw, _, err := decoder(buf[idx+len(metadataMarker):]).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: decode metadata: %w", err)
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+	meta := Metadata{
+		DatabaseType: asString(fields["database_type"]),
+		BuildEpoch:   int64(asUint(fields["build_epoch"])),
+		IPVersion:    int(asUint(fields["ip_version"])),
+		NodeCount:    uint(asUint(fields["node_count"])),
+		RecordSize:   uint(asUint(fields["record_size"])),
+	}
+	if meta.RecordSize != 24 && meta.RecordSize != 28 && meta.RecordSize != 32 {
+		return nil, fmt.Errorf("geoip: unsupported record size: %d", meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported ip version: %d", meta.IPVersion)
+	}
+
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	if treeSize+dataSeparatorSize > uint(idx) {
+		return nil, ErrInvalidDatabase
+	}
+	r := &Reader{
+		meta: meta,
+		tree: buf[:treeSize],
+		data: buf[treeSize+dataSeparatorSize : idx],
+	}
+	if meta.IPVersion == 6 {
+		// IPv4 地址在 IPv6 树中位于 ::/96 下，预先走完前 96 位
+		node := uint(0)
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Metadata 数据库元数据
+func (r *Reader) Metadata() Metadata {
+	return r.meta
+}
+
+// Country 查询 IP 所属国家的 ISO 3166-1 代码（大写，如 CN、US）
+// 优先使用 country，没有时使用 registered_country（如卫星网络、部分 Anycast 地址）；未收录的地址返回 false
+func (r *Reader) Country(addr netip.Addr) (string, bool) {
+	for _, field := range []string{"country", "registered_country"} {
+		value, ok, err := r.Lookup(addr, field, "iso_code")
+		if err != nil || !ok {
+			continue
+		}
+		if code := asString(value); code != "" {
+			return strings.ToUpper(code), true
+		}
+	}
+	return "", false
+}
+
+// Lookup 查询 IP 对应记录中 path 指定的字段（如 "country", "iso_code"）
+// path 为空时返回整条记录；地址未收录或字段不存在时返回 false
+func (r *Reader) Lookup(addr netip.Addr, path ...string) (any, bool, error) {
+	offset, ok, err := r.find(addr)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return decoder(r.data).decodePath(offset, path, 0)
+}
+
+// find 在搜索树中查找地址，返回记录在数据区中的偏移
+func (r *Reader) find(addr netip.Addr) (uint, bool, error) {
+	if !addr.IsValid() {
+		return 0, false, nil
+	}
+	addr = addr.Unmap()
+	if addr.Is6() && r.meta.IPVersion == 4 {
+		return 0, false, nil
+	}
+
+	node := uint(0)
+	if addr.Is4() && r.meta.IPVersion == 6 {
+		node = r.ipv4Start
+	}
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < r.meta.NodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = r.readNode(node, bit)
+	}
+
+	switch {
+	case node == r.meta.NodeCount:
+		// 空记录：地址未收录
+		return 0, false, nil
+	case node > r.meta.NodeCount:
+		offset := node - r.meta.NodeCount - dataSeparatorSize
+		if offset >= uint(len(r.data)) {
+			return 0, false, ErrInvalidDatabase
+		}
+		return offset, true, nil
+	default:
+		// 地址位数用完仍在树中，文件损坏
+		return 0, false, ErrInvalidDatabase
+	}
+}
+
+// readNode 读取节点的左（bit=0）或右（bit=1）记录
+func (r *Reader) readNode(node, bit uint) uint {
+	b := r.tree
+	switch r.meta.RecordSize {
+	case 24:
+		off := node*6 + bit*3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+	case 28:
+		off := node * 7
+		if bit == 0 {
+			return uint(b[off+3]&0xF0)<<20 | uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+		}
+		return uint(b[off+3]&0x0F)<<24 | uint(b[off+4])<<16 | uint(b[off+5])<<8 | uint(b[off+6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(b[off:]))
+	}
+}
+
+// decoder 数据区解码（指针的偏移相对于数据区起始位置）
+type decoder []byte
+
+// decodePath 按路径解码 map 中的字段，只解码路径上的值，其它字段直接跳过
+func (d decoder) decodePath(offset uint, path []string, depth int) (any, bool, error) {
+	if len(path) == 0 {
+		value, _, err := d.decode(offset, depth)
+		return value, err == nil, err
+	}
+	if depth > maxDecodeDepth {
+		return nil, false, ErrInvalidDatabase
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, false, err
+	}
+	if typ == typePointer {
+		return d.decodePath(size, path, depth+1)
+	}
+	if typ != typeMap {
+		return nil, false, nil
+	}
+	for i := uint(0); i < size; i++ {
+		key, next, err := d.decode(offset, depth+1)
+		if err != nil {
+			return nil, false, err
+		}
+		if s, ok := key.(string); ok && s == path[0] {
+			return d.decodePath(next, path[1:], depth+1)
+		}
+		if offset, err = d.skip(next, depth+1); err != nil {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+// control 解析控制字节，返回类型、长度（指针类型为目标偏移）和数据起始偏移
+func (d decoder) control(offset uint) (int, uint, uint, error) {
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	offset++
+	typ := int(ctrl[0] >> 5)
+	if typ == typePointer {
+		return d.pointer(ctrl[0], offset)
+	}
+	if typ == typeExtended {
+		ext, err := d.bytes(offset, 1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		typ = int(ext[0]) + 7
+		offset++
+	}
+
+	size := uint(ctrl[0] & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+	return typ, size, offset, nil
+}
+
+// pointer 解析指针，返回目标偏移和指针之后的偏移
+func (d decoder) pointer(ctrl byte, offset uint) (int, uint, uint, error) {
+	n := uint(ctrl>>3&0x03) + 1
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	v := uint(ctrl & 0x07)
+	var target uint
+	switch n {
+	case 1:
+		target = v<<8 | uint(b[0])
+	case 2:
+		target = (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		target = (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		target = uint(binary.BigEndian.Uint32(b))
+	}
+	return typePointer, target, offset + n, nil
+}
+
+// decode 解码一个值，返回值和下一个值的偏移
+// map 解码为 map[string]any，array 为 []any，无符号整数为 uint64，int32 为 int64，uint128 为 []byte
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, ErrInvalidDatabase
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typePointer:
+		value, _, err := d.decode(size, depth+1)
+		return value, offset, err
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			var key, value any
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[asString(key)] = value
+		}
+		return m, offset, nil
+	case typeArray:
+		list := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			var value any
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			list = append(list, value)
+		}
+		return list, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		// 不足 4 字节时高位补 0，按 32 位有符号数解释
+		return int64(int32(v)), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("geoip: unknown data type: %d", typ)
+	}
+}
+
+// skip 跳过一个值，返回下一个值的偏移
+func (d decoder) skip(offset uint, depth int) (uint, error) {
+	if depth > maxDecodeDepth {
+		return 0, ErrInvalidDatabase
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return 0, err
+	}
+	switch typ {
+	case typePointer, typeBool:
+		return offset, nil
+	case typeMap, typeArray:
+		count := size
+		if typ == typeMap {
+			count *= 2
+		}
+		for i := uint(0); i < count; i++ {
+			if offset, err = d.skip(offset, depth+1); err != nil {
+				return 0, err
+			}
+		}
+		return offset, nil
+	default:
+		if offset+size > uint(len(d)) {
+			return 0, ErrInvalidDatabase
+		}
+		return offset + size, nil
+	}
+}
+
+// bytes 读取 [offset, offset+n)，越界时返回错误
+func (d decoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d)) || offset+n < offset {
+		return nil, ErrInvalidDatabase
+	}
+	return d[offset : offset+n], nil
+}
+
+func asString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func asUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		if n > 0 {
+			return uint64(n)
+		}
+	}
+	return 0
+}
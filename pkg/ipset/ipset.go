@@ -0,0 +1,120 @@
+// Package ipset IP / CIDR 集合的快速匹配
+//
+// 条目在加入时统一解析为 netip.Prefix（单个 IP 视为 /32 或 /128，IPv4 映射的 IPv6 地址转换为 IPv4），
+// 按 前缀 -> 过期时间 保存在哈希表中，并记录出现过的前缀长度。
+// 匹配时按出现过的前缀长度从长到短截取地址前缀查表，单次匹配最多查 33（IPv4）或 129（IPv6）次，
+// 与条目数量无关，也不需要在每次请求时解析字符串。
+//
+// Set 构建完成后只读，可以在多个协程中并发调用 Match / Contains；修改时重新构建一个新的 Set。
+package ipset
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Set IP / CIDR 集合
+type Set struct {
+	prefixes map[netip.Prefix]int64 // 前缀 -> 过期时间（Unix 秒），0 表示永不过期
+	bits4    []int                  // 出现过的 IPv4 前缀长度，从长到短
+	bits6    []int                  // 出现过的 IPv6 前缀长度，从长到短
+}
+
+// New 创建空集合
+func New() *Set {
+	return &Set{prefixes: make(map[netip.Prefix]int64)}
+}
+
+// ParsePrefix 解析 IP 或 CIDR（单个 IP 视为 /32 或 /128），IPv4 映射的 IPv6 地址转换为 IPv4
+func ParsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Add 加入一个前缀，expireAt 为过期时间（Unix 秒），0 表示永不过期
+// 同一前缀重复加入时保留有效期更长的一个
+func (s *Set) Add(prefix netip.Prefix, expireAt int64) {
+	prefix = prefix.Masked()
+	if !prefix.IsValid() {
+		return
+	}
+	if old, ok := s.prefixes[prefix]; ok {
+		if old == 0 || (expireAt != 0 && expireAt < old) {
+			return
+		}
+	}
+	s.prefixes[prefix] = expireAt
+
+	bits := &s.bits6
+	if prefix.Addr().Is4() {
+		bits = &s.bits4
+	}
+	if !slices.Contains(*bits, prefix.Bits()) {
+		*bits = append(*bits, prefix.Bits())
+		slices.SortFunc(*bits, func(a, b int) int { return b - a })
+	}
+}
+
+// AddString 解析并加入一个 IP 或 CIDR
+func (s *Set) AddString(value string, expireAt int64) error {
+	prefix, err := ParsePrefix(value)
+	if err != nil {
+		return err
+	}
+	s.Add(prefix, expireAt)
+	return nil
+}
+
+// Len 集合中的前缀数量（包含已过期的）
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.prefixes)
+}
+
+// Match 返回包含 addr 且在 now 时未过期的最长前缀
+// IPv4 映射的 IPv6 地址按 IPv4 匹配；now 为 0 时不检查过期时间
+func (s *Set) Match(addr netip.Addr, now int64) (netip.Prefix, bool) {
+	if s == nil || !addr.IsValid() {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+
+	bits := s.bits6
+	if addr.Is4() {
+		bits = s.bits4
+	}
+	for _, n := range bits {
+		prefix, err := addr.Prefix(n)
+		if err != nil {
+			continue
+		}
+		if expireAt, ok := s.prefixes[prefix]; ok && (expireAt == 0 || now == 0 || expireAt > now) {
+			return prefix, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// Contains addr 是否在集合中（未过期的条目）
+func (s *Set) Contains(addr netip.Addr, now int64) bool {
+	_, ok := s.Match(addr, now)
+	return ok
+}
@@ -0,0 +1,269 @@
+package ipset
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+)
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "192.168.1.1", want: "192.168.1.1/32"},
+		{value: " 10.0.0.1 ", want: "10.0.0.1/32"},
+		{value: "10.1.2.3/8", want: "10.0.0.0/8"},
+		{value: "::ffff:192.168.1.1", want: "192.168.1.1/32"},
+		{value: "::ffff:10.1.0.0/112", want: "10.1.0.0/16"},
+		{value: "::ffff:0:0/96", want: "0.0.0.0/0"},
+		{value: "2408:8000::1", want: "2408:8000::1/128"},
+		{value: "2408:8000:1234::/32", want: "2408:8000::/32"},
+		{value: "fe80::1%eth0", want: "fe80::1/128"},
+		{value: "", wantErr: true},
+		{value: "not-an-ip", wantErr: true},
+		{value: "256.0.0.1", wantErr: true},
+		{value: "10.0.0.0/33", wantErr: true},
+		{value: "2408::/129", wantErr: true},
+		{value: "10.0.0.0/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParsePrefix(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePrefix(%q) = %v, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePrefix(%q) error: %v", tt.value, err)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("ParsePrefix(%q) = %v, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	const now = 1000
+	set := New()
+	for _, entry := range []struct {
+		value    string
+		expireAt int64
+	}{
+		{"10.0.0.0/8", 0},
+		{"10.1.0.0/16", 0},
+		{"10.1.2.0/24", now - 1}, // 已过期，回退到 10.1.0.0/16
+		{"10.1.3.0/24", now + 1},
+		{"192.168.1.1", 0},
+		{"2408:8000::/32", 0},
+		{"2408:8000:abcd::/48", now},
+		{"2001:db8::1", 0},
+	} {
+		if err := set.AddString(entry.value, entry.expireAt); err != nil {
+			t.Fatalf("AddString(%q) error: %v", entry.value, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		addr string
+		now  int64
+		want string // 空表示不匹配
+	}{
+		{name: "单个 IPv4", addr: "192.168.1.1", now: now, want: "192.168.1.1/32"},
+		{name: "单个 IPv4 不匹配相邻地址", addr: "192.168.1.2", now: now},
+		{name: "最长前缀优先", addr: "10.1.3.4", now: now, want: "10.1.3.0/24"},
+		{name: "较短前缀", addr: "10.2.0.1", now: now, want: "10.0.0.0/8"},
+		{name: "较长前缀已过期时回退到较短的有效前缀", addr: "10.1.2.3", now: now, want: "10.1.0.0/16"},
+		{name: "now 为 0 时不检查过期", addr: "10.1.2.3", now: 0, want: "10.1.2.0/24"},
+		{name: "IPv4 映射的 IPv6 按 IPv4 匹配", addr: "::ffff:10.1.3.4", now: now, want: "10.1.3.0/24"},
+		{name: "IPv4 映射的 IPv6 单 IP", addr: "::ffff:192.168.1.1", now: now, want: "192.168.1.1/32"},
+		{name: "IPv6 网段", addr: "2408:8000:1::1", now: now, want: "2408:8000::/32"},
+		{name: "IPv6 网段过期时间等于当前时间视为过期", addr: "2408:8000:abcd::1", now: now, want: "2408:8000::/32"},
+		{name: "IPv6 网段外", addr: "2408:8001::1", now: now},
+		{name: "单个 IPv6", addr: "2001:db8::1", now: now, want: "2001:db8::1/128"},
+		{name: "带 zone 的 IPv6", addr: "2001:db8::1%eth0", now: now, want: "2001:db8::1/128"},
+		{name: "IPv4 不匹配 IPv6 条目", addr: "36.8.0.1", now: now},
+		{name: "未列出的地址", addr: "172.16.0.1", now: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := netip.MustParseAddr(tt.addr)
+			got, ok := set.Match(addr, tt.now)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("Match(%s) = %v, want no match", tt.addr, got)
+				}
+			} else if !ok || got.String() != tt.want {
+				t.Fatalf("Match(%s) = %v, %v, want %s", tt.addr, got, ok, tt.want)
+			}
+			if contains := set.Contains(addr, tt.now); contains != (tt.want != "") {
+				t.Fatalf("Contains(%s) = %v, want %v", tt.addr, contains, tt.want != "")
+			}
+		})
+	}
+}
+
+func TestMatchEdgeCases(t *testing.T) {
+	var nilSet *Set
+	if nilSet.Contains(netip.MustParseAddr("10.0.0.1"), 0) || nilSet.Len() != 0 {
+		t.Fatal("nil Set should be empty")
+	}
+	if New().Contains(netip.MustParseAddr("10.0.0.1"), 0) {
+		t.Fatal("empty Set should not match")
+	}
+
+	set := New()
+	set.Add(netip.MustParsePrefix("0.0.0.0/0"), 0)
+	if set.Contains(netip.Addr{}, 0) {
+		t.Fatal("invalid addr should not match")
+	}
+	if !set.Contains(netip.MustParseAddr("1.2.3.4"), 0) || set.Contains(netip.MustParseAddr("2408::1"), 0) {
+		t.Fatal("0.0.0.0/0 should match all IPv4 and no IPv6")
+	}
+	set.Add(netip.Prefix{}, 0)
+	if set.Len() != 1 {
+		t.Fatalf("invalid prefix added, Len = %d", set.Len())
+	}
+}
+
+func TestAddKeepsLongerLifetime(t *testing.T) {
+	prefix := netip.MustParsePrefix("10.0.0.0/8")
+	addr := netip.MustParseAddr("10.0.0.1")
+	tests := []struct {
+		name     string
+		expireAt []int64
+		now      int64
+		want     bool
+	}{
+		{name: "先短后长", expireAt: []int64{100, 200}, now: 150, want: true},
+		{name: "先长后短", expireAt: []int64{200, 100}, now: 150, want: true},
+		{name: "永不过期后加入有期限的", expireAt: []int64{0, 100}, now: 150, want: true},
+		{name: "有期限后加入永不过期的", expireAt: []int64{100, 0}, now: 150, want: true},
+		{name: "都已过期", expireAt: []int64{100, 120}, now: 150, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := New()
+			for _, expireAt := range tt.expireAt {
+				set.Add(prefix, expireAt)
+			}
+			if set.Len() != 1 {
+				t.Fatalf("Len = %d, want 1", set.Len())
+			}
+			if got := set.Contains(addr, tt.now); got != tt.want {
+				t.Fatalf("Contains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 基准测试：单次匹配的耗时只与出现过的前缀长度种数有关，不随条目数增长
+//
+//	go test -bench . -benchmem ./pkg/ipset
+
+// benchSizes 基准测试的集合大小
+var benchSizes = []int{10, 100, 1000, 10000}
+
+// buildBenchSet 构造随机集合（IPv4 单 IP、IPv4 网段、IPv6 单 IP、IPv6 网段混合），返回集合和用于命中的成员地址
+func buildBenchSet(rng *rand.Rand, size int) (*Set, []netip.Addr) {
+	set := New()
+	members := make([]netip.Addr, 0, size)
+	for i := 0; i < size; i++ {
+		var prefix netip.Prefix
+		switch i % 10 {
+		case 0:
+			prefix, _ = randomV4(rng).Prefix(16 + rng.IntN(13))
+		case 1:
+			prefix = netip.PrefixFrom(randomV6(rng), 128)
+		case 2:
+			prefix, _ = randomV6(rng).Prefix(48 + rng.IntN(17))
+		default:
+			prefix = netip.PrefixFrom(randomV4(rng), 32)
+		}
+		set.Add(prefix, 0)
+		members = append(members, prefix.Addr())
+	}
+	return set, members
+}
+
+// benchClients 客户端地址：1/4 命中、1/4 IPv4 映射的 IPv6 形式、1/4 随机 IPv4、1/4 随机 IPv6
+func benchClients(rng *rand.Rand, members []netip.Addr) []netip.Addr {
+	clients := make([]netip.Addr, 1024)
+	for i := range clients {
+		switch i % 4 {
+		case 0:
+			clients[i] = members[rng.IntN(len(members))]
+		case 1:
+			clients[i] = netip.AddrFrom16(members[rng.IntN(len(members))].As16())
+		case 2:
+			clients[i] = randomV4(rng)
+		default:
+			clients[i] = randomV6(rng)
+		}
+	}
+	return clients
+}
+
+func randomV4(rng *rand.Rand) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(rng.IntN(256)), byte(rng.IntN(256)), byte(rng.IntN(256)), byte(rng.IntN(256))})
+}
+
+func randomV6(rng *rand.Rand) netip.Addr {
+	var b [16]byte
+	b[0], b[1] = 0x24, 0x08
+	for i := 2; i < 16; i++ {
+		b[i] = byte(rng.IntN(256))
+	}
+	return netip.AddrFrom16(b)
+}
+
+func BenchmarkContains(b *testing.B) {
+	for _, size := range benchSizes {
+		rng := rand.New(rand.NewPCG(1, 2))
+		set, members := buildBenchSet(rng, size)
+		clients := benchClients(rng, members)
+		b.Run(fmt.Sprintf("entries=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				set.Contains(clients[i&1023], 0)
+			}
+		})
+	}
+}
+
+func BenchmarkParsePrefix(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	values := []string{randomV4(rng).String(), "10.0.0.0/8", randomV6(rng).String(), "2408::/16", "::ffff:192.168.1.1"}
+	for i := 0; i < b.N; i++ {
+		if _, err := ParsePrefix(values[i%len(values)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	for _, size := range benchSizes {
+		rng := rand.New(rand.NewPCG(1, 2))
+		_, members := buildBenchSet(rng, size)
+		values := make([]string, 0, len(members))
+		for _, member := range members {
+			values = append(values, member.String())
+		}
+		b.Run(fmt.Sprintf("entries=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				set := New()
+				for _, value := range values {
+					_ = set.AddString(value, 0)
+				}
+			}
+		})
+	}
+}
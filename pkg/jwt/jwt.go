@@ -27,6 +27,33 @@ func getJWTSecretKey() string {
 	return defaultJWTSecretKey
 }
 
+// EncodeAdminJwt 签发后台操作人 token（使用独立的密钥，见 getAdminJWTSecretKey）
+func EncodeAdminJwt(tokenInfo map[string]any) (string, error) {
+	secretKey, err := getAdminJWTSecretKey()
+	if err != nil {
+		return "", err
+	}
+	return GenerateJWT(tokenInfo, secretKey, expiredSec)
+}
+
+// DecodeAdminJwt 校验后台操作人 token
+func DecodeAdminJwt(token string) (jwt.MapClaims, error) {
+	secretKey, err := getAdminJWTSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWT(token, secretKey)
+}
+
+// getAdminJWTSecretKey 后台操作人 token 的密钥，只能通过环境变量配置，未配置时拒绝所有后台 token
+// 与客户端 token 的密钥分开，持有客户端密钥的账号服务无法伪造后台操作人
+func getAdminJWTSecretKey() (string, error) {
+	if v := os.Getenv("LOGIN_SERVER_ADMIN_JWT_SECRET"); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("未配置 LOGIN_SERVER_ADMIN_JWT_SECRET")
+}
+
 func GenerateJWT(info map[string]any, secretKey string, durationSec int) (string, error) {
 	claims := jwt.MapClaims{
 		"info": info,
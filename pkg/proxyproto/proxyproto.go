@@ -0,0 +1,218 @@
+// Package proxyproto 监听端口的 PROXY protocol（v1 文本格式 / v2 二进制格式）支持
+//
+// 四层负载均衡（如 HAProxy、云厂商 NLB）转发 TCP 连接时，会在连接开头发送一段 PROXY 头，
+// 其中携带客户端的真实地址。Listener 解析该头部后，连接的 RemoteAddr 返回客户端地址。
+//
+//   - 只解析来自可信地址（Trusted）的连接的头部，其它连接原样返回，避免客户端直连时伪造来源地址
+//   - 可信地址的连接没有发送 PROXY 头时（如健康检查）按普通连接处理
+//   - 头部在连接第一次 Read 或 RemoteAddr 时解析（在 HTTP 服务的连接协程中），不阻塞 Accept
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	v1Prefix    = "PROXY "
+	v1MaxLength = 107 // 规范规定的 v1 头部最大长度（含 \r\n）
+
+	defaultHeaderTimeout = 3 * time.Second
+)
+
+// v2Signature v2 头部的固定签名
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Listener 解析 PROXY 头的监听器
+type Listener struct {
+	net.Listener
+	Trusted       func(addr netip.Addr) bool // 是否解析该地址发来的 PROXY 头，为 nil 时全部解析
+	HeaderTimeout time.Duration              // 读取头部的超时，默认 3 秒
+}
+
+// Accept 接受连接，来自可信地址的连接包装为 *Conn
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.Trusted != nil && !l.Trusted(addrOf(conn.RemoteAddr())) {
+		return conn, nil
+	}
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = defaultHeaderTimeout
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Conn 可能带有 PROXY 头的连接
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	remote net.Addr // 头部中的客户端地址，没有头部时为 nil
+	err    error
+}
+
+// Read 读取数据（跳过 PROXY 头）
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr 客户端地址：有 PROXY 头时为头部中的地址，否则为连接的对端地址
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader 解析 PROXY 头
+func (c *Conn) readHeader() {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		c.err = err
+		return
+	}
+	c.remote, c.err = parseHeader(c.reader)
+	if err := c.Conn.SetReadDeadline(time.Time{}); err != nil && c.err == nil {
+		c.err = err
+	}
+	if c.err != nil {
+		c.err = fmt.Errorf("proxyproto: %w", c.err)
+	}
+}
+
+// parseHeader 读取并解析头部；不是 PROXY 头时不消费任何数据，返回 nil 地址
+func parseHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch first[0] {
+	case v1Prefix[0]:
+		if prefix, err := r.Peek(len(v1Prefix)); err == nil && string(prefix) == v1Prefix {
+			return parseV1(r)
+		}
+	case v2Signature[0]:
+		if prefix, err := r.Peek(len(v2Signature)); err == nil && bytes.Equal(prefix, v2Signature) {
+			return parseV2(r)
+		}
+	}
+	return nil, nil
+}
+
+// parseV1 解析 v1 头部：PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func parseV1(r *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, v1MaxLength)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return nil, errors.New("v1 header too long")
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errors.New("v1 header must end with CRLF")
+	}
+
+	fields := strings.Split(text, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		// 负载均衡无法获取客户端地址，使用连接的对端地址
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid v1 header: %q", text)
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil || ip.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("invalid v1 source address: %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 source port: %q", fields[4])
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// parseV2 解析 v2 头部：签名(12) + 版本/命令(1) + 协议族(1) + 长度(2) + 地址 + TLV
+func parseV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version: %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch command {
+	case 0x0: // LOCAL：负载均衡自身发起的连接（如健康检查），使用连接的对端地址
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported v2 command: %d", command)
+	}
+
+	switch family >> 4 {
+	case 0x1: // IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("v2 IPv4 address block too short")
+		}
+		ip := netip.AddrFrom4([4]byte(payload[0:4]))
+		port := binary.BigEndian.Uint16(payload[8:10])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+	case 0x2: // IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("v2 IPv6 address block too short")
+		}
+		ip := netip.AddrFrom16([16]byte(payload[0:16]))
+		port := binary.BigEndian.Uint16(payload[32:34])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+	default:
+		// UNSPEC / UNIX 套接字：没有可用的 IP 地址
+		return nil, nil
+	}
+}
+
+// addrOf 取连接地址中的 IP（IPv4 映射的 IPv6 地址转换为 IPv4）
+func addrOf(addr net.Addr) netip.Addr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		ip, _ := netip.AddrFromSlice(tcp.IP)
+		return ip.Unmap()
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
@@ -1,15 +1,20 @@
 package redis
 
 import (
+	"time"
+
 	"github.com/redis/go-redis/v9"
 )
 
 type Link struct {
-	User     string
-	Password string
-	Db       int
-	Ip       string
-	Port     string
+	User         string
+	Password     string
+	Db           int
+	Ip           string
+	Port         string
+	DialTimeout  time.Duration // 为 0 时使用 go-redis 默认值
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
 }
 
 func Start(redislink Link) *redis.Client {
@@ -18,10 +23,13 @@ func Start(redislink Link) *redis.Client {
 	db := redislink.Db
 	addr := redislink.Ip + ":" + redislink.Port
 	dbcli := redis.NewClient(&redis.Options{
-		Username: user,
-		Addr:     addr,
-		Password: password,
-		DB:       db,
+		Username:     user,
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		DialTimeout:  redislink.DialTimeout,
+		ReadTimeout:  redislink.ReadTimeout,
+		WriteTimeout: redislink.WriteTimeout,
 	})
 
 	return dbcli
@@ -0,0 +1,298 @@
+package richtext
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// htmlTags 允许的标签 -> 节点标签
+var htmlTags = map[string]string{
+	"b": "b", "strong": "b",
+	"i": "i", "em": "i",
+	"u": "u",
+	"s": "s", "del": "s", "strike": "s",
+	"br": "br",
+	"p":  "p", "div": "p",
+	"h1": "h1", "h2": "h2", "h3": "h3",
+	"ul": "ul", "ol": "ol", "li": "li",
+	"a":    "a",
+	"span": "span", "font": "span",
+	"color": "span", "size": "span", // TextMeshPro 风格：<color=#ff0000>...</color>
+}
+
+// dangerousTags 可执行脚本或嵌入外部内容的标签，丢弃时连同内容一起丢弃
+var dangerousTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "applet": true,
+	"svg": true, "math": true, "template": true, "noscript": true, "textarea": true,
+	"title": true, "xmp": true, "noembed": true, "noframes": true, "frameset": true,
+	"form": true, "button": true, "select": true,
+}
+
+// dangerousVoidTags 不需要结束标签的危险标签
+var dangerousVoidTags = map[string]bool{
+	"embed": true, "input": true, "link": true, "meta": true, "base": true, "frame": true,
+}
+
+// ignoredAttrs 编辑器常见的无害属性，直接忽略
+var ignoredAttrs = map[string]bool{
+	"class": true, "id": true, "title": true, "dir": true, "target": true, "rel": true,
+}
+
+// htmlParser 受限 HTML 解析
+type htmlParser struct {
+	src    string
+	strict bool
+	root   *Node
+	stack  []*Node // 未闭合的元素
+	starts []int   // 未闭合元素的起始位置
+}
+
+// parseHTML 解析受限的 HTML 子集
+func parseHTML(src string, strict bool) ([]*Node, error) {
+	p := &htmlParser{src: src, strict: strict, root: &Node{}}
+	p.stack = []*Node{p.root}
+	p.starts = []int{0}
+
+	z := html.NewTokenizer(strings.NewReader(src))
+	offset := 0
+	skip := 0 // 正在丢弃的危险标签层数
+	for {
+		tt := z.Next()
+		start := offset
+		offset += len(z.Raw())
+
+		switch tt {
+		case html.ErrorToken:
+			if !errors.Is(z.Err(), io.EOF) {
+				return nil, p.errorAt(start, z.Err().Error())
+			}
+			if strict && len(p.stack) > 1 {
+				n := len(p.stack) - 1
+				return nil, p.errorAt(p.starts[n], fmt.Sprintf("标签 <%s> 未闭合", p.stack[n].Tag))
+			}
+			return p.root.Children, nil
+
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			p.text(string(z.Text()))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if skip > 0 {
+				if dangerousTags[tag] && tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if dangerousTags[tag] || dangerousVoidTags[tag] {
+				if strict {
+					return nil, p.errorAt(start, fmt.Sprintf("不允许的标签 <%s>", tag))
+				}
+				if dangerousTags[tag] && tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+
+			node, err := p.element(tag, z, hasAttr)
+			if err != nil {
+				if strict {
+					return nil, p.errorAt(start, err.Error())
+				}
+				if node == nil {
+					continue
+				}
+			}
+			p.current().Children = append(p.current().Children, node)
+			if tt == html.StartTagToken && node.Tag != "br" {
+				p.stack = append(p.stack, node)
+				p.starts = append(p.starts, start)
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if skip > 0 {
+				if dangerousTags[tag] {
+					skip--
+				}
+				continue
+			}
+			if err := p.end(tag); err != nil && strict {
+				return nil, p.errorAt(start, err.Error())
+			}
+		}
+		// 注释、DOCTYPE 直接忽略
+	}
+}
+
+// element 根据标签和属性创建节点；不支持的标签返回 nil
+// 属性错误时同时返回节点和错误（非严格模式下忽略该属性）
+func (p *htmlParser) element(tag string, z *html.Tokenizer, hasAttr bool) (*Node, error) {
+	// TextMeshPro 风格标签：<color=#ff0000>、<size=120%>
+	if name, value, ok := strings.Cut(tag, "="); ok {
+		value = strings.Trim(value, `"'`)
+		switch name {
+		case "color":
+			if err := checkColor(value); err != nil {
+				return nil, err
+			}
+			return &Node{Tag: "span", Color: value}, nil
+		case "size":
+			if err := checkSize(value); err != nil {
+				return nil, err
+			}
+			return &Node{Tag: "span", Size: value}, nil
+		}
+	}
+
+	nodeTag, ok := htmlTags[tag]
+	if !ok {
+		return nil, fmt.Errorf("不支持的标签 <%s>", tag)
+	}
+	node := &Node{Tag: nodeTag}
+
+	var firstErr error
+	setErr := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		attr, value := string(key), strings.TrimSpace(string(val))
+		switch {
+		case strings.HasPrefix(attr, "on"):
+			setErr(fmt.Errorf("不允许事件属性 %s", attr))
+		case tag == "a" && attr == "href":
+			if err := checkHref(value); err != nil {
+				setErr(err)
+			} else {
+				node.Href = value
+			}
+		case tag == "font" && attr == "color":
+			if err := checkColor(value); err != nil {
+				setErr(err)
+			} else {
+				node.Color = value
+			}
+		case attr == "style":
+			if err := parseStyle(node, value); err != nil {
+				setErr(err)
+			}
+		case ignoredAttrs[attr]:
+		default:
+			setErr(fmt.Errorf("标签 <%s> 不支持属性 %s", tag, attr))
+		}
+	}
+	if tag == "a" && node.Href == "" && firstErr == nil {
+		setErr(errors.New("标签 <a> 缺少 href"))
+	}
+	return node, firstErr
+}
+
+// parseStyle 从 style 中读取颜色和字号，其它样式忽略
+func parseStyle(node *Node, style string) error {
+	for _, decl := range strings.Split(style, ";") {
+		key, value, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "color":
+			if err := checkColor(value); err != nil {
+				return err
+			}
+			node.Color = value
+		case "font-size":
+			if err := checkSize(value); err != nil {
+				return err
+			}
+			node.Size = value
+		}
+	}
+	return nil
+}
+
+// text 追加文本：连续空白合并为一个空格，列表和顶层之间的纯空白忽略
+func (p *htmlParser) text(text string) {
+	cur := p.current()
+	text = collapseSpace(text)
+	if text == " " && (cur == p.root || cur.Tag == "ul" || cur.Tag == "ol") {
+		return
+	}
+	if text != "" {
+		cur.Children = append(cur.Children, &Node{Text: text})
+	}
+}
+
+// collapseSpace 连续空白（含换行）合并为一个空格，保留首尾空格以免相邻的内联元素粘连
+func collapseSpace(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// end 处理结束标签
+func (p *htmlParser) end(tag string) error {
+	nodeTag, ok := htmlTags[tag]
+	if !ok {
+		if strings.HasPrefix(tag, "color=") || strings.HasPrefix(tag, "size=") {
+			nodeTag = "span"
+		} else {
+			return fmt.Errorf("不支持的标签 </%s>", tag)
+		}
+	}
+	if nodeTag == "br" {
+		// </br> 按 <br> 处理
+		p.current().Children = append(p.current().Children, &Node{Tag: "br"})
+		return nil
+	}
+
+	for i := len(p.stack) - 1; i > 0; i-- {
+		if p.stack[i].Tag != nodeTag {
+			continue
+		}
+		if i != len(p.stack)-1 && p.strict {
+			return fmt.Errorf("标签 <%s> 未闭合", p.stack[len(p.stack)-1].Tag)
+		}
+		p.stack = p.stack[:i]
+		p.starts = p.starts[:i]
+		return nil
+	}
+	return fmt.Errorf("多余的结束标签 </%s>", tag)
+}
+
+// current 当前所在的元素
+func (p *htmlParser) current() *Node {
+	return p.stack[len(p.stack)-1]
+}
+
+// errorAt 生成指定位置的错误
+func (p *htmlParser) errorAt(offset int, msg string) error {
+	line := 1 + strings.Count(p.src[:offset], "\n")
+	lineStart := strings.LastIndex(p.src[:offset], "\n") + 1
+	return &Error{Line: line, Col: 1 + utf8.RuneCountInString(p.src[lineStart:offset]), Msg: msg}
+}
@@ -0,0 +1,194 @@
+package richtext
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	headingRegexp     = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	orderedItemRegexp = regexp.MustCompile(`^[0-9]+\.\s+`)
+)
+
+// mdEscapable 可以用反斜杠转义的字符
+const mdEscapable = "\\`*_{}[]()#+-.!~<>|"
+
+// parseMarkdown 解析 Markdown 子集：标题、段落、无序/有序列表、粗体、斜体、删除线、链接
+// 内嵌的 HTML 不做解析，按普通文本输出（转义后显示）
+func parseMarkdown(src string, strict bool) ([]*Node, error) {
+	nodes := make([]*Node, 0)
+	var para, list *Node
+	for i, line := range strings.Split(src, "\n") {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			para, list = nil, nil
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		// 标题：# ~ ######，超过三级按三级处理
+		if m := headingRegexp.FindStringSubmatch(trimmed); m != nil {
+			children, err := parseInline(m[2], lineNo, textCol(line, indent+len(trimmed)-len(m[2])), strict)
+			if err != nil {
+				return nil, err
+			}
+			level := min(len(m[1]), 3)
+			nodes = append(nodes, &Node{Tag: "h" + strconv.Itoa(level), Children: children})
+			para, list = nil, nil
+			continue
+		}
+
+		// 列表项
+		if tag, text, ok := parseListItem(trimmed); ok {
+			children, err := parseInline(text, lineNo, textCol(line, indent+len(trimmed)-len(text)), strict)
+			if err != nil {
+				return nil, err
+			}
+			if list == nil || list.Tag != tag {
+				list = &Node{Tag: tag}
+				nodes = append(nodes, list)
+			}
+			list.Children = append(list.Children, &Node{Tag: "li", Children: children})
+			para = nil
+			continue
+		}
+
+		// 段落：相邻的行合并为一个段落，行之间保留换行
+		children, err := parseInline(trimmed, lineNo, textCol(line, indent), strict)
+		if err != nil {
+			return nil, err
+		}
+		if para == nil {
+			para = &Node{Tag: "p"}
+			nodes = append(nodes, para)
+			list = nil
+		} else {
+			para.Children = append(para.Children, &Node{Tag: "br"})
+		}
+		para.Children = append(para.Children, children...)
+	}
+	return nodes, nil
+}
+
+// parseListItem 识别列表项，返回列表类型和内容
+func parseListItem(line string) (string, string, bool) {
+	for _, prefix := range []string{"- ", "* ", "+ "} {
+		if text, ok := strings.CutPrefix(line, prefix); ok {
+			return "ul", strings.TrimSpace(text), true
+		}
+	}
+	if loc := orderedItemRegexp.FindStringIndex(line); loc != nil {
+		return "ol", line[loc[1]:], true
+	}
+	return "", "", false
+}
+
+// parseInline 解析行内标记，col 为 s 在原文中的起始列
+func parseInline(s string, line, col int, strict bool) ([]*Node, error) {
+	nodes := make([]*Node, 0)
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, &Node{Text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		pos := col + utf8.RuneCountInString(s[:i])
+
+		// 转义
+		if c == '\\' && i+1 < len(s) && strings.IndexByte(mdEscapable, s[i+1]) >= 0 {
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+
+		// 链接：[文字](地址)
+		if c == '[' {
+			if label, href, n, ok := matchLink(s[i:]); ok {
+				children, err := parseInline(label, line, pos+1, strict)
+				if err != nil {
+					return nil, err
+				}
+				flush()
+				if err := checkHref(href); err != nil {
+					if strict {
+						return nil, &Error{Line: line, Col: pos, Msg: err.Error()}
+					}
+					// 地址不合法时只保留链接文字
+					nodes = append(nodes, children...)
+				} else {
+					nodes = append(nodes, &Node{Tag: "a", Href: href, Children: children})
+				}
+				i += n
+				continue
+			}
+		}
+
+		// 粗体、斜体、删除线：找不到结束标记时按普通文本处理
+		if tag, delim := matchDelim(s, i); tag != "" {
+			rest := s[i+len(delim):]
+			if end := strings.Index(rest, delim); end > 0 {
+				children, err := parseInline(rest[:end], line, pos+len(delim), strict)
+				if err != nil {
+					return nil, err
+				}
+				flush()
+				nodes = append(nodes, &Node{Tag: tag, Children: children})
+				i += 2*len(delim) + end
+				continue
+			}
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return nodes, nil
+}
+
+// matchDelim 识别 s[i] 处的强调标记
+func matchDelim(s string, i int) (string, string) {
+	rest := s[i:]
+	switch {
+	case strings.HasPrefix(rest, "**"):
+		return "b", "**"
+	case strings.HasPrefix(rest, "__"):
+		return "b", "__"
+	case strings.HasPrefix(rest, "~~"):
+		return "s", "~~"
+	case rest[0] == '*':
+		return "i", "*"
+	case rest[0] == '_' && (i == 0 || !isWordByte(s[i-1])):
+		// snake_case 中的下划线不作为斜体标记
+		return "i", "_"
+	}
+	return "", ""
+}
+
+// matchLink 识别 [文字](地址)，返回文字、地址和消耗的字节数
+func matchLink(s string) (string, string, int, bool) {
+	mid := strings.Index(s, "](")
+	if mid < 0 {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(s[mid+2:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	return s[1:mid], strings.TrimSpace(s[mid+2 : mid+2+end]), mid + 3 + end, true
+}
+
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// textCol 行内字节偏移对应的列号（从 1 开始）
+func textCol(line string, offset int) int {
+	return 1 + utf8.RuneCountInString(line[:offset])
+}
@@ -0,0 +1,187 @@
+package richtext
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var blankLinesRegexp = regexp.MustCompile(`\n{3,}`)
+
+// tmpHeadingSize 标题在 TextMeshPro 中的字号
+var tmpHeadingSize = map[string]string{"h1": "150%", "h2": "130%", "h3": "115%"}
+
+// RenderNodes 将节点树输出为目标格式
+func RenderNodes(nodes []*Node, target string) string {
+	var b strings.Builder
+	switch target {
+	case TargetTMP:
+		renderTMP(&b, nodes)
+	case TargetPlain:
+		renderPlain(&b, nodes)
+	default:
+		renderHTML(&b, nodes)
+		return b.String()
+	}
+	return strings.TrimSpace(blankLinesRegexp.ReplaceAllString(b.String(), "\n\n"))
+}
+
+// renderHTML 输出净化后的 HTML（属性值均已在解析时校验）
+func renderHTML(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Tag {
+		case "":
+			b.WriteString(html.EscapeString(n.Text))
+		case "br":
+			b.WriteString("<br>")
+		case "a":
+			if n.Href == "" {
+				// 地址不合法的链接只保留文字
+				renderHTML(b, n.Children)
+				continue
+			}
+			b.WriteString(`<a href="` + html.EscapeString(n.Href) + `">`)
+			renderHTML(b, n.Children)
+			b.WriteString("</a>")
+		case "span":
+			styles := make([]string, 0, 2)
+			if n.Color != "" {
+				styles = append(styles, "color:"+n.Color)
+			}
+			if n.Size != "" {
+				styles = append(styles, "font-size:"+cssSize(n.Size))
+			}
+			b.WriteString(`<span style="` + strings.Join(styles, ";") + `">`)
+			renderHTML(b, n.Children)
+			b.WriteString("</span>")
+		default:
+			b.WriteString("<" + n.Tag + ">")
+			renderHTML(b, n.Children)
+			b.WriteString("</" + n.Tag + ">")
+		}
+	}
+}
+
+// renderTMP 输出 Unity TextMeshPro 富文本标签
+func renderTMP(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Tag {
+		case "":
+			// 文本中的 < 会被 TextMeshPro 当作标签，用 noparse 原样显示
+			b.WriteString(strings.ReplaceAll(n.Text, "<", "<noparse><</noparse>"))
+		case "br":
+			b.WriteString("\n")
+		case "b", "i", "u", "s":
+			b.WriteString("<" + n.Tag + ">")
+			renderTMP(b, n.Children)
+			b.WriteString("</" + n.Tag + ">")
+		case "p":
+			ensureNewline(b)
+			renderTMP(b, n.Children)
+			b.WriteString("\n\n")
+		case "h1", "h2", "h3":
+			ensureNewline(b)
+			b.WriteString("<size=" + tmpHeadingSize[n.Tag] + "><b>")
+			renderTMP(b, n.Children)
+			b.WriteString("</b></size>\n")
+		case "ul", "ol":
+			ensureNewline(b)
+			renderList(b, n, renderTMP)
+			b.WriteString("\n")
+		case "li":
+			ensureNewline(b)
+			b.WriteString("• ")
+			renderTMP(b, n.Children)
+			b.WriteString("\n")
+		case "a":
+			if n.Href == "" {
+				renderTMP(b, n.Children)
+				continue
+			}
+			b.WriteString(`<link="` + strings.ReplaceAll(n.Href, `"`, "%22") + `"><u>`)
+			renderTMP(b, n.Children)
+			b.WriteString("</u></link>")
+		case "span":
+			if n.Color != "" {
+				b.WriteString("<color=" + n.Color + ">")
+			}
+			if n.Size != "" {
+				b.WriteString("<size=" + n.Size + ">")
+			}
+			renderTMP(b, n.Children)
+			if n.Size != "" {
+				b.WriteString("</size>")
+			}
+			if n.Color != "" {
+				b.WriteString("</color>")
+			}
+		}
+	}
+}
+
+// renderPlain 输出纯文本
+func renderPlain(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Tag {
+		case "":
+			b.WriteString(n.Text)
+		case "br":
+			b.WriteString("\n")
+		case "p":
+			ensureNewline(b)
+			renderPlain(b, n.Children)
+			b.WriteString("\n\n")
+		case "h1", "h2", "h3":
+			ensureNewline(b)
+			renderPlain(b, n.Children)
+			b.WriteString("\n")
+		case "ul", "ol":
+			ensureNewline(b)
+			renderList(b, n, renderPlain)
+			b.WriteString("\n")
+		case "li":
+			ensureNewline(b)
+			b.WriteString("• ")
+			renderPlain(b, n.Children)
+			b.WriteString("\n")
+		default:
+			renderPlain(b, n.Children)
+		}
+	}
+}
+
+// renderList 输出列表：无序列表以 • 开头，有序列表以序号开头
+func renderList(b *strings.Builder, list *Node, render func(*strings.Builder, []*Node)) {
+	index := 0
+	for _, item := range list.Children {
+		if item.Tag != "li" {
+			render(b, []*Node{item})
+			continue
+		}
+		index++
+		ensureNewline(b)
+		if list.Tag == "ol" {
+			b.WriteString(strconv.Itoa(index) + ". ")
+		} else {
+			b.WriteString("• ")
+		}
+		render(b, item.Children)
+		b.WriteString("\n")
+	}
+}
+
+// ensureNewline 块级元素从新的一行开始
+func ensureNewline(b *strings.Builder) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		b.WriteString("\n")
+	}
+}
+
+// cssSize 字号转换为 CSS：没有单位的数字按 px 处理
+func cssSize(size string) string {
+	if strings.HasSuffix(size, "%") || strings.HasSuffix(size, "px") || strings.HasSuffix(size, "em") {
+		return size
+	}
+	return size + "px"
+}
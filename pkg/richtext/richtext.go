@@ -0,0 +1,144 @@
+// Package richtext 公告正文的富文本处理
+//
+// 输入支持三种格式：
+//   - html:     受限的 HTML 子集（b/strong/i/em/u/s/del/br/p/div/h1-h3/ul/ol/li/a/span/font），
+//     同时兼容 TextMeshPro 风格的 <color=#ff0000>、<size=120%> 标签
+//   - markdown: 标题(#)、列表(- / 1.)、粗体、斜体、删除线、链接，内嵌 HTML 按普通文本处理
+//   - text:     纯文本，换行保留
+//
+// 内容先解析为只包含允许元素的节点树，再输出为目标格式：
+//   - html:  净化后的 HTML
+//   - tmp:   Unity TextMeshPro 富文本标签
+//   - plain: 去掉全部标记的纯文本
+//
+// Validate 用于保存前校验，遇到不允许的内容时返回带行列号的错误；
+// Render 用于输出，不允许的内容会被直接丢弃（数据库被直接修改时也不会下发危险内容）。
+package richtext
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// 输入格式
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// 输出格式
+const (
+	TargetHTML  = "html"
+	TargetTMP   = "tmp"
+	TargetPlain = "plain"
+)
+
+// Node 节点，Tag 为空表示文本节点
+type Node struct {
+	Tag      string // b i u s br p h1 h2 h3 ul ol li a span
+	Text     string // 文本节点的内容（已解码，未转义）
+	Href     string // a: 链接地址
+	Color    string // span: 颜色
+	Size     string // span: 字号
+	Children []*Node
+}
+
+// Error 内容错误，行列号从 1 开始
+type Error struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("第%d行第%d列: %s", e.Line, e.Col, e.Msg)
+}
+
+// IsFormat 是否为支持的输入格式
+func IsFormat(format string) bool {
+	return format == FormatHTML || format == FormatMarkdown || format == FormatText
+}
+
+// IsTarget 是否为支持的输出格式
+func IsTarget(target string) bool {
+	return target == TargetHTML || target == TargetTMP || target == TargetPlain
+}
+
+// Validate 校验内容，返回第一个错误
+func Validate(content, format string) error {
+	_, err := Parse(content, format, true)
+	return err
+}
+
+// Render 净化内容并转换为目标格式
+func Render(content, format, target string) string {
+	nodes, _ := Parse(content, format, false)
+	return RenderNodes(nodes, target)
+}
+
+// Parse 解析内容；strict 为 true 时遇到不允许的内容返回错误，否则丢弃不允许的部分
+func Parse(content, format string, strict bool) ([]*Node, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	switch format {
+	case FormatHTML:
+		return parseHTML(content, strict)
+	case FormatMarkdown:
+		return parseMarkdown(content, strict)
+	case FormatText:
+		return parseText(content), nil
+	default:
+		return nil, &Error{Line: 1, Col: 1, Msg: "不支持的内容格式: " + format}
+	}
+}
+
+// parseText 纯文本：按行拆分，行之间插入换行
+func parseText(content string) []*Node {
+	nodes := make([]*Node, 0)
+	for i, line := range strings.Split(content, "\n") {
+		if i > 0 {
+			nodes = append(nodes, &Node{Tag: "br"})
+		}
+		if line != "" {
+			nodes = append(nodes, &Node{Text: line})
+		}
+	}
+	return nodes
+}
+
+// 颜色：#rgb #rrggbb #rrggbbaa 或 TextMeshPro 支持的颜色名
+var (
+	hexColorRegexp = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	sizeRegexp     = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]+)?(%|px|em)?$`)
+	namedColors    = map[string]bool{
+		"black": true, "blue": true, "green": true, "orange": true,
+		"purple": true, "red": true, "white": true, "yellow": true,
+	}
+)
+
+// checkColor 校验颜色
+func checkColor(color string) error {
+	if hexColorRegexp.MatchString(color) || namedColors[strings.ToLower(color)] {
+		return nil
+	}
+	return fmt.Errorf("颜色格式错误: %s（支持 #rrggbb 或 red/green/blue 等颜色名）", color)
+}
+
+// checkSize 校验字号
+func checkSize(size string) error {
+	if sizeRegexp.MatchString(size) {
+		return nil
+	}
+	return fmt.Errorf("字号格式错误: %s（如 120%%、24）", size)
+}
+
+// checkHref 校验链接地址，只允许 http/https
+func checkHref(href string) error {
+	u, err := url.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("链接地址只支持 http/https: %s", href)
+	}
+	return nil
+}
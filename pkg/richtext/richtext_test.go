@@ -0,0 +1,224 @@
+package richtext
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		line    int
+		col     int
+		msg     string // 错误信息包含的内容
+	}{
+		{name: "javascript 链接", format: FormatHTML, content: `<a href="javascript:alert(1)">x</a>`, line: 1, col: 1, msg: "链接地址只支持"},
+		{name: "大小写混合的 javascript 链接", format: FormatHTML, content: `<a href=" JaVaScRiPt:alert(1)">x</a>`, line: 1, col: 1, msg: "链接地址只支持"},
+		{name: "data 链接", format: FormatHTML, content: `<a href="data:text/html;base64,PHNjcmlwdD4=">x</a>`, line: 1, col: 1, msg: "链接地址只支持"},
+		{name: "协议相对链接", format: FormatHTML, content: `<a href="//evil.example/x">x</a>`, line: 1, col: 1, msg: "链接地址只支持"},
+		{name: "缺少 href", format: FormatHTML, content: `<a>x</a>`, line: 1, col: 1, msg: "缺少 href"},
+		{name: "事件属性", format: FormatHTML, content: `<b onclick="alert(1)">x</b>`, line: 1, col: 1, msg: "不允许事件属性 onclick"},
+		{name: "大写的事件属性", format: FormatHTML, content: `<p ONMOUSEOVER="alert(1)">x</p>`, line: 1, col: 1, msg: "不允许事件属性 onmouseover"},
+		{name: "img onerror", format: FormatHTML, content: `<img src=x onerror=alert(1)>`, line: 1, col: 1, msg: "不支持的标签 <img>"},
+		{name: "script", format: FormatHTML, content: `ok<script>alert(1)</script>`, line: 1, col: 3, msg: "不允许的标签 <script>"},
+		{name: "svg", format: FormatHTML, content: `<svg onload=alert(1)></svg>`, line: 1, col: 1, msg: "不允许的标签 <svg>"},
+		{name: "iframe", format: FormatHTML, content: `<p><iframe src="https://x.example"></iframe></p>`, line: 1, col: 4, msg: "不允许的标签 <iframe>"},
+		{name: "embed", format: FormatHTML, content: `<embed src=x>`, line: 1, col: 1, msg: "不允许的标签 <embed>"},
+		{name: "不支持的属性", format: FormatHTML, content: `<span data-x="1">x</span>`, line: 1, col: 1, msg: "不支持属性 data-x"},
+		{name: "style 中的非法颜色", format: FormatHTML, content: `<span style="color: expression(alert(1))">x</span>`, line: 1, col: 1, msg: "颜色格式错误"},
+		{name: "第二行的错误", format: FormatHTML, content: "第一行\n  <b>ok</b> <script>x</script>", line: 2, col: 13, msg: "<script>"},
+		{name: "中文按字符计列", format: FormatHTML, content: "你好<i>世界", line: 1, col: 3, msg: "标签 <i> 未闭合"},
+		{name: "交叉嵌套", format: FormatHTML, content: "<b><i>x</b></i>", line: 1, col: 8, msg: "标签 <i> 未闭合"},
+		{name: "多余的结束标签", format: FormatHTML, content: "x</u>", line: 1, col: 2, msg: "多余的结束标签 </u>"},
+		{name: "markdown javascript 链接", format: FormatMarkdown, content: "标题\n\n- 项目 [链接](javascript:alert(1))", line: 3, col: 6, msg: "链接地址只支持"},
+		{name: "markdown data 链接", format: FormatMarkdown, content: "**粗体** [x](data:text/html,x)", line: 1, col: 8, msg: "链接地址只支持"},
+		{name: "不支持的格式", format: "bbcode", content: "x", line: 1, col: 1, msg: "不支持的内容格式"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.content, tt.format)
+			var rtErr *Error
+			if !errors.As(err, &rtErr) {
+				t.Fatalf("Validate(%q) = %v, want *Error", tt.content, err)
+			}
+			if rtErr.Line != tt.line || rtErr.Col != tt.col || !strings.Contains(rtErr.Msg, tt.msg) {
+				t.Fatalf("Validate(%q) = %v, want 第%d行第%d列 containing %q", tt.content, err, tt.line, tt.col, tt.msg)
+			}
+		})
+	}
+}
+
+func TestValidateAccepts(t *testing.T) {
+	tests := []struct {
+		format  string
+		content string
+	}{
+		{FormatHTML, `<p class="x" id="y">普通<b>粗体</b><em>斜体</em><br/>换行</p>`},
+		{FormatHTML, `<a href="https://example.com/a?b=1&amp;c=2" target="_blank" rel="noopener">链接</a>`},
+		{FormatHTML, `<ul><li>一</li><li>二</li></ul>`},
+		{FormatHTML, `<font color="#ff0000">红</font><span style="font-size: 14px; font-weight: bold">字</span>`},
+		{FormatHTML, `<color=#FF0000>红</color><size=120%>大</size>`},
+		{FormatMarkdown, "# 标题\n\n- [链接](http://example.com)\n\nsnake_case"},
+		{FormatText, "<script>alert(1)</script>"},
+	}
+
+	for _, tt := range tests {
+		if err := Validate(tt.content, tt.format); err != nil {
+			t.Errorf("Validate(%q, %s) = %v, want nil", tt.content, tt.format, err)
+		}
+	}
+}
+
+func TestColorValidation(t *testing.T) {
+	tests := []struct {
+		color string
+		valid bool
+	}{
+		{"#fff", true},
+		{"#FF0000", true},
+		{"#ff000080", true},
+		{"red", true},
+		{"Yellow", true},
+		{"#ff00", false},
+		{"#gggggg", false},
+		{"ff0000", false},
+		{"pink", false},
+		{"rgb(255,0,0)", false},
+		{"red)", false},
+		{"javascript:alert(1)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			// TextMeshPro 风格、font 属性、style 三种写法的校验结果一致
+			for _, content := range []string{
+				"<color=" + tt.color + ">x</color>",
+				`<font color="` + tt.color + `">x</font>`,
+				`<span style="color:` + tt.color + `">x</span>`,
+			} {
+				err := Validate(content, FormatHTML)
+				if (err == nil) != tt.valid {
+					t.Errorf("Validate(%q) = %v, want valid=%v", content, err, tt.valid)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderSanitizesHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "javascript 链接只保留文字", content: `<a href="javascript:alert(1)">click</a>`, want: "click"},
+		{name: "data 链接只保留文字", content: `<a href="data:text/html,x">click</a>`, want: "click"},
+		{name: "事件属性被丢弃", content: `<p onclick="alert(1)">hi</p>`, want: "<p>hi</p>"},
+		{name: "script 连同内容丢弃", content: `<div><script>alert(1)</script>ok</div>`, want: "<p>ok</p>"},
+		{name: "svg 内嵌 script", content: `<svg><script>alert(1)</script><g>y</g></svg>after`, want: "after"},
+		{name: "嵌套 svg", content: `<svg><svg></svg>leak</svg>ok`, want: "ok"},
+		{name: "style 内的标签", content: `<style><b>x</b></style>ok`, want: "ok"},
+		{name: "img onerror", content: `<img src=x onerror=alert(1)>text`, want: "text"},
+		{name: "embed", content: `a<embed src=x>b`, want: "ab"},
+		{name: "非法颜色被丢弃", content: `<color=expression(x)>bad</color>`, want: "bad"},
+		{name: "TextMeshPro 颜色", content: `<color=#ff0000>red</color>`, want: `<span style="color:#ff0000">red</span>`},
+		{name: "TextMeshPro 字号", content: `<size=120%>big</size>`, want: `<span style="font-size:120%">big</span>`},
+		{name: "style 颜色和字号", content: `<span style="color:red;font-size:12">a</span>`, want: `<span style="color:red;font-size:12px">a</span>`},
+		{name: "文本转义", content: `a &lt; b &amp; "c"`, want: "a &lt; b &amp; &#34;c&#34;"},
+		{name: "链接地址转义", content: `<a href="https://x.example/?a=1&b=2">l</a>`, want: `<a href="https://x.example/?a=1&amp;b=2">l</a>`},
+		{name: "注释被丢弃", content: `a<!-- <script>alert(1)</script> -->b`, want: "ab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.content, FormatHTML, TargetHTML); got != tt.want {
+				t.Fatalf("Render(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTMPEscaping(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    string
+	}{
+		{name: "文本中的 <", format: FormatText, content: "a<b>c", want: "a<noparse><</noparse>b>c"},
+		{name: "文本中的 </noparse> 不能提前结束 noparse", format: FormatText, content: "</noparse><color=red>x",
+			want: "<noparse><</noparse>/noparse><noparse><</noparse>color=red>x"},
+		{name: "HTML 实体解码后的 <", format: FormatHTML, content: "<b>bold</b> &lt;i&gt;", want: "<b>bold</b> <noparse><</noparse>i>"},
+		{name: "markdown 内嵌 HTML", format: FormatMarkdown, content: "<script>alert(1)</script>",
+			want: "<noparse><</noparse>script>alert(1)<noparse><</noparse>/script>"},
+		{name: "链接地址中的引号", format: FormatHTML, content: `<a href='https://x.example/"a'>l</a>`,
+			want: `<link="https://x.example/%22a"><u>l</u></link>`},
+		{name: "颜色和字号", format: FormatHTML, content: `<span style="color:#00ff00;font-size:24">x</span>`,
+			want: "<color=#00ff00><size=24>x</size></color>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.content, tt.format, TargetTMP); got != tt.want {
+				t.Fatalf("Render(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownRender(t *testing.T) {
+	content := "# 标题\n\n**粗体** 和 *斜体* ~~删除~~\n第二行\n\n1. 一\n2. 二\n\n[链接](https://example.com) snake_case_name"
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{TargetHTML, `<h1>标题</h1><p><b>粗体</b> 和 <i>斜体</i> <s>删除</s><br>第二行</p><ol><li>一</li><li>二</li></ol>` +
+			`<p><a href="https://example.com">链接</a> snake_case_name</p>`},
+		{TargetTMP, "<size=150%><b>标题</b></size>\n<b>粗体</b> 和 <i>斜体</i> <s>删除</s>\n第二行\n\n1. 一\n2. 二\n\n" +
+			`<link="https://example.com"><u>链接</u></link> snake_case_name`},
+		{TargetPlain, "标题\n粗体 和 斜体 删除\n第二行\n\n1. 一\n2. 二\n\n链接 snake_case_name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if got := Render(content, FormatMarkdown, tt.target); got != tt.want {
+				t.Fatalf("Render(markdown, %s) = %q, want %q", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRoundTrip 输出的 HTML 可以再次通过严格校验，重新解析后输出不变
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		format  string
+		content string
+	}{
+		{FormatMarkdown, "# 标题\n\n**粗体** *斜体* ~~删除~~ [链接](https://example.com/?a=1&b=2)\n\n- 一\n- 二\n\n1. 三"},
+		{FormatMarkdown, "<script>alert(1)</script> & \"引号\""},
+		{FormatHTML, `<p>段落<br><font color="red">红</font><size=120%>大</size></p><ul><li><a href="https://x.example">l</a></li></ul>`},
+		{FormatHTML, `<div onclick="x"><script>alert(1)</script><svg><g/></svg>&lt;b&gt;文本</div>`},
+		{FormatText, "第一行\n<第二行>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			html := Render(tt.content, tt.format, TargetHTML)
+			if err := Validate(html, FormatHTML); err != nil {
+				t.Fatalf("Validate(%q) = %v", html, err)
+			}
+			if again := Render(html, FormatHTML, TargetHTML); again != html {
+				t.Fatalf("re-render = %q, want %q", again, html)
+			}
+			// 先转为 HTML 再转为 TextMeshPro，与直接转换的结果一致
+			if direct, viaHTML := Render(tt.content, tt.format, TargetTMP), Render(html, FormatHTML, TargetTMP); direct != viaHTML {
+				t.Fatalf("tmp = %q, via html = %q", direct, viaHTML)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package request
+
+import (
+	"fmt"
+	"loginServer/pkg/ipset"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// 访问解释
+// 给定客户端 IP 和路由路径，按中间件的实际顺序（黑名单 -> checkLimitApi -> 地区限制）给出访问结果和原因，
+// 用于排查游戏服或后台收到“IP不在白名单中”时的具体原因。
+// 后台接口：GET /loginServer/whitelist/explain?ip=1.2.3.4&path=/loginServer/reportServerList
+// Shell：shell.explainAccess("1.2.3.4", "/loginServer/reportServerList")
+
+// 中间件中 checkLimitApi 之外的判断依据
+const (
+	limitRuleDenylist   = "denylist"    // 被黑名单拒绝（在 checkLimitApi 之前检查）
+	limitRuleGeoBlocked = "geo_blocked" // 被地区规则拒绝（在 checkLimitApi 之后检查）
+)
+
+// explainAccess 供后台接口调用的 ExplainAccess
+// ExplainAccess 需要读取 routeCache，而 routeCache 的初始化又引用了后台接口的处理函数，
+// 处理函数直接调用会形成包初始化的循环引用，因此在 init 中赋值
+var explainAccess func(ip, path string) AccessExplain
+
+func init() {
+	explainAccess = ExplainAccess
+}
+
+// AccessExplain 访问结果的解释
+type AccessExplain struct {
+	IP       string          `json:"ip"`                // 用于判断的 IP（IPv4 映射的 IPv6 地址转换为 IPv4）
+	Path     string          `json:"path"`              // 路由路径
+	ApiGroup string          `json:"api_group"`         // 路由所属的 API 分组
+	Allowed  bool            `json:"allowed"`           // 是否允许访问
+	Message  string          `json:"message"`           // 拒绝时中间件返回的信息
+	Rule     string          `json:"rule"`              // 判断依据
+	Matched  *WhitelistEntry `json:"matched,omitempty"` // 命中的白名单条目
+	Notes    []string        `json:"notes"`             // 说明
+}
+
+// String 便于在 Shell 中阅读的格式
+func (e AccessExplain) String() string {
+	var b strings.Builder
+	result := "允许"
+	if !e.Allowed {
+		result = "拒绝（" + e.Message + "）"
+	}
+	fmt.Fprintf(&b, "IP: %s  路由: %s  分组: %s\n结果: %s  依据: %s", e.IP, e.Path, e.ApiGroup, result, e.Rule)
+	for _, note := range e.Notes {
+		b.WriteString("\n  - " + note)
+	}
+	return b.String()
+}
+
+// ExplainAccess 解释客户端 IP 访问该路由的结果
+func ExplainAccess(ip, path string) AccessExplain {
+	now := time.Now().Unix()
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	explain := AccessExplain{IP: strings.TrimSpace(ip), Path: path, Notes: make([]string, 0)}
+	if route, ok := routeCache[path]; ok {
+		explain.ApiGroup = route.ApiGroup
+	}
+
+	addr, err := netip.ParseAddr(explain.IP)
+	if err == nil && addr.Is4In6() {
+		explain.IP = addr.Unmap().String()
+		explain.Notes = append(explain.Notes, fmt.Sprintf("%s 是 IPv4 映射的 IPv6 地址，按 IPv4 地址 %s 匹配", ip, explain.IP))
+	}
+	if err == nil && isTrustedProxy(addr) {
+		explain.Notes = append(explain.Notes, "该 IP 是可信代理地址：如果这是服务端看到的客户端 IP，说明代理没有传递转发头（X-Forwarded-For 等）")
+	}
+
+	// 黑名单在 checkLimitApi 之前检查
+	if blocked, msg, retryAfter := checkDenylist(explain.IP); blocked {
+		explain.Rule, explain.Message = limitRuleDenylist, msg
+		if retryAfter > 0 {
+			explain.Notes = append(explain.Notes, fmt.Sprintf("该 IP 被自动封禁，%d 秒后解除，可通过 /loginServer/denylist/remove 提前解除", retryAfter))
+		} else {
+			explain.Notes = append(explain.Notes, "该 IP 命中手动黑名单条目，黑名单在白名单之前检查，对所有路由生效")
+		}
+		return explain
+	}
+
+	decision := decideLimitApi(path, explain.IP, now)
+	explain.Allowed, explain.Message, explain.Rule = decision.allowed, decision.message, decision.rule
+	group := strings.ToLower(explain.ApiGroup)
+
+	switch decision.rule {
+	case limitRuleDevMode:
+		explain.Notes = append(explain.Notes, "server_mod 为 dev：开发环境不检查调试接口和白名单")
+	case limitRuleUnknownRoute:
+		explain.Notes = append(explain.Notes, "路由未注册，中间件不限制，请求会返回 404，请检查路径是否正确")
+	case limitRuleDebugRoute:
+		explain.Notes = append(explain.Notes, "该路由是调试接口，生产环境一律拒绝，与 IP 无关")
+	case limitRuleNoGroup:
+		explain.Notes = append(explain.Notes, "该路由没有设置 API 分组，不检查白名单")
+	case limitRuleGroupMissing:
+		explain.Notes = append(explain.Notes, fmt.Sprintf("分组 %s 没有配置白名单，允许所有 IP 访问", group))
+	case limitRuleInvalidIP:
+		explain.Notes = append(explain.Notes, "无法解析该 IP 地址")
+	case limitRuleGroupEmpty:
+		explain.Notes = append(explain.Notes, fmt.Sprintf("分组 %s 的白名单为空列表，不允许任何 IP 访问", group))
+	case limitRuleMatched:
+		if entry, ok := findWhitelistEntry(decision.group.entries, decision.matched, now); ok {
+			explain.Matched = &entry
+			explain.Notes = append(explain.Notes, "命中白名单条目 "+describeWhitelistEntry(entry))
+		}
+	case limitRuleNotMatched:
+		explain.Notes = append(explain.Notes, explainNotMatched(group, decision.group.entries, addr.Unmap(), now)...)
+	}
+	if explain.Allowed && explain.ApiGroup != "" {
+		explainGeoAccess(&explain, now)
+	}
+	return explain
+}
+
+// explainGeoAccess 白名单检查通过后按地区规则判断（不考虑豁免账号）
+func explainGeoAccess(explain *AccessExplain, now int64) {
+	cfg := getGeoConfig()
+	geo := decideGeoAccess(explain.ApiGroup, explain.IP, "", now)
+	switch geo.rule {
+	case geoRuleNoRule:
+		return
+	case geoRuleExemptIP:
+		explain.Notes = append(explain.Notes, fmt.Sprintf("该 IP 在白名单分组 %s 中，不受地区限制", cfg.exemptGroup))
+	case geoRuleUnknown:
+		explain.Notes = append(explain.Notes, "无法确定该 IP 的国家（内网地址、数据库未收录或未加载），按地区规则的 unknown 配置处理")
+	case geoRuleAllowed:
+		explain.Notes = append(explain.Notes, fmt.Sprintf("该 IP 的国家为 %s，分组 %s 的地区规则允许访问", geo.country, strings.ToLower(explain.ApiGroup)))
+	case geoRuleBlocked:
+		explain.Notes = append(explain.Notes, fmt.Sprintf("该 IP 的国家为 %s，分组 %s 的地区规则不允许访问", geo.country, strings.ToLower(explain.ApiGroup)))
+	}
+	if !geo.allowed {
+		explain.Allowed, explain.Rule, explain.Message = false, limitRuleGeoBlocked, cfg.messages[geoBlockedFallbackLocale]
+		if len(cfg.exemptAccounts) > 0 {
+			explain.Notes = append(explain.Notes, "geoip.exempt_accounts 中的账号携带签名 token（Authorization: Bearer）访问时不受地区限制")
+		}
+	}
+}
+
+// findWhitelistEntry 查找编译为该前缀的未过期条目
+func findWhitelistEntry(entries []WhitelistEntry, prefix netip.Prefix, now int64) (WhitelistEntry, bool) {
+	for _, entry := range entries {
+		if p, err := ipset.ParsePrefix(entry.IP); err == nil && p == prefix && !entry.expired(now) {
+			return entry, true
+		}
+	}
+	return WhitelistEntry{}, false
+}
+
+// describeWhitelistEntry 条目的描述：IP（过期时间、备注、添加人）
+func describeWhitelistEntry(entry WhitelistEntry) string {
+	parts := make([]string, 0, 3)
+	if entry.ExpireAt > 0 {
+		parts = append(parts, "有效至 "+time.Unix(entry.ExpireAt, 0).Format(time.DateTime))
+	} else {
+		parts = append(parts, "永久有效")
+	}
+	if entry.Note != "" {
+		parts = append(parts, "备注: "+entry.Note)
+	}
+	if entry.Operator != "" {
+		parts = append(parts, "添加人: "+entry.Operator)
+	}
+	return entry.IP + "（" + strings.Join(parts, "，") + "）"
+}
+
+// explainNotMatched 分析没有命中的原因：过期条目、格式错误的条目、IPv4/IPv6 不一致
+func explainNotMatched(group string, entries []WhitelistEntry, addr netip.Addr, now int64) []string {
+	notes := make([]string, 0)
+	v4, v6, active := 0, 0, 0
+	for _, entry := range entries {
+		prefix, err := ipset.ParsePrefix(entry.IP)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("条目 %s 格式错误，已忽略", entry.IP))
+			continue
+		}
+		if entry.expired(now) {
+			if prefix.Contains(addr) {
+				notes = append(notes, "包含该 IP 的条目已过期: "+describeWhitelistEntry(entry))
+			}
+			continue
+		}
+		active++
+		if prefix.Addr().Is4() {
+			v4++
+		} else {
+			v6++
+		}
+	}
+
+	switch {
+	case active == 0:
+		notes = append(notes, fmt.Sprintf("分组 %s 的 %d 个条目已全部过期或无效，等同于空列表，不允许任何 IP 访问", group, len(entries)))
+	case addr.Is4() && v4 == 0:
+		notes = append(notes, fmt.Sprintf("客户端是 IPv4 地址，但分组 %s 只有 IPv6 条目", group))
+	case addr.Is6() && v6 == 0:
+		notes = append(notes, fmt.Sprintf("客户端是 IPv6 地址，但分组 %s 只有 IPv4 条目；客户端经 IPv6 访问时需要添加其 IPv6 地址或网段", group))
+	default:
+		notes = append(notes, fmt.Sprintf("分组 %s 有 %d 个生效条目（IPv4 %d / IPv6 %d），都不包含该 IP", group, active, v4, v6))
+	}
+	return notes
+}
@@ -0,0 +1,90 @@
+package request
+
+import (
+	"fmt"
+	"loginServer/src/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 后台管理任务
+// 全表扫描类的管理操作（清理历史、重建索引等）耗时可能远超 HTTP 写超时，
+// 管理接口只负责启动任务并立即返回，进度和结果通过 /loginServer/job/status 查询。
+// 同名任务同一时间只运行一个，任务状态只保存在本实例内存中。
+
+const (
+	AdminJobHistoryCleanup     = "history_cleanup"      // 清理指向已不存在游戏服的历史记录
+	AdminJobPlayerIndexRebuild = "player_index_rebuild" // 按玩家历史全量重建角色索引
+)
+
+// AdminJobStatus 后台任务状态
+type AdminJobStatus struct {
+	Name       string `json:"name"`
+	Running    bool   `json:"running"`
+	StartedAt  int64  `json:"started_at"`  // 最近一次启动时间
+	FinishedAt int64  `json:"finished_at"` // 最近一次结束时间，运行中为 0
+	Count      int    `json:"count"`       // 最近一次处理的记录数
+	Error      string `json:"error"`       // 最近一次失败的原因
+}
+
+var (
+	adminJobMu sync.Mutex
+	adminJobs  = map[string]*AdminJobStatus{}
+)
+
+// startAdminJob 在后台启动任务，fn 返回处理的记录数
+// 同名任务正在运行时不重复启动，返回 false 和正在运行的任务状态
+func startAdminJob(name string, fn func() (int, error)) (AdminJobStatus, bool) {
+	adminJobMu.Lock()
+	defer adminJobMu.Unlock()
+
+	job := adminJobs[name]
+	if job != nil && job.Running {
+		return *job, false
+	}
+	job = &AdminJobStatus{Name: name, Running: true, StartedAt: time.Now().Unix()}
+	adminJobs[name] = job
+
+	go func() {
+		count, err := runAdminJob(fn)
+
+		adminJobMu.Lock()
+		defer adminJobMu.Unlock()
+		job.Running = false
+		job.FinishedAt = time.Now().Unix()
+		job.Count = count
+		if err != nil {
+			job.Error = err.Error()
+			log.Error("后台任务失败, name: %s, count: %d, err: %v", name, count, err)
+			return
+		}
+		log.Info("后台任务完成, name: %s, count: %d", name, count)
+	}()
+	return *job, true
+}
+
+// runAdminJob 执行任务，panic 时转为错误，避免任务状态一直停留在运行中
+func runAdminJob(fn func() (int, error)) (count int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// GetAdminJobStatus 获取后台任务状态，name 为空时返回全部任务（按名称排序）
+func GetAdminJobStatus(name string) []AdminJobStatus {
+	adminJobMu.Lock()
+	defer adminJobMu.Unlock()
+
+	list := make([]AdminJobStatus, 0, len(adminJobs))
+	for jobName, job := range adminJobs {
+		if name == "" || name == jobName {
+			list = append(list, *job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -2,10 +2,14 @@ package request
 
 import (
 	"fmt"
+	"loginServer/pkg/ipset"
 	"loginServer/src/db"
 	"loginServer/src/db/db_mysql"
 	"loginServer/src/log"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -16,12 +20,64 @@ const (
 	CacheKeyServer      = "server"      // 服务器缓存键
 	CacheKeyLoginNotice = "loginNotice" // 登录服公告缓存键
 	CacheKeyWhitelist   = "whitelist"   // IP白名单缓存键前缀
+	CacheKeyServerGroup = "serverGroup" // 服务器显示分组缓存键
 )
 
 var (
 	globalCacheInstance = cache.New(cache.NoExpiration, 0)
 )
 
+// ========== 数据版本号 ==========
+// 服务器列表和公告各自维护一个单调递增的版本号，用于 ETag 协商缓存和增量同步
+
+var (
+	versionMu          sync.Mutex
+	serverListVersion  int64                        // 服务器列表当前版本
+	serverVersionBase  int64                        // 版本追踪起点，早于该版本的增量请求只能全量下发
+	serverVersions     = map[string]int64{}         // 单个服务器 key -> 最后一次变更时的版本
+	serverRemoved      = map[string]RemovedServer{} // 已删除服务器 key -> 删除记录（增量同步时下发给客户端）
+	noticeVersion      int64                        // 公告列表当前版本
+	serverGroupVersion int64                        // 服务器分组元数据当前版本
+)
+
+// nextVersion 生成下一个版本号
+// 取 max(prev+1, 当前毫秒时间戳)，保证单调递增，且进程重启后版本号不会回退
+func nextVersion(prev int64) int64 {
+	now := time.Now().UnixMilli()
+	if now > prev {
+		return now
+	}
+	return prev + 1
+}
+
+// RemovedServer 已从服务器列表删除的服务器
+type RemovedServer struct {
+	ClusterID int64 `json:"cluster_id"`
+	GameID    int64 `json:"game_id"`
+	Version   int64 `json:"-"` // 删除时的版本
+}
+
+// GetServerListVersion 获取服务器列表当前版本号
+func GetServerListVersion() int64 {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	return serverListVersion
+}
+
+// GetServerGroupVersion 获取服务器分组元数据当前版本号
+func GetServerGroupVersion() int64 {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	return serverGroupVersion
+}
+
+// GetNoticeVersion 获取公告列表当前版本号
+func GetNoticeVersion() int64 {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	return noticeVersion
+}
+
 // ========== 基础函数 ==========
 
 // GetFromCacheWithLoader 从缓存获取数据，缓存未命中时使用加载器
@@ -61,8 +117,49 @@ func GetServerList() ([]db_mysql.GameList, error) {
 	return gameList, nil
 }
 
-// UpdateCacheServerList 更新服务器列表缓存
+// GetServerListSnapshot 获取服务器列表及其版本号（同一把锁内读取，保证 ETag 与数据一致）
+func GetServerListSnapshot() ([]db_mysql.GameList, int64, error) {
+	// 确保缓存已加载
+	if _, err := GetServerList(); err != nil {
+		return nil, 0, err
+	}
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	data, _ := globalCacheInstance.Get(CacheKeyServerList)
+	servers, _ := data.([]db_mysql.GameList)
+	return servers, serverListVersion, nil
+}
+
+// GetServer 从缓存获取单个服务器信息
+func GetServer(clusterID, gameID int64) (db_mysql.GameList, bool) {
+	// 确保服务器列表（及单服缓存）已加载
+	if _, err := GetServerList(); err != nil {
+		return db_mysql.GameList{}, false
+	}
+
+	data, exists := globalCacheInstance.Get(genServerKey(clusterID, gameID))
+	if !exists {
+		return db_mysql.GameList{}, false
+	}
+	server, ok := data.(db_mysql.GameList)
+	return server, ok
+}
+
+// UpdateCacheServerList 更新服务器列表缓存，推送状态变化并通知其它实例
+// 配置了 Redis 时更新经频道分发，所有实例（包括本实例）按同一个版本号、按相同顺序合并（见 req_cache_sync.go）；
+// 未配置 Redis 或发布失败时只合并到本实例，版本号由本实例生成
 func UpdateCacheServerList(updates []db_mysql.GameList) {
+	if publishServerListUpdates(updates) {
+		return
+	}
+	if pushChanged := applyServerListUpdates(updates, 0); len(pushChanged) > 0 {
+		publishServerChanges(pushChanged)
+	}
+}
+
+// applyServerListUpdates 将更新合并到服务器列表缓存，返回状态或显示发生变化的服务器
+// version 为共享的版本号（0 表示由本实例生成）；不大于当前版本时（本实例刚从数据库全量加载过）改用本实例生成的版本号，保证单调递增
+func applyServerListUpdates(updates []db_mysql.GameList, version int64) []db_mysql.GameList {
 	var serverKeyList []db_mysql.GameList
 
 	if listData, exists := globalCacheInstance.Get(CacheKeyServerList); exists {
@@ -77,6 +174,8 @@ func UpdateCacheServerList(updates []db_mysql.GameList) {
 	}
 
 	listChanged := false
+	changedKeys := make([]string, 0, len(updates))
+	pushChanged := make([]db_mysql.GameList, 0) // 状态或显示发生变化的服务器（推送给客户端）
 	serverMap := make(map[string]int)
 
 	for i, server := range serverKeyList {
@@ -92,6 +191,8 @@ func UpdateCacheServerList(updates []db_mysql.GameList) {
 			serverInfo, ok := serverData.(db_mysql.GameList)
 			if ok {
 				updatedServer := serverInfo
+				// 下面会原地修改共享的指针字段，先记录旧值
+				oldState, oldIsShow := derefInt(serverInfo.State), derefInt(serverInfo.IsShow)
 
 				if update.Name != nil {
 					if updatedServer.Name == nil {
@@ -157,6 +258,30 @@ func UpdateCacheServerList(updates []db_mysql.GameList) {
 						*updatedServer.Desc = *update.Desc
 					}
 				}
+				if update.Tags != nil {
+					if updatedServer.Tags == nil {
+						tagsCopy := *update.Tags
+						updatedServer.Tags = &tagsCopy
+					} else {
+						*updatedServer.Tags = *update.Tags
+					}
+				}
+				if update.Sort != nil {
+					if updatedServer.Sort == nil {
+						sortCopy := *update.Sort
+						updatedServer.Sort = &sortCopy
+					} else {
+						*updatedServer.Sort = *update.Sort
+					}
+				}
+				if update.GroupID != nil {
+					if updatedServer.GroupID == nil {
+						groupIDCopy := *update.GroupID
+						updatedServer.GroupID = &groupIDCopy
+					} else {
+						*updatedServer.GroupID = *update.GroupID
+					}
+				}
 
 				globalCacheInstance.Set(key, updatedServer, cache.NoExpiration)
 
@@ -167,73 +292,362 @@ func UpdateCacheServerList(updates []db_mysql.GameList) {
 					serverKeyList = append(serverKeyList, updatedServer)
 				}
 				listChanged = true
+				changedKeys = append(changedKeys, key)
+				if derefInt(updatedServer.State) != oldState || derefInt(updatedServer.IsShow) != oldIsShow {
+					pushChanged = append(pushChanged, updatedServer)
+				}
 			}
 		} else {
 			globalCacheInstance.Set(key, update, cache.NoExpiration)
 			serverKeyList = append(serverKeyList, update)
 			listChanged = true
+			changedKeys = append(changedKeys, key)
+			pushChanged = append(pushChanged, update)
 		}
 	}
 
 	if listChanged {
+		// 列表写入与版本递增放在同一把锁内，保证增量查询看到的版本与数据一致
+		versionMu.Lock()
 		globalCacheInstance.Set(CacheKeyServerList, serverKeyList, cache.NoExpiration)
+		if version <= serverListVersion {
+			version = nextVersion(serverListVersion)
+		}
+		serverListVersion = version
+		for _, key := range changedKeys {
+			serverVersions[key] = serverListVersion
+		}
+		versionMu.Unlock()
 	}
+	return pushChanged
 }
 
-// ========== 游戏公告缓存 ==========
+// ReloadServerList 从数据库全量重新加载服务器列表（会重置增量同步的版本起点），并通知其它实例
+func ReloadServerList() {
+	if _, err := loadServerList(); err != nil {
+		log.Error("ReloadServerList: failed to load server list, err:%v", err)
+	}
+	publishCacheSync(cacheSyncMessage{Target: CacheTargetServerList})
+}
+
+// GetServerListDelta 获取指定版本之后发生变更的服务器
+// 返回值：
+//   - version: 当前版本号，客户端下次请求时携带
+//   - full: 为 true 表示无法计算增量（版本过旧或未知），servers 为全量列表
+//   - servers: 变更的服务器（变更后的完整数据）
+//   - removed: 该版本之后被删除的服务器（full 为 true 时为空，客户端整体替换即可）
+func GetServerListDelta(since int64) (version int64, full bool, servers []db_mysql.GameList, removed []RemovedServer, err error) {
+	// 确保缓存已加载
+	if _, err = GetServerList(); err != nil {
+		return 0, false, nil, nil, err
+	}
+
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	list, _ := globalCacheInstance.Get(CacheKeyServerList)
+	all, _ := list.([]db_mysql.GameList)
+
+	// 版本早于追踪起点或超过当前版本（如来自其他实例/重启前），只能全量下发
+	if since < serverVersionBase || since > serverListVersion {
+		result := make([]db_mysql.GameList, len(all))
+		copy(result, all)
+		return serverListVersion, true, result, []RemovedServer{}, nil
+	}
+
+	servers = make([]db_mysql.GameList, 0)
+	for _, server := range all {
+		if serverVersions[genServerKey(server.ClusterID, server.GameID)] > since {
+			servers = append(servers, server)
+		}
+	}
+	removed = make([]RemovedServer, 0)
+	for _, item := range serverRemoved {
+		if item.Version > since {
+			removed = append(removed, item)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].ClusterID != removed[j].ClusterID {
+			return removed[i].ClusterID < removed[j].ClusterID
+		}
+		return removed[i].GameID < removed[j].GameID
+	})
+	return serverListVersion, false, servers, removed, nil
+}
+
+// ========== 服务器分组缓存 ==========
+
+// ServerGroupView 分组视图：分组元数据 + 组内按顺序排列的服务器
+type ServerGroupView struct {
+	db_mysql.ServerGroup
+	Servers []db_mysql.GameList `json:"servers"`
+}
 
-// GetLoginNotice 获取公告
-func GetLoginNotice() ([]db_mysql.LoginNotice, error) {
-	data, err := GetFromCacheWithLoader(CacheKeyLoginNotice, loadLoginNotice)
+// GetServerGroups 获取服务器分组元数据
+func GetServerGroups() ([]db_mysql.ServerGroup, error) {
+	data, err := GetFromCacheWithLoader(CacheKeyServerGroup, loadServerGroups)
 	if err != nil {
 		return nil, err
 	}
 
-	noticeCache, ok := data.([]db_mysql.LoginNotice)
+	groups, ok := data.([]db_mysql.ServerGroup)
 	if !ok {
-		log.Error("GetLoginNoticeList cache data type error")
-		return []db_mysql.LoginNotice{}, nil
-	}
-
-	typeMap := make(map[int]db_mysql.LoginNotice)
-	now := time.Now().Unix()
-	for _, n := range noticeCache {
-		if n.StartTime <= now && n.EndTime > now {
-			notice, exists := typeMap[n.NoticeType]
-			if !exists {
-				typeMap[n.NoticeType] = n
-			} else {
-				// 选取优先级更高的；优先级相同则选 ID 更大的（更“新”）
-				if notice.Priority < n.Priority {
-					typeMap[n.NoticeType] = n
-				} else if notice.Priority == n.Priority && notice.ID < n.ID {
-					typeMap[n.NoticeType] = n
+		log.Error("GetServerGroups: invalid cache data type, got %T", data)
+		return nil, fmt.Errorf("invalid cache data format")
+	}
+	return groups, nil
+}
+
+// UpdateServerGroupCache 从数据库重新加载分组元数据到缓存，并通知其它实例
+func UpdateServerGroupCache() {
+	if _, err := loadServerGroups(); err != nil {
+		log.Error("UpdateServerGroupCache: failed to load server groups, err:%v", err)
+	}
+	publishCacheSync(cacheSyncMessage{Target: CacheTargetServerGroup})
+}
+
+// GetServerListGrouped 按显示分组组织服务器列表
+// 归组规则：
+//  1. 服务器指定了 group_id 且分组存在：归入该分组
+//  2. 否则按分组顺序匹配第一个区服范围（cluster_id + [min_game_id, max_game_id]）包含该服的分组
+//  3. 都不匹配：归入 ID 为 0 的"未分组"，放在最后
+//
+// 不展示（is_show=0）的分组连同归入该分组的服务器一起隐藏
+//
+// 分组按 sort 降序、ID 升序排列；组内服务器按 sort 降序、cluster_id/game_id 升序排列
+//
+// 返回的 version / groupVersion 与分组数据在同一把锁内读取，用于生成 ETag
+func GetServerListGrouped() (views []ServerGroupView, version int64, groupVersion int64, err error) {
+	// 确保缓存已加载
+	if _, err = GetServerList(); err != nil {
+		return nil, 0, 0, err
+	}
+	if _, err = GetServerGroups(); err != nil {
+		return nil, 0, 0, err
+	}
+	versionMu.Lock()
+	serverData, _ := globalCacheInstance.Get(CacheKeyServerList)
+	groupData, _ := globalCacheInstance.Get(CacheKeyServerGroup)
+	version, groupVersion = serverListVersion, serverGroupVersion
+	versionMu.Unlock()
+	servers, _ := serverData.([]db_mysql.GameList)
+	groups, _ := groupData.([]db_mysql.ServerGroup)
+
+	views = make([]ServerGroupView, 0, len(groups)+1)
+	groupIdx := make(map[uint64]int, len(groups))
+	for _, g := range groups {
+		groupIdx[g.ID] = len(views)
+		views = append(views, ServerGroupView{ServerGroup: g, Servers: []db_mysql.GameList{}})
+	}
+	ungrouped := ServerGroupView{Servers: []db_mysql.GameList{}}
+
+	hidden := func(idx int) bool {
+		return idx >= 0 && !views[idx].Visible()
+	}
+	for _, server := range servers {
+		idx, found := -1, false
+		if server.GroupID != nil && *server.GroupID != 0 {
+			idx, found = groupIdx[*server.GroupID]
+		}
+		if !found {
+			for i, g := range groups {
+				if g.MaxGameID <= 0 || (g.ClusterID != 0 && g.ClusterID != server.ClusterID) {
+					continue
+				}
+				if server.GameID >= g.MinGameID && server.GameID <= g.MaxGameID {
+					idx, found = i, true
+					break
 				}
 			}
 		}
+		switch {
+		case found && hidden(idx):
+			// 分组不展示，组内服务器一起隐藏
+		case found:
+			views[idx].Servers = append(views[idx].Servers, server)
+		default:
+			ungrouped.Servers = append(ungrouped.Servers, server)
+		}
 	}
 
-	valid := make([]db_mysql.LoginNotice, 0, len(typeMap))
-	for _, v := range typeMap {
-		valid = append(valid, v)
+	visible := views[:0]
+	for _, view := range views {
+		if view.Visible() {
+			visible = append(visible, view)
+		}
 	}
+	views = visible
 
-	return valid, nil
+	if len(ungrouped.Servers) > 0 {
+		ungrouped.Name = "未分组"
+		views = append(views, ungrouped)
+	}
+	for i := range views {
+		sortServers(views[i].Servers)
+	}
+	return views, version, groupVersion, nil
+}
+
+// sortServers 服务器展示排序：sort 降序，其次 cluster_id、game_id 升序
+func sortServers(servers []db_mysql.GameList) {
+	sort.SliceStable(servers, func(i, j int) bool {
+		si, sj := 0, 0
+		if servers[i].Sort != nil {
+			si = *servers[i].Sort
+		}
+		if servers[j].Sort != nil {
+			sj = *servers[j].Sort
+		}
+		if si != sj {
+			return si > sj
+		}
+		if servers[i].ClusterID != servers[j].ClusterID {
+			return servers[i].ClusterID < servers[j].ClusterID
+		}
+		return servers[i].GameID < servers[j].GameID
+	})
+}
+
+// ========== 游戏公告缓存 ==========
+
+// GetLoginNotice 获取对指定客户端生效的公告
+// 先按定向条件过滤，再按选取策略选取（默认每种类型只保留优先级最高的一条），最后按客户端语言选择翻译
+// 返回的版本号与公告数据在同一把锁内读取，用于生成 ETag
+func GetLoginNotice(attrs NoticeAttrs) ([]db_mysql.LoginNotice, int64, error) {
+	// 确保缓存已加载
+	if _, err := GetFromCacheWithLoader(CacheKeyLoginNotice, loadLoginNotice); err != nil {
+		return nil, 0, err
+	}
+	versionMu.Lock()
+	data, _ := globalCacheInstance.Get(CacheKeyLoginNotice)
+	version := noticeVersion
+	versionMu.Unlock()
+
+	noticeCache, ok := data.([]noticeEntry)
+	if !ok {
+		log.Error("GetLoginNoticeList cache data type error")
+		return []db_mysql.LoginNotice{}, version, nil
+	}
+
+	return selectNotices(noticeCache, attrs, time.Now().Unix()), version, nil
 }
 
 // SetNoticeList 设置公告列表到缓存
 func SetNoticeList(data []db_mysql.LoginNotice) {
-	globalCacheInstance.Set(CacheKeyLoginNotice, data, cache.NoExpiration)
+	entries, err := buildNoticeCache(data)
+	if err != nil {
+		log.Error("SetNoticeList: failed to load notice translations, err:%v", err)
+		return
+	}
+	globalCacheInstance.Set(CacheKeyLoginNotice, entries, cache.NoExpiration)
 }
 
-// UpdateNoticeList 更新缓存
+// UpdateNoticeList 更新缓存，并通知其它实例
 func UpdateNoticeList() {
+	if err := reloadNoticeList(); err != nil {
+		log.Error("UpdateNoticeList: failed to load notice from database, err:%v", err)
+	}
+	publishCacheSync(cacheSyncMessage{Target: CacheTargetNotice})
+}
+
+// reloadNoticeList 从数据库重新加载公告（含翻译）到缓存，已过期的公告会被丢弃
+func reloadNoticeList() error {
 	noticeList, err := db.LoadNotice()
 	if err != nil {
-		log.Error("UpdateNoticeList: failed to load notice from database, err:%v", err)
-		return
+		return err
+	}
+	entries, err := buildNoticeCache(noticeList)
+	if err != nil {
+		return err
+	}
+	fingerprint := fingerprintNotices(entries)
+	versionMu.Lock()
+	globalCacheInstance.Set(CacheKeyLoginNotice, entries, cache.NoExpiration)
+	// 只有内容变化时才递增版本号（后台定期刷新大多数时候内容不变）
+	if fingerprint != noticeFingerprint {
+		noticeFingerprint = fingerprint
+		noticeVersion = nextVersion(noticeVersion)
+	}
+	versionMu.Unlock()
+	wakeNoticeRefresher()
+	return nil
+}
+
+// buildNoticeCache 构建公告缓存条目：预解析定向条件、加载翻译并转换正文格式
+func buildNoticeCache(list []db_mysql.LoginNotice) ([]noticeEntry, error) {
+	loadNoticeSelectPolicy()
+	entries := compileNoticeList(list)
+	if err := attachNoticeTranslations(entries); err != nil {
+		return nil, err
+	}
+	if missing := findMissingTranslations(entries); len(missing) > 0 {
+		log.Warn("公告缺少翻译: %d 条公告, 详情见 /loginServer/loginNotice/i18n/missing", len(missing))
+	}
+	renderNoticeEntries(entries)
+	return entries, nil
+}
+
+// compileNoticeList 预解析公告的定向条件
+// 条件格式错误的公告（如直接修改数据库写入了非法版本号）不会下发，并记录错误日志
+func compileNoticeList(list []db_mysql.LoginNotice) []noticeEntry {
+	entries := make([]noticeEntry, 0, len(list))
+	for _, notice := range list {
+		entry, err := compileNotice(notice)
+		if err != nil {
+			log.Error("compileNotice failed, id: %d, err: %v", notice.ID, err)
+			continue
+		}
+		entries = append(entries, entry)
 	}
-	globalCacheInstance.Set(CacheKeyLoginNotice, noticeList, cache.NoExpiration)
+	return entries
+}
+
+// ========== 手动重新加载 ==========
+
+// 可重新加载的缓存
+const (
+	CacheTargetServerList  = "server_list"
+	CacheTargetServerGroup = "server_group"
+	CacheTargetNotice      = "notice"
+	CacheTargetWhitelist   = "whitelist"
+)
+
+// CacheTargets 全部可重新加载的缓存
+var CacheTargets = []string{CacheTargetServerList, CacheTargetServerGroup, CacheTargetNotice, CacheTargetWhitelist}
+
+// ReloadCaches 从数据库重新加载指定缓存并通知其它实例，返回每个缓存的结果（成功为空字符串，失败为错误信息）
+func ReloadCaches(targets []string) map[string]string {
+	result := make(map[string]string, len(targets))
+	for _, target := range targets {
+		err := reloadCache(target)
+		if err != nil {
+			log.Error("ReloadCaches failed, target: %s, err: %v", target, err)
+			result[target] = err.Error()
+			continue
+		}
+		publishCacheSync(cacheSyncMessage{Target: target})
+		result[target] = ""
+	}
+	return result
+}
+
+// reloadCache 从数据库全量重新加载一个缓存（不通知其它实例）
+func reloadCache(target string) error {
+	var err error
+	switch target {
+	case CacheTargetServerList:
+		_, err = loadServerList()
+	case CacheTargetServerGroup:
+		_, err = loadServerGroups()
+	case CacheTargetNotice:
+		err = reloadNoticeList()
+	case CacheTargetWhitelist:
+		err = ReloadWhitelists()
+	default:
+		err = fmt.Errorf("未知的缓存: %s", target)
+	}
+	return err
 }
 
 // ========== 辅助函数 ==========
@@ -251,16 +665,69 @@ func loadServerList() (any, error) {
 		return nil, err
 	}
 
-	// 将每个服务器单独缓存
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	previous := make(map[string]db_mysql.GameList)
+	if data, exists := globalCacheInstance.Get(CacheKeyServerList); exists {
+		list, _ := data.([]db_mysql.GameList)
+		for _, server := range list {
+			previous[genServerKey(server.ClusterID, server.GameID)] = server
+		}
+	}
+
+	// 首次加载：设置版本追踪起点；之后的全量加载与上次的列表比较，只有变化的服务器递增版本号，
+	// 不在新列表中的服务器记录为已删除，增量同步时下发给客户端
+	version := nextVersion(serverListVersion)
+	first := serverVersionBase == 0
+	if first {
+		serverVersionBase = version
+		serverVersions = make(map[string]int64, len(servers))
+	}
+	changed := first
+	current := make(map[string]bool, len(servers))
 	for _, server := range servers {
 		key := genServerKey(server.ClusterID, server.GameID)
+		current[key] = true
 		globalCacheInstance.Set(key, server, cache.NoExpiration)
+		if old, ok := previous[key]; first || !ok || !reflect.DeepEqual(old, server) {
+			serverVersions[key] = version
+			delete(serverRemoved, key)
+			changed = true
+		}
+	}
+	for key, server := range previous {
+		if current[key] {
+			continue
+		}
+		globalCacheInstance.Delete(key)
+		delete(serverVersions, key)
+		serverRemoved[key] = RemovedServer{ClusterID: server.ClusterID, GameID: server.GameID, Version: version}
+		changed = true
+	}
+	if changed {
+		serverListVersion = version
 	}
 
 	globalCacheInstance.Set(CacheKeyServerList, servers, cache.NoExpiration)
 	return servers, nil
 }
 
+// loadServerGroups 加载服务器分组
+func loadServerGroups() (any, error) {
+	groups, err := db.LoadServerGroups()
+	if err != nil {
+		log.Error("loadServerGroups from database failed, err:%v", err)
+		return nil, err
+	}
+
+	versionMu.Lock()
+	globalCacheInstance.Set(CacheKeyServerGroup, groups, cache.NoExpiration)
+	serverGroupVersion = nextVersion(serverGroupVersion)
+	versionMu.Unlock()
+	return groups, nil
+}
+
 // loadLoginNotice 加载公告
 func loadLoginNotice() (any, error) {
 	noticeList, err := db.LoadNotice()
@@ -268,7 +735,19 @@ func loadLoginNotice() (any, error) {
 		log.Error("loadLoginNotice from database failed, err:%v", err)
 		return nil, err
 	}
-	return noticeList, nil
+	entries, err := buildNoticeCache(noticeList)
+	if err != nil {
+		log.Error("loadLoginNotice translations failed, err:%v", err)
+		return nil, err
+	}
+	versionMu.Lock()
+	// 缓存与版本号在同一把锁内写入，读取方不会拿到新版本号和旧数据
+	globalCacheInstance.Set(CacheKeyLoginNotice, entries, cache.NoExpiration)
+	noticeFingerprint = fingerprintNotices(entries)
+	noticeVersion = nextVersion(noticeVersion)
+	versionMu.Unlock()
+	wakeNoticeRefresher()
+	return entries, nil
 }
 
 // ========== IP白名单缓存 ==========
@@ -278,29 +757,55 @@ func genWhitelistKey(apiGroup string) string {
 	return CacheKeyWhitelist + "_" + strings.ToLower(apiGroup)
 }
 
-// getWhitelistFromCache 从缓存获取指定分组的白名单
-func getWhitelistFromCache(apiGroup string) []string {
-	key := genWhitelistKey(apiGroup)
-	data, exists := globalCacheInstance.Get(key)
+// whitelistGroup 缓存中的一个白名单分组（写入后只读）
+type whitelistGroup struct {
+	entries []WhitelistEntry // 原始条目（查询接口使用）
+	set     *ipset.Set       // 编译后的匹配集合（请求检查使用）
+}
+
+// compileWhitelistGroup 将条目编译为匹配集合，格式错误的条目跳过并记录日志
+func compileWhitelistGroup(apiGroup string, entries []WhitelistEntry) *whitelistGroup {
+	set := ipset.New()
+	for _, entry := range entries {
+		if err := set.AddString(entry.IP, entry.ExpireAt); err != nil {
+			log.Warn("白名单条目格式错误，已跳过: 分组=%s, IP=%s, 错误=%v", apiGroup, entry.IP, err)
+		}
+	}
+	return &whitelistGroup{entries: entries, set: set}
+}
+
+// getWhitelistGroup 从缓存获取指定分组编译后的白名单（只读，不复制），nil 表示分组不存在
+func getWhitelistGroup(apiGroup string) *whitelistGroup {
+	data, exists := globalCacheInstance.Get(genWhitelistKey(apiGroup))
 	if !exists {
 		return nil
 	}
+	group, _ := data.(*whitelistGroup)
+	return group
+}
 
-	ips, ok := data.([]string)
-	if !ok {
+// getWhitelistFromCache 从缓存获取指定分组的白名单条目
+func getWhitelistFromCache(apiGroup string) []WhitelistEntry {
+	group := getWhitelistGroup(apiGroup)
+	if group == nil {
 		return nil
 	}
 
 	// 返回副本，避免外部修改
-	result := make([]string, len(ips))
-	copy(result, ips)
+	result := make([]WhitelistEntry, len(group.entries))
+	copy(result, group.entries)
 	return result
 }
 
-// setWhitelistToCache 设置指定分组的白名单到缓存
-func setWhitelistToCache(apiGroup string, ips []string) {
+// setWhitelistToCache 编译指定分组的白名单并设置到缓存
+func setWhitelistToCache(apiGroup string, entries []WhitelistEntry) {
 	key := genWhitelistKey(apiGroup)
-	globalCacheInstance.Set(key, ips, cache.NoExpiration)
+	globalCacheInstance.Set(key, compileWhitelistGroup(apiGroup, entries), cache.NoExpiration)
+}
+
+// deleteWhitelistFromCache 从缓存删除指定分组（分组不存在表示不限制访问）
+func deleteWhitelistFromCache(apiGroup string) {
+	globalCacheInstance.Delete(genWhitelistKey(apiGroup))
 }
 
 // getAllWhitelistItems 获取所有白名单缓存项（内部使用）
@@ -0,0 +1,270 @@
+package request
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 多实例缓存同步
+// 多个实例部署在负载均衡之后时，后台写入公告/白名单或游戏服上报状态只会更新处理该请求的实例的缓存。
+// 配置了 Redis 时，以下函数更新本实例缓存后通过频道通知其它实例：
+//   - UpdateCacheServerList：消息携带本次更新的服务器，所有实例（包括发布实例）收到后直接合并。
+//     版本号由 Redis 计数器（不小于当前毫秒时间戳，与本地生成的版本号可比较）在发布时原子分配并随消息下发，
+//     频道上的顺序与版本号顺序一致，各实例按相同顺序、以相同版本号合并，客户端在不同实例之间增量同步结果一致；
+//     状态变化的推送由发布实例在合并时发出
+//   - ReloadServerList / UpdateServerGroupCache / UpdateNoticeList / ReloadCaches：其它实例从数据库重新加载
+//   - SetWhitelist / AddIP / RemoveIP：其它实例从数据库重新加载该分组
+//
+// 消息带有发布实例的标识，除服务器列表的增量更新外，实例忽略自己发布的消息。
+// 订阅断开重连后、以及定时任务（cache_sync.resync_cron，见 req_cron.go）中，从数据库全量同步一次，弥补丢失的消息；
+// 全量同步只替换与数据库不一致的缓存，不会让客户端的协商缓存和增量同步无谓失效。
+// 没有配置 Redis 时不发布消息，多个实例之间只通过定时全量同步保持一致。
+
+const (
+	cacheSyncChannel       = "loginServer:cache"                     // 实例间同步缓存的 Redis 频道
+	serverListVersionKey   = "loginServer:cache:server_list_version" // 服务器列表增量更新的共享版本号
+	defaultCacheResyncSpec = "0 */5 * * * *"
+)
+
+// cacheSyncMessage 缓存变更通知
+type cacheSyncMessage struct {
+	Origin  string              `json:"origin"`            // 发布实例
+	Target  string              `json:"target"`            // 缓存（CacheTarget*）
+	Group   string              `json:"group,omitempty"`   // 白名单分组，为空时重新加载全部分组
+	Servers []db_mysql.GameList `json:"servers,omitempty"` // 服务器列表的增量更新，为空时全量重新加载
+	Version int64               `json:"-"`                 // 增量更新的共享版本号（消息前缀 "版本号|"）
+}
+
+var (
+	// cacheSyncOrigin 本实例标识：主机名-进程号-随机数
+	cacheSyncOrigin = newCacheSyncOrigin()
+
+	cacheSyncStop chan struct{}
+	cacheSyncDone chan struct{}
+)
+
+// newCacheSyncOrigin 生成本实例标识
+func newCacheSyncOrigin() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// startCacheSync 配置了 Redis 时订阅缓存同步频道
+func startCacheSync() {
+	if cacheSyncStop != nil || !db.BroadcastEnabled() {
+		return
+	}
+	cacheSyncStop = make(chan struct{})
+	cacheSyncDone = make(chan struct{})
+	go func() {
+		defer close(cacheSyncDone)
+		subscribed := false
+		db.SubscribeMessages(cacheSyncStop, cacheSyncChannel, func() {
+			// 重新订阅：断开期间的通知已丢失，从数据库全量同步
+			if subscribed {
+				log.Warn("缓存同步频道重新订阅，从数据库全量同步缓存")
+				if count, err := resyncCaches(); err != nil {
+					log.Error("缓存全量同步失败（已同步 %d 个）: %v", count, err)
+				}
+			}
+			subscribed = true
+		}, receiveCacheSync)
+	}()
+	log.Info("缓存同步已启动, 实例: %s", cacheSyncOrigin)
+}
+
+// stopCacheSync 停止订阅
+func stopCacheSync() {
+	if cacheSyncStop == nil {
+		return
+	}
+	close(cacheSyncStop)
+	<-cacheSyncDone
+	cacheSyncStop = nil
+}
+
+// publishCacheSync 通知其它实例缓存已变更
+func publishCacheSync(msg cacheSyncMessage) {
+	if !db.BroadcastEnabled() {
+		return
+	}
+	msg.Origin = cacheSyncOrigin
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Error("缓存变更通知序列化失败, target: %s, err: %v", msg.Target, err)
+		return
+	}
+	if err := db.PublishMessage(cacheSyncChannel, payload); err != nil {
+		log.Warn("缓存变更通知发布失败，其它实例将在下次全量同步时更新, target: %s, err: %v", msg.Target, err)
+	}
+}
+
+// publishServerListUpdates 发布服务器列表的增量更新（由所有实例按顺序合并），返回是否发布成功
+func publishServerListUpdates(updates []db_mysql.GameList) bool {
+	if !db.BroadcastEnabled() {
+		return false
+	}
+	payload, err := json.Marshal(cacheSyncMessage{Origin: cacheSyncOrigin, Target: CacheTargetServerList, Servers: updates})
+	if err == nil {
+		_, err = db.PublishSequenced(serverListVersionKey, cacheSyncChannel, payload, time.Now().UnixMilli())
+	}
+	if err != nil {
+		log.Warn("服务器列表更新发布失败，只更新本实例，其它实例将在下次全量同步时更新, err: %v", err)
+		return false
+	}
+	return true
+}
+
+// publishWhitelistSync 通知其它实例重新加载白名单分组
+func publishWhitelistSync(apiGroup string) {
+	publishCacheSync(cacheSyncMessage{Target: CacheTargetWhitelist, Group: apiGroup})
+}
+
+// receiveCacheSync 处理其它实例发布的缓存变更
+func receiveCacheSync(payload string) {
+	var msg cacheSyncMessage
+	body := payload
+	if !strings.HasPrefix(payload, "{") {
+		// 服务器列表的增量更新："版本号|消息"
+		versionText, rest, _ := strings.Cut(payload, "|")
+		msg.Version, _ = strconv.ParseInt(versionText, 10, 64)
+		body = rest
+	}
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		log.Warn("缓存同步频道收到无效消息: %s", payload)
+		return
+	}
+	own := msg.Origin == cacheSyncOrigin
+	if own && msg.Target != CacheTargetServerList {
+		return
+	}
+
+	var err error
+	switch {
+	case msg.Target == CacheTargetServerList && len(msg.Servers) > 0:
+		// 本实例还没有加载服务器列表时不需要合并，首次读取时会从数据库加载
+		if _, loaded := globalCacheInstance.Get(CacheKeyServerList); loaded {
+			if pushChanged := applyServerListUpdates(msg.Servers, msg.Version); own && len(pushChanged) > 0 {
+				publishServerChanges(pushChanged)
+			}
+		}
+	case own:
+		// 本实例发布的全量重新加载通知，本实例已处理
+	case msg.Target == CacheTargetWhitelist && msg.Group != "":
+		err = reloadWhitelistGroup(msg.Group)
+	default:
+		err = reloadCache(msg.Target)
+	}
+	if err != nil {
+		log.Error("同步其它实例的缓存变更失败, target: %s, group: %s, origin: %s, err: %v", msg.Target, msg.Group, msg.Origin, err)
+	}
+}
+
+// resyncCaches 从数据库全量同步缓存（定时任务和重新订阅时调用），只替换与数据库不一致的缓存，返回替换的缓存数
+func resyncCaches() (int, error) {
+	count := 0
+	var errs []error
+	for _, resync := range []struct {
+		target string
+		fn     func() (bool, error)
+	}{
+		{CacheTargetServerList, resyncServerList},
+		{CacheTargetServerGroup, resyncServerGroups},
+		{CacheTargetNotice, resyncNotices},
+		{CacheTargetWhitelist, resyncWhitelists},
+	} {
+		changed, err := resync.fn()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", resync.target, err))
+			continue
+		}
+		if changed {
+			log.Warn("缓存与数据库不一致，已重新加载: %s", resync.target)
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// resyncServerList 服务器列表与数据库不一致时全量重新加载（未加载时不处理）
+func resyncServerList() (bool, error) {
+	cached, loaded := globalCacheInstance.Get(CacheKeyServerList)
+	if !loaded {
+		return false, nil
+	}
+	servers, err := db.GetServerList()
+	if err != nil {
+		return false, err
+	}
+
+	list, _ := cached.([]db_mysql.GameList)
+	current := make(map[string]db_mysql.GameList, len(list))
+	for _, server := range list {
+		current[genServerKey(server.ClusterID, server.GameID)] = server
+	}
+	same := len(current) == len(servers)
+	for i := 0; same && i < len(servers); i++ {
+		server, ok := current[genServerKey(servers[i].ClusterID, servers[i].GameID)]
+		same = ok && reflect.DeepEqual(server, servers[i])
+	}
+	if same {
+		return false, nil
+	}
+	_, err = loadServerList()
+	return err == nil, err
+}
+
+// resyncServerGroups 分组元数据与数据库不一致时重新加载（未加载时不处理）
+func resyncServerGroups() (bool, error) {
+	cached, loaded := globalCacheInstance.Get(CacheKeyServerGroup)
+	if !loaded {
+		return false, nil
+	}
+	groups, err := db.LoadServerGroups()
+	if err != nil {
+		return false, err
+	}
+	if reflect.DeepEqual(cached, groups) {
+		return false, nil
+	}
+	_, err = loadServerGroups()
+	return err == nil, err
+}
+
+// resyncNotices 重新加载公告（内容不变时不递增版本号）
+func resyncNotices() (bool, error) {
+	if _, loaded := globalCacheInstance.Get(CacheKeyLoginNotice); !loaded {
+		return false, nil
+	}
+	version := GetNoticeVersion()
+	if err := reloadNoticeList(); err != nil {
+		return false, err
+	}
+	return GetNoticeVersion() != version, nil
+}
+
+// resyncWhitelists 按"分组来源"规则只替换与数据库不一致的白名单分组，并删除已不存在的分组
+// 与启动和重新加载使用同一规则：配置文件中的分组（数据库中没有时）保持配置的条目，不会变为空列表
+func resyncWhitelists() (bool, error) {
+	groupMap, err := loadAllWhitelistGroups()
+	if err != nil {
+		return false, err
+	}
+	return applyWhitelistGroups(groupMap), nil
+}
@@ -0,0 +1,260 @@
+package request
+
+import (
+	"fmt"
+	"loginServer/config"
+	"loginServer/pkg/ipset"
+	"loginServer/src/log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 客户端真实 IP 解析
+// 只有直接连接的对端（负载均衡/反向代理）在 trusted_proxy.cidrs 中时才读取转发头，
+// 否则任何调用方都可以通过伪造 X-Forwarded-For 绕过白名单。
+// 转发头从右向左遍历（右边是离本服务最近的代理追加的），跳过可信代理，第一个非可信地址即为客户端 IP；
+// 全部为可信代理时取最左边的地址。
+// 每个请求在中间件中解析一次并保存在上下文中，白名单、访问日志、审计记录等统一通过 getClientIP 获取。
+//
+// 配置项（config.json）：
+//
+//	"trusted_proxy": {
+//	    "cidrs": ["10.0.0.0/8", "127.0.0.1"], // 可信代理地址，为空时不读取任何转发头
+//	    "header": "x-forwarded-for",          // 读取的转发头：x-forwarded-for / forwarded（RFC 7239）/ x-real-ip
+//	    "proxy_protocol": false,              // 监听端口启用 PROXY protocol（v1/v2），只解析可信代理发来的头部
+//	    "proxy_protocol_timeout_ms": 3000     // 读取 PROXY 头的超时
+//	}
+
+// 转发头类型
+const (
+	ForwardHeaderXFF       = "x-forwarded-for"
+	ForwardHeaderForwarded = "forwarded"
+	ForwardHeaderXRealIP   = "x-real-ip"
+)
+
+// ctxKeyClientIP 上下文中保存解析后客户端 IP 的 key
+const ctxKeyClientIP = "client_ip"
+
+const defaultProxyProtocolTimeout = 3 * time.Second
+
+// trustedProxyConfig 可信代理配置（启动时加载）
+type trustedProxyConfig struct {
+	prefixes []netip.Prefix
+	header   string
+}
+
+var trustedProxies atomic.Pointer[trustedProxyConfig]
+
+// loadTrustedProxies 加载可信代理配置，格式错误的地址跳过并记录日志
+func loadTrustedProxies() {
+	cfg := &trustedProxyConfig{header: strings.ToLower(strings.TrimSpace(config.Config.GetString("trusted_proxy.header")))}
+	switch cfg.header {
+	case "":
+		cfg.header = ForwardHeaderXFF
+	case ForwardHeaderXFF, ForwardHeaderForwarded, ForwardHeaderXRealIP:
+	default:
+		log.Error("trusted_proxy.header 不支持: %s，使用 %s", cfg.header, ForwardHeaderXFF)
+		cfg.header = ForwardHeaderXFF
+	}
+
+	for _, item := range config.Config.GetStringSlice("trusted_proxy.cidrs") {
+		prefix, err := ipset.ParsePrefix(item)
+		if err != nil {
+			log.Error("trusted_proxy.cidrs 格式错误，已跳过: %s", item)
+			continue
+		}
+		cfg.prefixes = append(cfg.prefixes, prefix)
+	}
+	trustedProxies.Store(cfg)
+	log.Info("可信代理: %d 个地址段，转发头: %s", len(cfg.prefixes), cfg.header)
+}
+
+// getTrustedProxies 当前的可信代理配置（未加载时不信任任何代理）
+func getTrustedProxies() *trustedProxyConfig {
+	if cfg := trustedProxies.Load(); cfg != nil {
+		return cfg
+	}
+	return &trustedProxyConfig{header: ForwardHeaderXFF}
+}
+
+// isTrustedProxy 地址是否为可信代理
+func isTrustedProxy(addr netip.Addr) bool {
+	return getTrustedProxies().trusted(addr)
+}
+
+func (cfg *trustedProxyConfig) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range cfg.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getClientIP 获取客户端真实IP地址（中间件中已解析时直接返回）
+func getClientIP(c *gin.Context) string {
+	if ip := c.GetString(ctxKeyClientIP); ip != "" {
+		return ip
+	}
+	addr := resolveClientIP(c.Request)
+	if !addr.IsValid() {
+		return ""
+	}
+	ip := addr.String()
+	c.Set(ctxKeyClientIP, ip)
+	return ip
+}
+
+// resolveClientIP 解析客户端真实 IP
+// 对端不是可信代理时直接使用对端地址；否则按配置的转发头解析，转发头缺失或无效时使用对端地址
+func resolveClientIP(r *http.Request) netip.Addr {
+	peer := remoteAddr(r.RemoteAddr)
+	cfg := getTrustedProxies()
+	if !peer.IsValid() || !cfg.trusted(peer) {
+		return peer
+	}
+
+	var hops []netip.Addr
+	switch cfg.header {
+	case ForwardHeaderForwarded:
+		hops = parseForwarded(r.Header.Values("Forwarded"))
+	case ForwardHeaderXRealIP:
+		if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return addr.Unmap()
+		}
+		return peer
+	default:
+		hops = parseXForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+	return pickClientHop(hops, peer, cfg)
+}
+
+// pickClientHop 从右向左跳过可信代理，返回第一个非可信地址
+// 遇到无法解析的地址（如 Forwarded 中的 unknown / 混淆标识）时停止，使用它右边最近的可信代理
+func pickClientHop(hops []netip.Addr, peer netip.Addr, cfg *trustedProxyConfig) netip.Addr {
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !hops[i].IsValid() {
+			return client
+		}
+		client = hops[i]
+		if !cfg.trusted(client) {
+			return client
+		}
+	}
+	return client
+}
+
+// parseXForwardedFor 解析 X-Forwarded-For（可能有多个请求头，按出现顺序拼接）
+func parseXForwardedFor(values []string) []netip.Addr {
+	hops := make([]netip.Addr, 0)
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			hops = append(hops, parseHopAddr(item))
+		}
+	}
+	return hops
+}
+
+// parseForwarded 解析 RFC 7239 Forwarded 头中各节点的 for= 参数
+// Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+func parseForwarded(values []string) []netip.Addr {
+	hops := make([]netip.Addr, 0)
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			hop := netip.Addr{}
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					hop = parseHopAddr(val)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// splitQuoted 按分隔符拆分，忽略引号内的分隔符
+func splitQuoted(value string, sep byte) []string {
+	parts := make([]string, 0)
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '"':
+			quoted = !quoted
+		case value[i] == sep && !quoted:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// parseHopAddr 解析转发头中的单个地址，支持引号、端口和 [IPv6]:port 形式；无效时返回零值
+func parseHopAddr(value string) netip.Addr {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap()
+	}
+	return netip.Addr{}
+}
+
+// remoteAddr 解析连接的对端地址（启用 PROXY protocol 时为头部中的客户端地址）
+func remoteAddr(addr string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(addr); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, _ := netip.ParseAddr(host)
+	return ip.Unmap()
+}
+
+// proxyProtocolTimeout 读取 PROXY 头的超时
+func proxyProtocolTimeout() time.Duration {
+	if ms := config.Config.GetInt("trusted_proxy.proxy_protocol_timeout_ms"); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultProxyProtocolTimeout
+}
+
+// accessLogFormatter 访问日志格式（与 gin 默认格式一致，客户端 IP 使用解析后的地址）
+func accessLogFormatter(param gin.LogFormatterParams) string {
+	if ip, ok := param.Keys[ctxKeyClientIP].(string); ok && ip != "" {
+		param.ClientIP = ip
+	}
+
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		param.Path,
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,108 @@
+package request
+
+import (
+	"loginServer/config"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"sync"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 后台定时任务（cron 表达式带秒字段）
+//
+// 配置项（config.json）：
+//
+//	"player_history": {
+//	    "cleanup_cron": "0 30 4 * * *"  // 清理指向已不存在游戏服的历史记录，默认每天 04:30:00
+//	},
+//	"privacy": {
+//	    "erasure_cron": "0 */10 * * * *" // 执行冷静期已结束的账号数据删除申请，默认每 10 分钟
+//	},
+//	"whitelist": {
+//	    "purge_cron": "0 * * * * *"      // 删除已过期的白名单条目，默认每分钟
+//	},
+//	"denylist": {
+//	    "purge_cron": "0 */5 * * * *"    // 删除已过期的手动黑名单条目，默认每 5 分钟
+//	},
+//	"cache_sync": {
+//	    "resync_cron": "0 */5 * * * *"   // 从数据库全量同步缓存（弥补丢失的实例间通知），默认每 5 分钟
+//	}
+
+const (
+	defaultHistoryCleanupSpec = "0 30 4 * * *"
+)
+
+var (
+	cronMu  sync.Mutex
+	cronJob *cron.Cron
+)
+
+// startCronJobs 启动后台定时任务
+func startCronJobs() {
+	cronMu.Lock()
+	defer cronMu.Unlock()
+	if cronJob != nil {
+		return
+	}
+
+	c := cron.New(cron.WithSeconds())
+
+	addCronJob(c, "player_history.cleanup_cron", defaultHistoryCleanupSpec, "玩家历史清理任务", cleanupStaleHistory)
+	addCronJob(c, "privacy.erasure_cron", defaultErasureSpec, "账号数据删除任务", runDueErasures)
+	addCronJob(c, "whitelist.purge_cron", defaultWhitelistPurgeSpec, "过期白名单清理任务", purgeExpiredWhitelists)
+	addCronJob(c, "denylist.purge_cron", defaultDenylistPurge, "过期黑名单清理任务", purgeExpiredDenylist)
+	addCronJob(c, "cache_sync.resync_cron", defaultCacheResyncSpec, "缓存全量同步任务", resyncCaches)
+
+	c.Start()
+	cronJob = c
+}
+
+// addCronJob 按配置注册一个定时任务，fn 返回处理的记录数
+func addCronJob(c *cron.Cron, specKey, defaultSpec, name string, fn func() (int, error)) {
+	spec := config.Config.GetString(specKey)
+	if spec == "" {
+		spec = defaultSpec
+	}
+	if _, err := c.AddFunc(spec, func() {
+		count, err := fn()
+		if err != nil {
+			log.Error("%s失败: %v", name, err)
+			return
+		}
+		log.Info("%s完成, 处理记录数: %d", name, count)
+	}); err != nil {
+		log.Error("%s注册失败, spec: %s, err: %v", name, spec, err)
+	}
+}
+
+// stopCronJobs 停止后台定时任务，等待正在执行的任务结束
+func stopCronJobs() {
+	cronMu.Lock()
+	defer cronMu.Unlock()
+	if cronJob == nil {
+		return
+	}
+	<-cronJob.Stop().Done()
+	cronJob = nil
+}
+
+// cleanupStaleHistory 清理玩家历史中指向已不存在游戏服的记录
+// 以数据库中的 game_list 为准；服务器列表为空时不执行，避免数据库异常时误删全部记录
+func cleanupStaleHistory() (int, error) {
+	servers, err := db.GetServerList()
+	if err != nil {
+		return 0, err
+	}
+	if len(servers) == 0 {
+		log.Warn("cleanupStaleHistory: game_list 为空，跳过清理")
+		return 0, nil
+	}
+
+	validServers := make(map[db_mysql.ServerKey]bool, len(servers))
+	for _, server := range servers {
+		validServers[db_mysql.ServerKey{ClusterID: server.ClusterID, GameID: server.GameID}] = true
+	}
+	return db.CleanupHistoryByServers(validServers)
+}
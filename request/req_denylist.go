@@ -0,0 +1,554 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginServer/config"
+	"loginServer/pkg/ipset"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IP 黑名单
+// 对所有路由生效（包括 out 分组和未注册的路径），在白名单检查之前执行。黑名单分两类：
+//   - 手动条目：通过后台接口添加，保存在 MySQL，支持 IP / CIDR 和过期时间
+//   - 自动封禁：同一 IP 一分钟内的 4xx 响应、登录失败或签名校验失败次数达到阈值时临时封禁
+//
+// 本服务不处理登录和签名，登录失败和签名校验失败由游戏服通过 /loginServer/reportAbuse 上报。
+// 配置了 Redis 时，滥用计数和自动封禁保存在 Redis 中，并通过频道通知所有实例；否则只在本实例生效。
+// 可信代理和 denylist.exempt_cidrs 中的地址不会被自动封禁（手动条目仍然生效）。
+//
+// 配置项（config.json）：
+//
+//	"denylist": {
+//	    "auto_ban_sec": 600,              // 自动封禁时长（秒）
+//	    "max_4xx_per_min": 300,           // 每分钟 4xx 响应次数阈值，0 或负数表示不按此项封禁
+//	    "max_login_fail_per_min": 30,     // 每分钟登录失败次数阈值
+//	    "max_sign_fail_per_min": 30,      // 每分钟签名校验失败次数阈值
+//	    "exempt_cidrs": ["10.0.0.0/8"]    // 不自动封禁的地址
+//	}
+//
+// 已过期的手动条目立即不再生效，由定时任务（denylist.purge_cron，见 req_cron.go）从数据库删除。
+
+// 滥用类型
+const (
+	Abuse4xx       = "4xx"
+	AbuseLoginFail = "login_fail"
+	AbuseSignFail  = "sign_fail"
+)
+
+const (
+	defaultAutoBanSec       = 600
+	defaultMax4xxPerMin     = 300
+	defaultMaxLoginFail     = 30
+	defaultMaxSignFail      = 30
+	defaultDenylistPurge    = "0 */5 * * * *"
+	maxLocalAbuseCounters   = 100000 // 本实例计数器数量上限，超过后不再为新地址计数
+	denylistPruneInterval   = time.Minute
+	abuseWindow             = time.Minute
+	denylistChannel         = "loginServer:denylist"      // 实例间同步黑名单的 Redis 频道
+	denylistBansKey         = "loginServer:denylist:bans" // 自动封禁（ip -> DenyBan）
+	abuseCounterKeyTemplate = "loginServer:abuse:%s:%s:%d"
+)
+
+// DenyBan 自动封禁
+type DenyBan struct {
+	IP        string `json:"ip"`
+	Reason    string `json:"reason"`
+	ExpireAt  int64  `json:"expire_at"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// denylistMessage 实例间同步消息
+type denylistMessage struct {
+	Op  string  `json:"op"` // ban / unban / clear / reload
+	Ban DenyBan `json:"ban"`
+}
+
+// denylistManual 编译后的手动条目（写入后只读）
+type denylistManual struct {
+	entries []db_mysql.IPDenylist
+	set     *ipset.Set
+}
+
+// abuseCounter 本实例的滥用计数（Redis 不可用时使用）
+type abuseCounter struct {
+	window int64
+	count  int64
+}
+
+// denylistConfig 黑名单配置（启动时加载）
+type denylistConfig struct {
+	autoBanSec int64
+	thresholds map[string]int64
+	exempt     *ipset.Set
+}
+
+var (
+	denyManual atomic.Pointer[denylistManual]
+	denyConfig atomic.Pointer[denylistConfig]
+
+	denyMu       sync.RWMutex
+	denyBans     = make(map[netip.Addr]DenyBan)
+	denyCounters = make(map[string]*abuseCounter)
+
+	denyStop chan struct{}
+	denyDone chan struct{}
+)
+
+// loadDenylistConfig 加载黑名单配置
+func loadDenylistConfig() {
+	threshold := func(key string, def int64) int64 {
+		if !config.Config.IsSet(key) {
+			return def
+		}
+		return config.Config.GetInt64(key)
+	}
+	cfg := &denylistConfig{
+		autoBanSec: int64(configIntDefault("denylist.auto_ban_sec", defaultAutoBanSec)),
+		thresholds: map[string]int64{
+			Abuse4xx:       threshold("denylist.max_4xx_per_min", defaultMax4xxPerMin),
+			AbuseLoginFail: threshold("denylist.max_login_fail_per_min", defaultMaxLoginFail),
+			AbuseSignFail:  threshold("denylist.max_sign_fail_per_min", defaultMaxSignFail),
+		},
+		exempt: ipset.New(),
+	}
+	for _, item := range config.Config.GetStringSlice("denylist.exempt_cidrs") {
+		if err := cfg.exempt.AddString(item, 0); err != nil {
+			log.Error("denylist.exempt_cidrs 格式错误，已跳过: %s", item)
+		}
+	}
+	denyConfig.Store(cfg)
+}
+
+// getDenylistConfig 当前的黑名单配置
+func getDenylistConfig() *denylistConfig {
+	if cfg := denyConfig.Load(); cfg != nil {
+		return cfg
+	}
+	loadDenylistConfig()
+	return denyConfig.Load()
+}
+
+// startDenylist 加载黑名单，配置了 Redis 时订阅实例间的同步频道
+func startDenylist() {
+	if denyStop != nil {
+		return
+	}
+	loadDenylistConfig()
+	if err := ReloadDenylist(); err != nil {
+		log.Error("加载IP黑名单失败: %v", err)
+	}
+	loadSharedBans()
+
+	denyStop = make(chan struct{})
+	denyDone = make(chan struct{})
+	go func() {
+		defer close(denyDone)
+		ticker := time.NewTicker(denylistPruneInterval)
+		defer ticker.Stop()
+
+		if db.BroadcastEnabled() {
+			subscribed := make(chan struct{})
+			go func() {
+				defer close(subscribed)
+				first := true
+				db.SubscribeMessages(denyStop, denylistChannel, func() {
+					// 重新订阅：断开期间的变更已丢失，重新加载
+					if !first {
+						log.Warn("黑名单频道重新订阅，重新加载黑名单")
+						if err := ReloadDenylist(); err != nil {
+							log.Error("重新加载IP黑名单失败: %v", err)
+						}
+						loadSharedBans()
+					}
+					first = false
+				}, receiveDenylistMessage)
+			}()
+			defer func() { <-subscribed }()
+		}
+
+		for {
+			select {
+			case <-denyStop:
+				return
+			case <-ticker.C:
+				pruneDenylist(time.Now().Unix())
+			}
+		}
+	}()
+}
+
+// stopDenylist 停止后台同步
+func stopDenylist() {
+	if denyStop == nil {
+		return
+	}
+	close(denyStop)
+	<-denyDone
+	denyStop = nil
+}
+
+// ReloadDenylist 从数据库重新加载手动条目
+func ReloadDenylist() error {
+	entries, err := db.LoadDenylist()
+	if err != nil {
+		return err
+	}
+	set := ipset.New()
+	for _, entry := range entries {
+		if err := set.AddString(entry.IP, entry.ExpireAt); err != nil {
+			log.Warn("黑名单条目格式错误，已跳过: IP=%s, 错误=%v", entry.IP, err)
+		}
+	}
+	denyManual.Store(&denylistManual{entries: entries, set: set})
+	return nil
+}
+
+// loadSharedBans 从 Redis 加载自动封禁并合并到本实例（删除已过期的记录）
+func loadSharedBans() {
+	if !db.BroadcastEnabled() {
+		return
+	}
+	items, err := db.LoadSharedBans(denylistBansKey)
+	if err != nil {
+		log.Warn("从 Redis 加载自动封禁失败: %v", err)
+		return
+	}
+	now := time.Now().Unix()
+	expired := make([]string, 0)
+	denyMu.Lock()
+	for field, payload := range items {
+		var ban DenyBan
+		addr, err := netip.ParseAddr(field)
+		if err != nil || json.Unmarshal([]byte(payload), &ban) != nil || ban.ExpireAt <= now {
+			expired = append(expired, field)
+			continue
+		}
+		denyBans[addr] = ban
+	}
+	denyMu.Unlock()
+	if len(expired) > 0 {
+		_ = db.DeleteSharedBans(denylistBansKey, expired...)
+	}
+}
+
+// publishDenylist 通知其它实例
+func publishDenylist(msg denylistMessage) {
+	if !db.BroadcastEnabled() {
+		return
+	}
+	payload, _ := json.Marshal(msg)
+	if err := db.PublishMessage(denylistChannel, payload); err != nil {
+		log.Warn("黑名单变更通知发布失败, op: %s, err: %v", msg.Op, err)
+	}
+}
+
+// receiveDenylistMessage 处理其它实例（包括本实例）发布的变更
+func receiveDenylistMessage(payload string) {
+	var msg denylistMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		log.Warn("黑名单频道收到无效消息: %s", payload)
+		return
+	}
+	switch msg.Op {
+	case "ban":
+		if addr, err := netip.ParseAddr(msg.Ban.IP); err == nil {
+			denyMu.Lock()
+			denyBans[addr] = msg.Ban
+			denyMu.Unlock()
+		}
+	case "unban":
+		if addr, err := netip.ParseAddr(msg.Ban.IP); err == nil {
+			denyMu.Lock()
+			delete(denyBans, addr)
+			denyMu.Unlock()
+		}
+	case "clear":
+		denyMu.Lock()
+		clear(denyBans)
+		denyMu.Unlock()
+	case "reload":
+		if err := ReloadDenylist(); err != nil {
+			log.Error("重新加载IP黑名单失败: %v", err)
+		}
+	}
+}
+
+// pruneDenylist 删除本实例已过期的自动封禁和过期的计数器
+func pruneDenylist(now int64) {
+	window := now / int64(abuseWindow/time.Second)
+	denyMu.Lock()
+	defer denyMu.Unlock()
+	for addr, ban := range denyBans {
+		if ban.ExpireAt <= now {
+			delete(denyBans, addr)
+		}
+	}
+	for key, counter := range denyCounters {
+		if counter.window < window {
+			delete(denyCounters, key)
+		}
+	}
+}
+
+// checkDenylist 检查 IP 是否被封禁，返回提示信息和自动封禁的剩余秒数（手动条目为 0）
+func checkDenylist(clientIP string) (bool, string, int64) {
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return false, "", 0
+	}
+	addr = addr.Unmap()
+	now := time.Now().Unix()
+
+	if manual := denyManual.Load(); manual != nil && manual.set.Contains(addr, now) {
+		return true, "IP已被封禁", 0
+	}
+
+	denyMu.RLock()
+	ban, ok := denyBans[addr]
+	denyMu.RUnlock()
+	if ok && ban.ExpireAt > now {
+		return true, "请求过于频繁，IP已被临时封禁", ban.ExpireAt - now
+	}
+	return false, "", 0
+}
+
+// isAbuseExempt 地址是否不参与自动封禁
+func isAbuseExempt(addr netip.Addr) bool {
+	return isTrustedProxy(addr) || getDenylistConfig().exempt.Contains(addr, 0)
+}
+
+// recordAbuse 记录一次（或 n 次）滥用行为，一分钟内达到阈值时自动封禁
+func recordAbuse(clientIP string, kind string, n int64) {
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil || n <= 0 {
+		return
+	}
+	addr = addr.Unmap()
+	cfg := getDenylistConfig()
+	limit := cfg.thresholds[kind]
+	if limit <= 0 || isAbuseExempt(addr) {
+		return
+	}
+
+	// 已封禁时不再计数
+	now := time.Now().Unix()
+	denyMu.RLock()
+	ban, banned := denyBans[addr]
+	denyMu.RUnlock()
+	if banned && ban.ExpireAt > now {
+		return
+	}
+
+	count := countAbuse(addr.String(), kind, n, now)
+	if count >= limit {
+		// 封禁后计数清零，解除封禁后重新计数
+		resetAbuse(addr.String(), kind, now)
+		reason := fmt.Sprintf("%s 每分钟 %d 次（阈值 %d）", kind, count, limit)
+		banIP(addr, reason, now+cfg.autoBanSec)
+	}
+}
+
+// resetAbuse 清零当前分钟的计数
+func resetAbuse(ip, kind string, now int64) {
+	window := now / int64(abuseWindow/time.Second)
+	if db.BroadcastEnabled() {
+		db.ResetCounters(fmt.Sprintf(abuseCounterKeyTemplate, kind, ip, window))
+	}
+	denyMu.Lock()
+	delete(denyCounters, kind+"|"+ip)
+	denyMu.Unlock()
+}
+
+// countAbuse 累加当前分钟的计数，优先使用 Redis（多实例合计），Redis 不可用时使用本实例计数
+func countAbuse(ip, kind string, n, now int64) int64 {
+	window := now / int64(abuseWindow/time.Second)
+	if db.BroadcastEnabled() {
+		key := fmt.Sprintf(abuseCounterKeyTemplate, kind, ip, window)
+		if count, err := db.CountInWindow(key, n, 2*abuseWindow); err == nil {
+			return count
+		}
+	}
+
+	key := kind + "|" + ip
+	denyMu.Lock()
+	defer denyMu.Unlock()
+	counter, ok := denyCounters[key]
+	if !ok {
+		if len(denyCounters) >= maxLocalAbuseCounters {
+			return 0
+		}
+		counter = &abuseCounter{window: window}
+		denyCounters[key] = counter
+	}
+	if counter.window != window {
+		counter.window = window
+		counter.count = 0
+	}
+	counter.count += n
+	return counter.count
+}
+
+// banIP 自动封禁，保存到 Redis 并通知其它实例
+func banIP(addr netip.Addr, reason string, expireAt int64) {
+	ban := DenyBan{IP: addr.String(), Reason: reason, ExpireAt: expireAt, CreatedAt: time.Now().Unix()}
+	denyMu.Lock()
+	denyBans[addr] = ban
+	denyMu.Unlock()
+	log.Warn("IP已被自动封禁: %s, 原因: %s, 截止: %s", ban.IP, reason, time.Unix(expireAt, 0).Format(time.DateTime))
+
+	if db.BroadcastEnabled() {
+		payload, _ := json.Marshal(ban)
+		if err := db.SaveSharedBan(denylistBansKey, ban.IP, payload); err != nil {
+			log.Warn("自动封禁保存到 Redis 失败: %s, err: %v", ban.IP, err)
+		}
+		publishDenylist(denylistMessage{Op: "ban", Ban: ban})
+	}
+}
+
+// unbanIP 解除自动封禁，返回本实例是否存在该封禁
+func unbanIP(addr netip.Addr) bool {
+	denyMu.Lock()
+	_, ok := denyBans[addr]
+	delete(denyBans, addr)
+	denyMu.Unlock()
+
+	if db.BroadcastEnabled() {
+		if err := db.DeleteSharedBans(denylistBansKey, addr.String()); err != nil {
+			log.Warn("从 Redis 删除自动封禁失败: %s, err: %v", addr, err)
+		}
+		publishDenylist(denylistMessage{Op: "unban", Ban: DenyBan{IP: addr.String()}})
+	}
+	return ok
+}
+
+// ClearAutoBans 解除全部自动封禁，返回本实例解除的数量
+func ClearAutoBans() int {
+	denyMu.Lock()
+	fields := make([]string, 0, len(denyBans))
+	for addr := range denyBans {
+		fields = append(fields, addr.String())
+	}
+	clear(denyBans)
+	denyMu.Unlock()
+
+	if db.BroadcastEnabled() {
+		if items, err := db.LoadSharedBans(denylistBansKey); err == nil {
+			for field := range items {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			if err := db.DeleteSharedBans(denylistBansKey, fields...); err != nil {
+				log.Warn("从 Redis 删除自动封禁失败: %v", err)
+			}
+		}
+		publishDenylist(denylistMessage{Op: "clear"})
+	}
+	return len(fields)
+}
+
+// normalizeDenyIP 解析并规范化 IP / CIDR（单个 IP 不带前缀长度）
+func normalizeDenyIP(value string) (netip.Prefix, string, error) {
+	prefix, err := ipset.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, "", fmt.Errorf("无效的IP地址: %s", value)
+	}
+	if prefix.IsSingleIP() {
+		return prefix, prefix.Addr().String(), nil
+	}
+	return prefix, prefix.String(), nil
+}
+
+// AddDenyIP 添加手动黑名单条目（已存在时更新），expireAt 为 0 表示永不过期
+func AddDenyIP(ip, reason string, expireAt int64, operator string) error {
+	if expireAt < 0 || (expireAt > 0 && expireAt <= time.Now().Unix()) {
+		return errors.New("过期时间必须晚于当前时间")
+	}
+	_, normalized, err := normalizeDenyIP(ip)
+	if err != nil {
+		return err
+	}
+	entry := db_mysql.IPDenylist{IP: normalized, Reason: reason, ExpireAt: expireAt, Operator: operator}
+	if err := db.AddDenylistIP(entry); err != nil {
+		return fmt.Errorf("添加黑名单到数据库失败: %w", err)
+	}
+	if err := ReloadDenylist(); err != nil {
+		return fmt.Errorf("刷新黑名单缓存失败: %w", err)
+	}
+	publishDenylist(denylistMessage{Op: "reload"})
+	log.Info("添加IP黑名单: %s, 原因: %s, 过期时间: %d, 操作人: %s", normalized, reason, expireAt, operator)
+	return nil
+}
+
+// RemoveDenyIP 删除手动黑名单条目并解除该 IP 的自动封禁，返回两者是否存在
+func RemoveDenyIP(ip, operator string) (bool, bool, error) {
+	prefix, normalized, err := normalizeDenyIP(ip)
+	if err != nil {
+		return false, false, err
+	}
+	removedManual, err := db.RemoveDenylistIP(normalized)
+	if err != nil {
+		return false, false, fmt.Errorf("从数据库删除黑名单失败: %w", err)
+	}
+	if removedManual {
+		if err := ReloadDenylist(); err != nil {
+			return true, false, fmt.Errorf("刷新黑名单缓存失败: %w", err)
+		}
+		publishDenylist(denylistMessage{Op: "reload"})
+	}
+
+	removedBan := false
+	if prefix.IsSingleIP() {
+		removedBan = unbanIP(prefix.Addr())
+	}
+	log.Info("删除IP黑名单: %s, 手动条目: %v, 自动封禁: %v, 操作人: %s", normalized, removedManual, removedBan, operator)
+	return removedManual, removedBan, nil
+}
+
+// GetDenylist 获取手动条目和当前生效的自动封禁（按截止时间排序）
+func GetDenylist() ([]db_mysql.IPDenylist, []DenyBan) {
+	entries := make([]db_mysql.IPDenylist, 0)
+	if manual := denyManual.Load(); manual != nil {
+		entries = append(entries, manual.entries...)
+	}
+
+	now := time.Now().Unix()
+	bans := make([]DenyBan, 0)
+	denyMu.RLock()
+	for _, ban := range denyBans {
+		if ban.ExpireAt > now {
+			bans = append(bans, ban)
+		}
+	}
+	denyMu.RUnlock()
+	sort.Slice(bans, func(i, j int) bool { return bans[i].ExpireAt < bans[j].ExpireAt })
+	return entries, bans
+}
+
+// purgeExpiredDenylist 删除已过期的手动条目并刷新缓存（定时任务）
+func purgeExpiredDenylist() (int, error) {
+	count, err := db.PurgeExpiredDenylist(time.Now().Unix())
+	if err != nil || count == 0 {
+		return int(count), err
+	}
+	if err := ReloadDenylist(); err != nil {
+		return int(count), fmt.Errorf("刷新黑名单缓存失败: %w", err)
+	}
+	publishDenylist(denylistMessage{Op: "reload"})
+	return int(count), nil
+}
+
+// retryAfterHeader Retry-After 响应头的值
+func retryAfterHeader(seconds int64) string {
+	return strconv.FormatInt(max(seconds, 1), 10)
+}
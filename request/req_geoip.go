@@ -0,0 +1,384 @@
+package request
+
+import (
+	"loginServer/config"
+	"loginServer/pkg/geoip"
+	"loginServer/src/log"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 地区访问限制
+// 按 API 分组配置国家规则，客户端 IP 的国家通过本地 MaxMind 格式数据库（GeoLite2-Country 等）查询。
+// 在黑名单和白名单检查之后执行，被拒绝的请求返回 403 和 CodeGeoBlocked，提示信息按客户端语言返回。
+// 数据库文件按 geoip.reload_sec 检查修改时间，变化后自动重新加载；加载失败时继续使用旧的数据库。
+//
+// 以下请求不受地区限制：
+//   - geoip.exempt_accounts 中的账号（只认 Authorization 中经过签名校验的账号，见 req_auth.go；用于测试账号在海外验证）
+//   - 白名单分组 geoip.exempt_whitelist_group（默认 geoip_exempt）中的 IP，通过白名单接口维护，支持过期时间
+//
+// 配置项（config.json）：
+//
+//	"geoip": {
+//	    "db_path": "./data/GeoLite2-Country.mmdb", // 数据库文件
+//	    "reload_sec": 60,                          // 检查文件变化的间隔
+//	    "rules": {
+//	        "out": {
+//	            "allow": ["CN", "HK", "MO"],       // 只允许这些国家；与 deny 二选一
+//	            "deny": [],                        // 拒绝这些国家
+//	            "unknown": "allow"                 // 无法确定国家时（内网地址、未收录、数据库未加载）：allow / deny
+//	        }
+//	    },
+//	    "exempt_accounts": ["test001"],
+//	    "exempt_whitelist_group": "geoip_exempt",
+//	    "default_locale": "en",                    // 客户端语言没有对应提示时使用的语言
+//	    "messages": {"en": "..."}                  // 覆盖或补充各语言的提示信息
+//	}
+
+const (
+	defaultGeoReloadSec      = 60
+	defaultGeoExemptGroup    = "geoip_exempt"
+	defaultGeoMessageLocale  = "en"
+	geoUnknownAllow          = "allow"
+	geoUnknownDeny           = "deny"
+	geoBlockedFallbackLocale = "zh-cn"
+)
+
+// 地区限制的判断依据
+const (
+	geoRuleNoRule        = "no_rule"         // 分组没有配置地区规则
+	geoRuleExemptAccount = "exempt_account"  // 豁免账号
+	geoRuleExemptIP      = "exempt_ip"       // IP 在豁免白名单分组中
+	geoRuleAllowed       = "country_allowed" // 国家允许访问
+	geoRuleBlocked       = "country_blocked" // 国家不允许访问
+	geoRuleUnknown       = "country_unknown" // 无法确定国家，按 unknown 配置处理
+)
+
+// defaultGeoBlockedMessages 内置的提示信息（语言 -> 信息）
+var defaultGeoBlockedMessages = map[string]string{
+	"zh-cn": "当前地区暂未开放服务",
+	"zh":    "当前地区暂未开放服务",
+	"zh-tw": "目前所在地區暫未開放服務",
+	"zh-hk": "目前所在地區暫未開放服務",
+	"en":    "This service is not available in your region.",
+	"ja":    "お住まいの地域ではサービスをご利用いただけません。",
+	"ko":    "현재 지역에서는 서비스를 이용할 수 없습니다.",
+}
+
+// geoRule 一个分组的国家规则
+type geoRule struct {
+	allow        map[string]bool // 非空时只允许这些国家
+	deny         map[string]bool
+	unknownAllow bool
+}
+
+// geoConfig 地区限制配置（启动时加载）
+type geoConfig struct {
+	path           string
+	reloadInterval time.Duration
+	rules          map[string]geoRule // 小写分组名 -> 规则
+	exemptAccounts map[string]bool
+	exemptGroup    string
+	defaultLocale  string
+	messages       map[string]string
+}
+
+// geoDatabase 当前使用的数据库
+type geoDatabase struct {
+	reader   *geoip.Reader
+	modTime  time.Time
+	size     int64
+	loadedAt int64
+}
+
+// geoDecision 地区限制的判断结果
+type geoDecision struct {
+	allowed bool
+	rule    string // 判断依据（geoRule*）
+	country string // 查询到的国家代码，无法确定时为空
+}
+
+var (
+	geoCfg atomic.Pointer[geoConfig]
+	geoDB  atomic.Pointer[geoDatabase]
+
+	geoStop chan struct{}
+	geoDone chan struct{}
+)
+
+// loadGeoConfig 加载地区限制配置
+func loadGeoConfig() *geoConfig {
+	cfg := &geoConfig{
+		path:           strings.TrimSpace(config.Config.GetString("geoip.db_path")),
+		reloadInterval: time.Duration(configIntDefault("geoip.reload_sec", defaultGeoReloadSec)) * time.Second,
+		rules:          make(map[string]geoRule),
+		exemptAccounts: make(map[string]bool),
+		exemptGroup:    strings.ToLower(strings.TrimSpace(config.Config.GetString("geoip.exempt_whitelist_group"))),
+		defaultLocale:  normalizeLang(config.Config.GetString("geoip.default_locale")),
+		messages:       make(map[string]string, len(defaultGeoBlockedMessages)),
+	}
+	if cfg.exemptGroup == "" {
+		cfg.exemptGroup = defaultGeoExemptGroup
+	}
+	if cfg.defaultLocale == "" {
+		cfg.defaultLocale = defaultGeoMessageLocale
+	}
+	for locale, msg := range defaultGeoBlockedMessages {
+		cfg.messages[locale] = msg
+	}
+	for locale, msg := range config.Config.GetStringMapString("geoip.messages") {
+		if locale = normalizeLang(locale); locale != "" && msg != "" {
+			cfg.messages[locale] = msg
+		}
+	}
+	for _, account := range config.Config.GetStringSlice("geoip.exempt_accounts") {
+		if account = strings.TrimSpace(account); account != "" {
+			cfg.exemptAccounts[account] = true
+		}
+	}
+
+	for group := range config.Config.GetStringMap("geoip.rules") {
+		key := "geoip.rules." + group
+		rule := geoRule{
+			allow:        countrySet(config.Config.GetStringSlice(key + ".allow")),
+			deny:         countrySet(config.Config.GetStringSlice(key + ".deny")),
+			unknownAllow: true,
+		}
+		if len(rule.allow) > 0 && len(rule.deny) > 0 {
+			log.Error("geoip.rules.%s 同时配置了 allow 和 deny，只使用 allow", group)
+			rule.deny = nil
+		}
+		switch unknown := strings.ToLower(strings.TrimSpace(config.Config.GetString(key + ".unknown"))); unknown {
+		case "", geoUnknownAllow:
+		case geoUnknownDeny:
+			rule.unknownAllow = false
+		default:
+			log.Error("geoip.rules.%s.unknown 不支持: %s，使用 %s", group, unknown, geoUnknownAllow)
+		}
+		cfg.rules[strings.ToLower(group)] = rule
+	}
+	geoCfg.Store(cfg)
+	return cfg
+}
+
+// getGeoConfig 当前的地区限制配置
+func getGeoConfig() *geoConfig {
+	if cfg := geoCfg.Load(); cfg != nil {
+		return cfg
+	}
+	return loadGeoConfig()
+}
+
+// countrySet 国家代码集合（统一大写）
+func countrySet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			set[code] = true
+		}
+	}
+	return set
+}
+
+// startGeoIP 加载地区规则和数据库，后台检查数据库文件的变化
+func startGeoIP() {
+	if geoStop != nil {
+		return
+	}
+	cfg := loadGeoConfig()
+	if cfg.path == "" {
+		if len(cfg.rules) > 0 {
+			log.Warn("配置了地区规则但没有配置 geoip.db_path，所有请求都按无法确定国家处理")
+		}
+		return
+	}
+	if err := ReloadGeoDatabase(); err != nil {
+		log.Error("加载 GeoIP 数据库失败: %v", err)
+	}
+
+	geoStop = make(chan struct{})
+	geoDone = make(chan struct{})
+	go func() {
+		defer close(geoDone)
+		ticker := time.NewTicker(cfg.reloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-geoStop:
+				return
+			case <-ticker.C:
+				if !geoDatabaseChanged(cfg.path) {
+					continue
+				}
+				if err := ReloadGeoDatabase(); err != nil {
+					log.Error("重新加载 GeoIP 数据库失败，继续使用旧的数据库: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// stopGeoIP 停止检查数据库文件
+func stopGeoIP() {
+	if geoStop == nil {
+		return
+	}
+	close(geoStop)
+	<-geoDone
+	geoStop = nil
+}
+
+// geoDatabaseChanged 数据库文件的修改时间或大小是否与当前加载的不同
+func geoDatabaseChanged(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	current := geoDB.Load()
+	return current == nil || !info.ModTime().Equal(current.modTime) || info.Size() != current.size
+}
+
+// ReloadGeoDatabase 重新加载数据库文件，失败时保留当前的数据库
+func ReloadGeoDatabase() error {
+	path := getGeoConfig().path
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	reader, err := geoip.Open(path)
+	if err != nil {
+		return err
+	}
+	geoDB.Store(&geoDatabase{reader: reader, modTime: info.ModTime(), size: info.Size(), loadedAt: time.Now().Unix()})
+
+	meta := reader.Metadata()
+	log.Info("GeoIP 数据库已加载: %s, 类型: %s, 生成时间: %s",
+		path, meta.DatabaseType, time.Unix(meta.BuildEpoch, 0).Format(time.DateTime))
+	return nil
+}
+
+// lookupCountry 查询 IP 的国家代码，数据库未加载或地址未收录时返回 false
+func lookupCountry(addr netip.Addr) (string, bool) {
+	current := geoDB.Load()
+	if current == nil {
+		return "", false
+	}
+	return current.reader.Country(addr)
+}
+
+// checkGeoAccess 中间件使用：检查请求是否被地区规则拒绝，返回拒绝时的国家代码
+func checkGeoAccess(c *gin.Context, clientIP string) (bool, string) {
+	fullpath := c.FullPath()
+	if fullpath == "" {
+		fullpath = c.Request.URL.Path
+	}
+	route, exists := routeCache[fullpath]
+	if !exists {
+		return false, ""
+	}
+	decision := decideGeoAccess(route.ApiGroup, clientIP, authenticatedAccountID(c), time.Now().Unix())
+	return !decision.allowed, decision.country
+}
+
+// decideGeoAccess 判断客户端能否按地区规则访问该分组（中间件和访问解释接口共用）
+func decideGeoAccess(apiGroup, clientIP, accountID string, now int64) geoDecision {
+	cfg := getGeoConfig()
+	rule, ok := cfg.rules[strings.ToLower(apiGroup)]
+	if !ok {
+		return geoDecision{allowed: true, rule: geoRuleNoRule}
+	}
+	if accountID = strings.TrimSpace(accountID); accountID != "" && cfg.exemptAccounts[accountID] {
+		return geoDecision{allowed: true, rule: geoRuleExemptAccount}
+	}
+
+	addr, err := netip.ParseAddr(clientIP)
+	if err == nil {
+		addr = addr.Unmap()
+		if group := getWhitelistGroup(cfg.exemptGroup); group != nil && group.set.Contains(addr, now) {
+			return geoDecision{allowed: true, rule: geoRuleExemptIP}
+		}
+	}
+
+	country, found := lookupCountry(addr)
+	switch {
+	case !found:
+		return geoDecision{allowed: rule.unknownAllow, rule: geoRuleUnknown}
+	case len(rule.allow) > 0:
+		return geoDecision{allowed: rule.allow[country], rule: geoRuleResult(rule.allow[country]), country: country}
+	default:
+		return geoDecision{allowed: !rule.deny[country], rule: geoRuleResult(!rule.deny[country]), country: country}
+	}
+}
+
+func geoRuleResult(allowed bool) string {
+	if allowed {
+		return geoRuleAllowed
+	}
+	return geoRuleBlocked
+}
+
+// geoBlockedMessage 按客户端语言选择提示信息：请求语言 -> 基础语言 -> geoip.default_locale -> 中文
+func geoBlockedMessage(c *gin.Context) string {
+	lang := normalizeLang(c.Query("lang"))
+	if lang == "" {
+		lang = pickAcceptLanguage(c.GetHeader("Accept-Language"))
+	}
+	cfg := getGeoConfig()
+	for _, locale := range []string{lang, baseLang(lang), cfg.defaultLocale, geoBlockedFallbackLocale} {
+		if msg, ok := cfg.messages[locale]; ok && locale != "" {
+			return msg
+		}
+	}
+	return defaultGeoBlockedMessages[geoBlockedFallbackLocale]
+}
+
+// GeoIPStatus 地区限制状态（后台查询接口）
+type GeoIPStatus struct {
+	Path          string            `json:"path"`
+	Loaded        bool              `json:"loaded"`
+	DatabaseType  string            `json:"database_type"`
+	BuildAt       int64             `json:"build_at"`  // 数据库生成时间
+	LoadedAt      int64             `json:"loaded_at"` // 本实例加载时间
+	Groups        []string          `json:"groups"`    // 配置了地区规则的分组
+	ExemptGroup   string            `json:"exempt_whitelist_group"`
+	ExemptAccount int               `json:"exempt_accounts"` // 豁免账号数量
+	Lookup        map[string]string `json:"lookup,omitempty"`
+}
+
+// GetGeoIPStatus 当前的地区限制状态；ip 非空时附带该 IP 的国家和各分组的判断结果
+func GetGeoIPStatus(ip string) GeoIPStatus {
+	cfg := getGeoConfig()
+	status := GeoIPStatus{
+		Path:          cfg.path,
+		Groups:        make([]string, 0, len(cfg.rules)),
+		ExemptGroup:   cfg.exemptGroup,
+		ExemptAccount: len(cfg.exemptAccounts),
+	}
+	for group := range cfg.rules {
+		status.Groups = append(status.Groups, group)
+	}
+	sort.Strings(status.Groups)
+	if current := geoDB.Load(); current != nil {
+		meta := current.reader.Metadata()
+		status.Loaded, status.DatabaseType, status.BuildAt, status.LoadedAt = true, meta.DatabaseType, meta.BuildEpoch, current.loadedAt
+	}
+
+	if ip = strings.TrimSpace(ip); ip != "" {
+		status.Lookup = make(map[string]string)
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			country, _ := lookupCountry(addr.Unmap())
+			status.Lookup["country"] = country
+		}
+		now := time.Now().Unix()
+		for _, group := range status.Groups {
+			status.Lookup[group] = decideGeoAccess(group, ip, "", now).rule
+		}
+	}
+	return status
+}
@@ -1,13 +1,20 @@
 package request
 
 import (
+	"errors"
+	"loginServer/pkg/richtext"
 	"loginServer/src/db"
 	"loginServer/src/db/db_mysql"
 	"loginServer/src/log"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 批量 ID 请求
@@ -22,18 +29,34 @@ type PageReq struct {
 	Title      string `form:"title"`
 	NoticeType int    `form:"notice_type"`
 	IsEnable   *int   `form:"is_enable"` // 指针类型以区分0和空
+	Status     *int   `form:"status"`    // 审核状态
 }
 
-// handle_createLoginNotice 创建公告
+// handle_createLoginNotice 创建公告（操作人取自 X-Admin-Token）
 // POST /loginNotice/create
 func handle_createLoginNotice(c *gin.Context) {
+	operator, ok := requireOperator(c)
+	if !ok {
+		return
+	}
 	var notice db_mysql.LoginNotice
 	if err := c.ShouldBindJSON(&notice); err != nil {
 		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
 		return
 	}
+	notice.Operator = operator
+	if err := normalizeNoticeTarget(&notice); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "定向条件错误: "+err.Error(), nil))
+		return
+	}
+	if err := normalizeNoticeContent(&notice); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "正文内容错误: "+err.Error(), nil))
+		return
+	}
 
-	if err := db.CreateLoginNotice(notice); err != nil {
+	// 新建的公告为草稿，审核发布后才会下发
+	created, err := db.CreateLoginNotice(notice)
+	if err != nil {
 		log.Error("CreateLoginNotice db err: %v", err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "创建失败", nil))
 		return
@@ -41,12 +64,16 @@ func handle_createLoginNotice(c *gin.Context) {
 
 	// 自动刷新缓存
 	UpdateNoticeList()
-	c.JSON(http.StatusOK, retResponse(CodeSuccess, "创建成功", nil))
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "创建成功", created))
 }
 
-// handle_deleteLoginNotice 删除公告
+// handle_deleteLoginNotice 删除公告（只能删除已归档的公告，修订记录保留）
 // POST /loginNotice/delete (GVA 转发过来的是 POST JSON Body)
 func handle_deleteLoginNotice(c *gin.Context) {
+	operator, ok := requireOperator(c)
+	if !ok {
+		return
+	}
 	var Id uint64
 
 	params, _, _ := ParseRequestParams(c)
@@ -62,49 +89,159 @@ func handle_deleteLoginNotice(c *gin.Context) {
 		Id = idVal
 	}
 
-	if err := db.DeleteLoginNotice(Id); err != nil {
+	if err := db.DeleteLoginNotice(Id, operator); errors.Is(err, db_mysql.ErrNoticeNotArchived) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, err.Error(), nil))
+		return
+	} else if err != nil {
+		log.Error("DeleteLoginNotice failed, id: %d, err: %v", Id, err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "删除失败", nil))
 		return
 	}
+	log.Info("删除公告, id: %d, operator: %s", Id, operator)
 
 	UpdateNoticeList()
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "删除成功", nil))
 }
 
-// handle_batchDeleteLoginNotice 批量删除
+// handle_batchDeleteLoginNotice 批量删除（只能删除已归档的公告，有未归档的公告时全部不删除）
 // POST /loginNotice/batchDelete
 func handle_batchDeleteLoginNotice(c *gin.Context) {
+	operator, ok := requireOperator(c)
+	if !ok {
+		return
+	}
 	var req IDsReq
 	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
 		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
 		return
 	}
 
-	if err := db.BatchDeleteLoginNotice(req.IDs); err != nil {
+	if err := db.BatchDeleteLoginNotice(req.IDs, operator); errors.Is(err, db_mysql.ErrNoticeNotArchived) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, err.Error(), nil))
+		return
+	} else if err != nil {
+		log.Error("BatchDeleteLoginNotice failed, ids: %v, err: %v", req.IDs, err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "批量删除失败", nil))
 		return
 	}
+	log.Info("批量删除公告, ids: %v, operator: %s", req.IDs, operator)
 
 	UpdateNoticeList()
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "批量删除成功", nil))
 }
 
-// handle_updateLoginNotice 更新公告
+// NoticeUpdateReq 更新公告的参数（部分更新）
+// 指针类型用于区分 "零值" 和 "未传值(nil)"，未传的字段保持不变
+type NoticeUpdateReq struct {
+	ID       uint64 `json:"id" binding:"required"`
+	Version  int    `json:"version" binding:"required"` // 读取公告时的版本号，与当前版本不一致时返回 CodeConflict
+	Operator string `json:"-"`                          // 操作人，取自 X-Admin-Token，不接受请求参数
+
+	NoticeType    *int    `json:"notice_type"`
+	Title         *string `json:"title"`
+	Content       *string `json:"content"`
+	ContentFormat *string `json:"content_format"`
+	BannerURL     *string `json:"banner_url"`
+	Priority      *int    `json:"priority"`
+	Sort          *int    `json:"sort"`
+	IsEnable      *int    `json:"is_enable"`
+	StartTime     *int64  `json:"start_time"`
+	EndTime       *int64  `json:"end_time"`
+	Info          *string `json:"info"`
+	Platforms     *string `json:"platforms"`
+	Channels      *string `json:"channels"`
+	MinVersion    *string `json:"min_version"`
+	MaxVersion    *string `json:"max_version"`
+	ClusterIDs    *string `json:"cluster_ids"`
+	Languages     *string `json:"languages"`
+	Accounts      *string `json:"accounts"`
+}
+
+// applyTo 将请求中携带的字段写入公告
+func (req NoticeUpdateReq) applyTo(notice *db_mysql.LoginNotice) {
+	notice.Operator = req.Operator
+	setIfPresent(&notice.NoticeType, req.NoticeType)
+	setIfPresent(&notice.Title, req.Title)
+	setIfPresent(&notice.Content, req.Content)
+	setIfPresent(&notice.ContentFormat, req.ContentFormat)
+	setIfPresent(&notice.BannerURL, req.BannerURL)
+	setIfPresent(&notice.Priority, req.Priority)
+	setIfPresent(&notice.Sort, req.Sort)
+	setIfPresent(&notice.IsEnable, req.IsEnable)
+	setIfPresent(&notice.StartTime, req.StartTime)
+	setIfPresent(&notice.EndTime, req.EndTime)
+	setIfPresent(&notice.Info, req.Info)
+	setIfPresent(&notice.Platforms, req.Platforms)
+	setIfPresent(&notice.Channels, req.Channels)
+	setIfPresent(&notice.MinVersion, req.MinVersion)
+	setIfPresent(&notice.MaxVersion, req.MaxVersion)
+	setIfPresent(&notice.ClusterIDs, req.ClusterIDs)
+	setIfPresent(&notice.Languages, req.Languages)
+	setIfPresent(&notice.Accounts, req.Accounts)
+}
+
+// setIfPresent 值不为 nil 时写入
+func setIfPresent[T any](dst *T, value *T) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+// noticeFieldError 公告字段校验错误（与数据库错误区分，返回参数错误）
+type noticeFieldError struct {
+	msg string
+}
+
+func (e *noticeFieldError) Error() string {
+	return e.msg
+}
+
+// handle_updateLoginNotice 更新公告（部分更新 + 乐观锁）
 // POST /loginNotice/update
+// {"id": 1, "version": 3, "title": "新标题"}（操作人取自 X-Admin-Token）
+// 只修改请求中携带的字段；version 与当前版本不一致时返回 CodeConflict 和当前的公告内容
 func handle_updateLoginNotice(c *gin.Context) {
-	var notice db_mysql.LoginNotice
-	if err := c.ShouldBindJSON(&notice); err != nil {
-		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
+	operator, ok := requireOperator(c)
+	if !ok {
 		return
 	}
+	var req NoticeUpdateReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+	req.Operator = operator
 
-	if err := db.UpdateLoginNotice(notice); err != nil {
-		c.JSON(http.StatusOK, retResponse(CodeError, "更新失败", nil))
+	// 修改后退回草稿，需要重新审核
+	notice, err := db.UpdateLoginNotice(req.ID, req.Version, func(notice *db_mysql.LoginNotice) error {
+		req.applyTo(notice)
+		if err := normalizeNoticeTarget(notice); err != nil {
+			return &noticeFieldError{msg: "定向条件错误: " + err.Error()}
+		}
+		if err := normalizeNoticeContent(notice); err != nil {
+			return &noticeFieldError{msg: "正文内容错误: " + err.Error()}
+		}
+		return nil
+	})
+	var fieldErr *noticeFieldError
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "公告不存在", nil))
+		return
+	} else if errors.Is(err, db_mysql.ErrNoticeConflict) {
+		current, _ := db.FindLoginNotice(req.ID)
+		c.JSON(http.StatusOK, retResponse(CodeConflict, err.Error(), current))
+		return
+	} else if errors.As(err, &fieldErr) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, fieldErr.msg, nil))
+		return
+	} else if err != nil {
+		log.Error("UpdateLoginNotice failed, id: %d, err: %v", req.ID, err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "更新失败: "+err.Error(), nil))
 		return
 	}
 
 	UpdateNoticeList()
-	c.JSON(http.StatusOK, retResponse(CodeSuccess, "更新成功", nil))
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "更新成功", notice))
 }
 
 // handle_findLoginNotice 查询单条
@@ -143,7 +280,7 @@ func handle_getLoginNoticeList(c *gin.Context) {
 		req.PageSize = 10
 	}
 
-	list, total, err := db.GetLoginNoticeList(req.Page, req.PageSize, req.Title, req.NoticeType, req.IsEnable)
+	list, total, err := db.GetLoginNoticeList(req.Page, req.PageSize, req.Title, req.NoticeType, req.IsEnable, req.Status)
 	if err != nil {
 		c.JSON(http.StatusOK, retResponse(CodeError, "获取列表失败", nil))
 		return
@@ -157,18 +294,873 @@ func handle_getLoginNoticeList(c *gin.Context) {
 	}))
 }
 
+// ========== 公告审核流程 ==========
+
+// NoticeTransitionReq 公告审核流程操作的参数
+type NoticeTransitionReq struct {
+	ID       uint64 `json:"id"       binding:"required"`
+	Version  int    `json:"version"  binding:"required"` // 读取公告时的版本号，与当前版本不一致时返回 CodeConflict
+	Action   string `json:"action"   binding:"required"` // submit / approve / reject / publish / withdraw / archive
+	Operator string `json:"-"`                           // 操作人，取自 X-Admin-Token，不接受请求参数
+	Comment  string `json:"comment"`                     // 审核意见
+}
+
+// NoticeRestoreReq 恢复公告修订版本的参数
+type NoticeRestoreReq struct {
+	ID       uint64 `json:"id"       binding:"required"`
+	Version  int    `json:"version"  binding:"required"` // 读取公告时的版本号，与当前版本不一致时返回 CodeConflict
+	Revision int    `json:"revision" binding:"required"`
+	Operator string `json:"-"` // 操作人，取自 X-Admin-Token，不接受请求参数
+}
+
+// handle_transitionLoginNotice 公告审核流程操作（提交、审核、驳回、发布、撤回、归档）
+// POST /loginServer/loginNotice/transition
+// 操作人取自 X-Admin-Token，"审核人不能是提交人或最后修改人"按签名校验过的后台账号判断
+func handle_transitionLoginNotice(c *gin.Context) {
+	operator, ok := requireOperator(c)
+	if !ok {
+		return
+	}
+	var req NoticeTransitionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+	req.Operator = operator
+
+	notice, err := db.TransitionLoginNotice(req.ID, req.Version, req.Action, req.Operator, req.Comment)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "公告不存在", nil))
+		return
+	} else if errors.Is(err, db_mysql.ErrNoticeConflict) {
+		current, _ := db.FindLoginNotice(req.ID)
+		c.JSON(http.StatusOK, retResponse(CodeConflict, err.Error(), current))
+		return
+	} else if err != nil {
+		log.Error("TransitionLoginNotice failed, id: %d, action: %s, err: %v", req.ID, req.Action, err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "操作失败: "+err.Error(), nil))
+		return
+	}
+	log.Info("公告状态变更, id: %d, action: %s, status: %d, operator: %s", notice.ID, req.Action, notice.Status, req.Operator)
+
+	UpdateNoticeList()
+	if req.Action == db_mysql.NoticeActionPublish {
+		publishNoticePublished(notice)
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "操作成功", notice))
+}
+
+// handle_getNoticeRevisions 获取公告的修订记录
+// GET /loginServer/loginNotice/revision/list?id=xx
+func handle_getNoticeRevisions(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Query("id"), 10, 64)
+	if id == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "ID无效", nil))
+		return
+	}
+
+	list, err := db.GetNoticeRevisions(id)
+	if err != nil {
+		log.Error("GetNoticeRevisions db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "查询失败", nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "查询成功", list))
+}
+
+// handle_restoreLoginNotice 将公告内容恢复到指定修订版本（恢复后为草稿，需要重新审核）
+// POST /loginServer/loginNotice/revision/restore
+func handle_restoreLoginNotice(c *gin.Context) {
+	operator, ok := requireOperator(c)
+	if !ok {
+		return
+	}
+	var req NoticeRestoreReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+	req.Operator = operator
+
+	notice, err := db.RestoreLoginNotice(req.ID, req.Version, req.Revision, req.Operator)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "公告或修订版本不存在", nil))
+		return
+	} else if errors.Is(err, db_mysql.ErrNoticeConflict) {
+		current, _ := db.FindLoginNotice(req.ID)
+		c.JSON(http.StatusOK, retResponse(CodeConflict, err.Error(), current))
+		return
+	} else if err != nil {
+		log.Error("RestoreLoginNotice failed, id: %d, revision: %d, err: %v", req.ID, req.Revision, err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "恢复失败: "+err.Error(), nil))
+		return
+	}
+
+	UpdateNoticeList()
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "恢复成功", notice))
+}
+
+// handle_previewLoginNotice 预览公告：按给定的客户端属性返回与 getLoginNotice 一致的结果（假设该公告已发布）
+// GET /loginServer/loginNotice/preview?id=xx&revision=0&time=0&platform=ios&channel=xx&version=1.2.0&cluster_id=1&lang=en&account_id=xx
+// revision 为 0 表示当前内容，time 为 0 表示当前时间
+func handle_previewLoginNotice(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Query("id"), 10, 64)
+	if id == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "ID无效", nil))
+		return
+	}
+	revision, _ := strconv.Atoi(c.Query("revision"))
+	now, _ := strconv.ParseInt(c.Query("time"), 10, 64)
+	if now <= 0 {
+		now = time.Now().Unix()
+	}
+
+	preview, err := previewNotice(id, revision, parseNoticeAttrs(c), now)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "修订版本不存在", nil))
+		return
+	} else if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeError, "预览失败: "+err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "预览成功", preview))
+}
+
+// ========== 公告统计 ==========
+
+// handle_getNoticeStat 查询公告展示/关闭/点击统计（最近一个写库间隔内的事件尚未计入）
+// GET /loginServer/noticeStat/list?notice_id=xx&start_date=20260101&end_date=20260131
+// 传 notice_id 时返回该公告的每日统计和合计，否则返回日期范围内每个公告的合计；日期默认最近 30 天
+func handle_getNoticeStat(c *gin.Context) {
+	startDate, endDate, err := parseNoticeStatRange(c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, err.Error(), nil))
+		return
+	}
+
+	noticeID, _ := strconv.ParseUint(c.Query("notice_id"), 10, 64)
+	if noticeID == 0 {
+		list, err := db.GetNoticeStatSummary(startDate, endDate)
+		if err != nil {
+			log.Error("GetNoticeStatSummary db err: %v", err)
+			c.JSON(http.StatusOK, retResponse(CodeError, "查询失败", nil))
+			return
+		}
+		c.JSON(http.StatusOK, retResponse(CodeSuccess, "查询成功", gin.H{
+			"list":       list,
+			"start_date": startDate,
+			"end_date":   endDate,
+		}))
+		return
+	}
+
+	list, err := db.GetNoticeStats(noticeID, startDate, endDate)
+	if err != nil {
+		log.Error("GetNoticeStats db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "查询失败", nil))
+		return
+	}
+	total := db_mysql.NoticeStat{NoticeID: noticeID}
+	for _, stat := range list {
+		total.Impressions += stat.Impressions
+		total.Dismisses += stat.Dismisses
+		total.Clicks += stat.Clicks
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "查询成功", gin.H{
+		"list":       list,
+		"total":      total,
+		"start_date": startDate,
+		"end_date":   endDate,
+	}))
+}
+
+// ========== 公告多语言 ==========
+
+// NoticeI18nReq 设置/删除公告翻译的参数
+// 翻译属于公告内容：与更新公告相同需要携带读取时的版本号，已发布的公告需先撤回，修改后公告退回草稿
+type NoticeI18nReq struct {
+	NoticeID  uint64 `json:"notice_id" binding:"required"`
+	Version   int    `json:"version"   binding:"required"` // 读取公告时的版本号，与当前版本不一致时返回 CodeConflict
+	Locale    string `json:"locale"    binding:"required"` // 语言，如 en、ja、zh-tw
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	BannerURL string `json:"banner_url"` // 为空时沿用默认语言的 Banner
+	Operator  string `json:"-"`          // 操作人，取自 X-Admin-Token，不接受请求参数
+}
+
+// respondNoticeI18nError 返回修改翻译失败的结果，版本冲突时携带当前的公告内容
+func respondNoticeI18nError(c *gin.Context, noticeID uint64, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "公告不存在", nil))
+	} else if errors.Is(err, db_mysql.ErrNoticeConflict) {
+		current, _ := db.FindLoginNotice(noticeID)
+		c.JSON(http.StatusOK, retResponse(CodeConflict, err.Error(), current))
+	} else if errors.Is(err, db_mysql.ErrNoticeI18nNotFound) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, err.Error(), nil))
+	} else {
+		log.Error("修改公告翻译失败, notice_id: %d, err: %v", noticeID, err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "保存失败: "+err.Error(), nil))
+	}
+}
+
+// handle_getNoticeI18nList 获取公告的全部翻译
+// GET /loginServer/loginNotice/i18n/list?notice_id=xx
+func handle_getNoticeI18nList(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Query("notice_id"), 10, 64)
+	if id == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "notice_id无效", nil))
+		return
+	}
+
+	list, err := db.LoadNoticeI18n([]uint64{id})
+	if err != nil {
+		log.Error("LoadNoticeI18n db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "查询失败", nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "查询成功", gin.H{
+		"list":           list,
+		"default_locale": noticeDefaultLocale(),
+		"locales":        noticeLocales(),
+	}))
+}
+
+// handle_setNoticeI18n 新增或修改公告的一条翻译
+// POST /loginServer/loginNotice/i18n/set
+func handle_setNoticeI18n(c *gin.Context) {
+	operator, ok := requireOperator(c)
+	if !ok {
+		return
+	}
+	var req NoticeI18nReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
+		return
+	}
+	req.Operator = operator
+	req.Locale = normalizeLang(req.Locale)
+	if req.Locale == noticeDefaultLocale() {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "默认语言的内容请直接修改公告", nil))
+		return
+	}
+	if locales := noticeLocales(); len(locales) > 0 && !slices.Contains(locales, req.Locale) {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "未启用的语言: "+req.Locale, nil))
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "标题和正文不能为空", nil))
+		return
+	}
+
+	notice, err := db.FindLoginNotice(req.NoticeID)
+	if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeError, "查询公告失败", nil))
+		return
+	}
+	if notice.ID == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "公告不存在", nil))
+		return
+	}
+	// 翻译与公告使用相同的正文格式
+	if err := richtext.Validate(req.Content, noticeContentFormat(notice.ContentFormat)); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "正文内容错误: "+err.Error(), nil))
+		return
+	}
+
+	notice, err = db.SetNoticeI18n(db_mysql.LoginNoticeI18n{
+		NoticeID:  req.NoticeID,
+		Locale:    req.Locale,
+		Title:     req.Title,
+		Content:   req.Content,
+		BannerURL: req.BannerURL,
+		Operator:  req.Operator,
+	}, req.Version)
+	if err != nil {
+		respondNoticeI18nError(c, req.NoticeID, err)
+		return
+	}
+
+	UpdateNoticeList()
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "保存成功", notice))
+}
+
+// handle_deleteNoticeI18n 删除公告的一条翻译
+// POST /loginServer/loginNotice/i18n/delete
+func handle_deleteNoticeI18n(c *gin.Context) {
+	operator, ok := requireOperator(c)
+	if !ok {
+		return
+	}
+	var req NoticeI18nReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
+		return
+	}
+	req.Operator = operator
+
+	notice, err := db.DeleteNoticeI18n(req.NoticeID, normalizeLang(req.Locale), req.Version, req.Operator)
+	if err != nil {
+		respondNoticeI18nError(c, req.NoticeID, err)
+		return
+	}
+
+	UpdateNoticeList()
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "删除成功", notice))
+}
+
+// handle_getNoticeMissingI18n 列出缺少已启用语言翻译的公告（只检查已开启且未过期的公告）
+// GET /loginServer/loginNotice/i18n/missing
+func handle_getNoticeMissingI18n(c *gin.Context) {
+	list, err := GetNoticeMissingTranslations()
+	if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeError, "查询失败", nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "查询成功", list))
+}
+
+// ========== 服务器展示管理接口 ==========
+
+// ServerDisplayReq 设置服务器展示属性的参数
+// 指针类型用于区分 "零值" 和 "未传值(nil)"，未传的字段保持不变
+type ServerDisplayReq struct {
+	ClusterID int64   `json:"cluster_id" binding:"required"`
+	GameID    int64   `json:"game_id"    binding:"required"`
+	Tags      *string `json:"tags"`     // 逗号分隔：hot,recommend,new
+	Sort      *int    `json:"sort"`     // 排序权重：数值越大越靠前
+	GroupID   *uint64 `json:"group_id"` // 显示分组ID，0 表示按范围自动归组
+	IsShow    *int    `json:"is_show"`
+	IsNew     *int    `json:"is_new"`
+}
+
+// handle_setServerDisplay 批量设置服务器标签、排序和分组
+// POST /loginServer/server/setDisplay
+func handle_setServerDisplay(c *gin.Context) {
+	var reqs []ServerDisplayReq
+	if err := c.ShouldBindJSON(&reqs); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+	if len(reqs) == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeSuccess, "列表为空", nil))
+		return
+	}
+
+	serverModels := make([]db_mysql.GameList, 0, len(reqs))
+	for _, req := range reqs {
+		if req.Tags != nil {
+			tags := normalizeServerTags(*req.Tags)
+			req.Tags = &tags
+		}
+		serverModels = append(serverModels, db_mysql.GameList{
+			ClusterID: req.ClusterID,
+			GameID:    req.GameID,
+			Tags:      req.Tags,
+			Sort:      req.Sort,
+			GroupID:   req.GroupID,
+			IsShow:    req.IsShow,
+			IsNew:     req.IsNew,
+		})
+	}
+
+	if err := db.UpdateServerDisplay(serverModels); err != nil {
+		log.Error("handle_setServerDisplay db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "设置失败: "+err.Error(), nil))
+		return
+	}
+
+	UpdateCacheServerList(serverModels)
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "设置成功", nil))
+}
+
+// handle_createServerGroup 创建服务器分组
+// POST /loginServer/serverGroup/create
+func handle_createServerGroup(c *gin.Context) {
+	var group db_mysql.ServerGroup
+	if err := c.ShouldBindJSON(&group); err != nil || group.Name == "" {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: name不能为空", nil))
+		return
+	}
+	if group.MaxGameID != 0 && group.MaxGameID < group.MinGameID {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: max_game_id不能小于min_game_id", nil))
+		return
+	}
+	group.ID = 0
+
+	if err := db.CreateServerGroup(group); err != nil {
+		log.Error("CreateServerGroup db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "创建失败", nil))
+		return
+	}
+
+	UpdateServerGroupCache()
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "创建成功", nil))
+}
+
+// handle_updateServerGroup 更新服务器分组
+// POST /loginServer/serverGroup/update
+func handle_updateServerGroup(c *gin.Context) {
+	var group db_mysql.ServerGroup
+	if err := c.ShouldBindJSON(&group); err != nil || group.ID == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: id不能为空", nil))
+		return
+	}
+	if group.MaxGameID != 0 && group.MaxGameID < group.MinGameID {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: max_game_id不能小于min_game_id", nil))
+		return
+	}
+
+	if err := db.UpdateServerGroup(group); err != nil {
+		log.Error("UpdateServerGroup db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "更新失败", nil))
+		return
+	}
+
+	UpdateServerGroupCache()
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "更新成功", nil))
+}
+
+// handle_deleteServerGroup 删除服务器分组（组内服务器恢复为按范围自动归组）
+// POST /loginServer/serverGroup/delete
+func handle_deleteServerGroup(c *gin.Context) {
+	params, _, _ := ParseRequestParams(c)
+	id, err := strconv.ParseUint(GetParamString(params, c, "id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "id无效", nil))
+		return
+	}
+
+	if err := db.DeleteServerGroup(id); err != nil {
+		log.Error("DeleteServerGroup db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "删除失败", nil))
+		return
+	}
+
+	// 服务器的 group_id 被清零，服务器列表需要从数据库重新加载
+	UpdateServerGroupCache()
+	ReloadServerList()
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "删除成功", nil))
+}
+
+// handle_getServerGroupList 获取所有服务器分组
+// GET /loginServer/serverGroup/list
+func handle_getServerGroupList(c *gin.Context) {
+	groups, err := GetServerGroups()
+	if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeError, "获取列表失败", nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "获取成功", groups))
+}
+
+// normalizeServerTags 规范化标签：去空格、转小写、去重，保持原有顺序
+func normalizeServerTags(tags string) string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return strings.Join(result, ",")
+}
+
+// ========== 运行状态 ==========
+
+// handle_getHistoryBufferStats 获取玩家历史写缓冲状态（队列深度、累计写入、最后错误）
+// GET /loginServer/historyBuffer/stats
+func handle_getHistoryBufferStats(c *gin.Context) {
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", GetHistoryBufferStats()))
+}
+
+// CacheReloadReq 重新加载缓存的参数
+type CacheReloadReq struct {
+	Targets []string `json:"targets"` // server_list / server_group / notice / whitelist，为空表示全部
+}
+
+// handle_reloadCaches 从数据库重新加载缓存（数据库被直接修改、或需要立即同步其它实例的修改时使用）
+// POST /loginServer/cache/reload
+func handle_reloadCaches(c *gin.Context) {
+	var req CacheReloadReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+			return
+		}
+	}
+	if len(req.Targets) == 0 {
+		req.Targets = CacheTargets
+	}
+	for _, target := range req.Targets {
+		if !slices.Contains(CacheTargets, target) {
+			c.JSON(http.StatusOK, retResponse(CodeBadRequest, "未知的缓存: "+target, nil))
+			return
+		}
+	}
+
+	result := ReloadCaches(req.Targets)
+	for _, errMsg := range result {
+		if errMsg != "" {
+			c.JSON(http.StatusOK, retResponse(CodeError, "部分缓存加载失败", result))
+			return
+		}
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "加载成功", result))
+}
+
+// handle_cleanupPlayerHistory 手动触发清理指向已不存在游戏服的历史记录
+// POST /loginServer/playerHistory/cleanup
+// 清理需要扫描全部玩家历史，在后台执行，结果通过 /loginServer/job/status?name=history_cleanup 查询（count 为删除的记录数）
+func handle_cleanupPlayerHistory(c *gin.Context) {
+	job, started := startAdminJob(AdminJobHistoryCleanup, cleanupStaleHistory)
+	if !started {
+		c.JSON(http.StatusOK, retResponse(CodeConflict, "清理任务正在执行", job))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "清理任务已启动", job))
+}
+
+// handle_getAdminJobStatus 获取后台任务状态
+// GET /loginServer/job/status?name=history_cleanup
+// name 为空时返回全部任务；任务从未启动过时返回空数组
+func handle_getAdminJobStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", GetAdminJobStatus(c.Query("name"))))
+}
+
+// ========== 实时推送 ==========
+
+// maxPushMessageLen 跑马灯/广播消息的最大长度（字符）
+const maxPushMessageLen = 500
+
+// PushBroadcastReq 发送跑马灯/广播消息的参数
+type PushBroadcastReq struct {
+	Type      string `json:"type"` // marquee（默认）/ broadcast
+	Message   string `json:"message" binding:"required"`
+	ClusterID int64  `json:"cluster_id"` // 只发送给该集群的客户端，0 表示全部
+	Repeat    int    `json:"repeat"`     // 跑马灯滚动次数，0 由客户端决定
+	Operator  string `json:"operator" binding:"required"`
+}
+
+// handle_pushBroadcast 向在线客户端发送跑马灯/广播消息
+// POST /loginServer/push/broadcast
+func handle_pushBroadcast(c *gin.Context) {
+	var req PushBroadcastReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+	if req.Type == "" {
+		req.Type = PushEventMarquee
+	}
+	if req.Type != PushEventMarquee && req.Type != PushEventBroadcast {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "type 只支持 marquee / broadcast", nil))
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" || utf8.RuneCountInString(req.Message) > maxPushMessageLen {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "消息不能为空且不能超过 500 个字符", nil))
+		return
+	}
+
+	publishPushEvent(req.Type, req.ClusterID, gin.H{
+		"message": req.Message,
+		"repeat":  req.Repeat,
+		"sent_at": time.Now().Unix(),
+	})
+	log.Info("发送推送消息, type: %s, cluster_id: %d, operator: %s, message: %s", req.Type, req.ClusterID, req.Operator, req.Message)
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "发送成功", nil))
+}
+
+// handle_getPushStats 获取本实例的推送连接状态
+// GET /loginServer/push/stats
+func handle_getPushStats(c *gin.Context) {
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", pushes.stats()))
+}
+
+// ========== 角色反查 ==========
+
+// maxSearchPageSize 查询接口单页最大条数
+const maxSearchPageSize = 100
+
+// PlayerSearchReq 角色/账号查询参数
+type PlayerSearchReq struct {
+	Page          int    `form:"page"`
+	PageSize      int    `form:"pageSize"`
+	ClusterID     int64  `form:"cluster_id"`
+	GameID        int64  `form:"game_id"`
+	PlayerID      int64  `form:"player_id"`
+	AccountPrefix string `form:"account_prefix"`
+}
+
+// bindPlayerSearchReq 解析查询参数并补齐默认分页
+func bindPlayerSearchReq(c *gin.Context) (PlayerSearchReq, bool) {
+	var req PlayerSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
+		return req, false
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+	req.PageSize = min(req.PageSize, maxSearchPageSize)
+	return req, true
+}
+
+// searchPlayerIndex 按条件查询角色索引并返回分页结果
+func searchPlayerIndex(c *gin.Context, req PlayerSearchReq) {
+	filter := db_mysql.PlayerIndexFilter{ClusterID: req.ClusterID, GameID: req.GameID, PlayerID: req.PlayerID}
+	list, total, err := db.SearchPlayerIndex(filter, req.Page, req.PageSize)
+	if err != nil {
+		log.Error("SearchPlayerIndex failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "查询失败", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "获取成功", gin.H{
+		"list":     list,
+		"total":    total,
+		"page":     req.Page,
+		"pageSize": req.PageSize,
+	}))
+}
+
+// handle_searchByPlayer 按角色ID反查账号（可选 cluster_id/game_id 缩小范围）
+// GET /loginServer/playerIndex/byPlayer?player_id=xxx
+func handle_searchByPlayer(c *gin.Context) {
+	req, ok := bindPlayerSearchReq(c)
+	if !ok {
+		return
+	}
+	if req.PlayerID == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "player_id 不能为空", nil))
+		return
+	}
+	searchPlayerIndex(c, req)
+}
+
+// handle_searchByServer 查询指定游戏服下的所有角色
+// GET /loginServer/playerIndex/byServer?cluster_id=1&game_id=1
+func handle_searchByServer(c *gin.Context) {
+	req, ok := bindPlayerSearchReq(c)
+	if !ok {
+		return
+	}
+	if req.ClusterID == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "cluster_id 不能为空", nil))
+		return
+	}
+	req.PlayerID = 0
+	searchPlayerIndex(c, req)
+}
+
+// handle_searchByAccount 按账号前缀查询账号（含账号状态与角色列表）
+// GET /loginServer/playerIndex/byAccount?account_prefix=xxx
+func handle_searchByAccount(c *gin.Context) {
+	req, ok := bindPlayerSearchReq(c)
+	if !ok {
+		return
+	}
+	if req.AccountPrefix == "" {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "account_prefix 不能为空", nil))
+		return
+	}
+
+	list, total, err := db.SearchUserHistoryByPrefix(req.AccountPrefix, req.Page, req.PageSize)
+	if err != nil {
+		log.Error("SearchUserHistoryByPrefix failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "查询失败", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "获取成功", gin.H{
+		"list":     list,
+		"total":    total,
+		"page":     req.Page,
+		"pageSize": req.PageSize,
+	}))
+}
+
+// handle_rebuildPlayerIndex 按玩家历史全量重建角色索引（首次上线或数据修复时使用）
+// POST /loginServer/playerIndex/rebuild
+// 重建需要扫描全部玩家历史，在后台执行，结果通过 /loginServer/job/status?name=player_index_rebuild 查询（count 为处理的账号数）
+func handle_rebuildPlayerIndex(c *gin.Context) {
+	job, started := startAdminJob(AdminJobPlayerIndexRebuild, db.RebuildPlayerIndex)
+	if !started {
+		c.JSON(http.StatusOK, retResponse(CodeConflict, "重建任务正在执行", job))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "重建任务已启动", job))
+}
+
+// ========== 账号数据导出与删除 ==========
+
+// ErasureRequestReq 创建删除申请的参数
+type ErasureRequestReq struct {
+	AccountID string `json:"account_id" binding:"required"`
+	Operator  string `json:"operator"   binding:"required"` // 申请人（GM账号）
+	Reason    string `json:"reason"`                        // 申请原因/工单号
+}
+
+// ErasureCancelReq 撤销删除申请的参数
+type ErasureCancelReq struct {
+	ID       uint64 `json:"id"       binding:"required"`
+	Operator string `json:"operator" binding:"required"`
+}
+
+// ErasureListReq 删除申请列表查询参数
+type ErasureListReq struct {
+	Page     int  `form:"page"`
+	PageSize int  `form:"pageSize"`
+	Status   *int `form:"status"` // 指针类型以区分0和空
+}
+
+// handle_exportAccount 导出账号在登录服保存的全部数据
+// GET /loginServer/account/export?account_id=xxx&operator=xxx&download=true
+// download=true 时以附件形式返回，便于直接保存为 JSON 归档文件
+func handle_exportAccount(c *gin.Context) {
+	accountID := c.Query("account_id")
+	operator := c.Query("operator")
+	if accountID == "" || operator == "" {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "account_id 和 operator 不能为空", nil))
+		return
+	}
+
+	export, err := exportAccount(accountID)
+	if err != nil {
+		log.Error("exportAccount failed, account: %s, err: %v", accountID, err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "导出失败", nil))
+		return
+	}
+	addAccountAudit(accountID, auditActionExport, operator, "")
+
+	if c.Query("download") == "true" {
+		filename := "account_" + strconv.FormatInt(export.ExportedAt, 10) + ".json"
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "导出成功", export))
+}
+
+// handle_requestErasure 创建账号数据删除申请（进入冷静期）
+// POST /loginServer/account/erasure/request
+func handle_requestErasure(c *gin.Context) {
+	var req ErasureRequestReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+
+	erasure, err := requestErasure(req.AccountID, req.Operator, req.Reason)
+	if err != nil {
+		log.Error("requestErasure failed, account: %s, err: %v", req.AccountID, err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "申请失败: "+err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "申请成功", erasure))
+}
+
+// handle_cancelErasure 撤销冷静期中的删除申请
+// POST /loginServer/account/erasure/cancel
+func handle_cancelErasure(c *gin.Context) {
+	var req ErasureCancelReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+
+	erasure, err := cancelErasure(req.ID, req.Operator)
+	if err != nil {
+		log.Error("cancelErasure failed, id: %d, err: %v", req.ID, err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "撤销失败: "+err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "撤销成功", erasure))
+}
+
+// handle_getErasureList 分页查询删除申请
+// GET /loginServer/account/erasure/list
+func handle_getErasureList(c *gin.Context) {
+	var req ErasureListReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
+		return
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+	req.PageSize = min(req.PageSize, maxSearchPageSize)
+
+	list, total, err := db.GetErasureList(req.Page, req.PageSize, req.Status)
+	if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeError, "获取列表失败", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "获取成功", gin.H{
+		"list":     list,
+		"total":    total,
+		"page":     req.Page,
+		"pageSize": req.PageSize,
+	}))
+}
+
+// handle_runErasures 立即执行冷静期已结束的删除申请（不必等定时任务）
+// POST /loginServer/account/erasure/run
+func handle_runErasures(c *gin.Context) {
+	done, err := runDueErasures()
+	if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeError, "执行失败: "+err.Error(), gin.H{"done": done}))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "执行成功", gin.H{"done": done}))
+}
+
+// handle_verifyErasureLog 校验删除记录的哈希链是否完整
+// GET /loginServer/account/erasure/verify
+func handle_verifyErasureLog(c *gin.Context) {
+	count, brokenID, err := db.VerifyErasureLog()
+	if err != nil {
+		log.Error("VerifyErasureLog failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "校验失败", nil))
+		return
+	}
+	if brokenID != 0 {
+		log.Error("VerifyErasureLog: 哈希链在记录 %d 处不一致", brokenID)
+		c.JSON(http.StatusOK, retResponse(CodeError, "哈希链不一致", gin.H{"verified": count, "broken_id": brokenID}))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "校验通过", gin.H{"verified": count}))
+}
+
 // ========== IP白名单管理接口 ==========
 
 // WhitelistSetReq 设置白名单请求
 type WhitelistSetReq struct {
 	ApiGroup string   `json:"api_group" binding:"required"` // API分组：sgame, adminServer, out, test
 	IPs      []string `json:"ips"`                          // IP列表（支持CIDR格式）
+	Operator string   `json:"operator"`                     // 操作人
 }
 
+// maxWhitelistNoteLen 白名单备注最大长度（与数据库字段一致）
+const maxWhitelistNoteLen = 255
+
 // WhitelistAddReq 添加IP请求
+// expire_at 和 ttl_sec 都不传时永不过期；同时传入时以 expire_at 为准
 type WhitelistAddReq struct {
 	ApiGroup string `json:"api_group" binding:"required"` // API分组
-	IP       string `json:"ip" binding:"required"`         // 要添加的IP（支持CIDR格式）
+	IP       string `json:"ip" binding:"required"`        // 要添加的IP（支持CIDR格式）
+	ExpireAt int64  `json:"expire_at"`                    // 过期时间（Unix 秒）
+	TTLSec   int64  `json:"ttl_sec"`                      // 有效时长（秒）
+	Note     string `json:"note"`                         // 备注（如开放给哪个供应商、用途）
+	Operator string `json:"operator"`                     // 添加人
 }
 
 // WhitelistRemoveReq 删除IP请求
@@ -187,9 +1179,14 @@ func handle_getWhitelist(c *gin.Context) {
 	}
 
 	ips := GetWhitelist(apiGroup)
+	entries := GetWhitelistEntries(apiGroup)
+	if entries == nil {
+		entries = []WhitelistEntry{}
+	}
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", map[string]interface{}{
 		"api_group": apiGroup,
-		"ips":       ips,
+		"ips":       ips,     // 当前生效的IP
+		"entries":   entries, // 全部条目（含过期时间、备注、添加人；已过期但尚未清理的条目也会列出）
 	}))
 }
 
@@ -209,7 +1206,7 @@ func handle_setWhitelist(c *gin.Context) {
 		return
 	}
 
-	if err := SetWhitelist(req.ApiGroup, req.IPs); err != nil {
+	if err := SetWhitelist(req.ApiGroup, req.IPs, req.Operator); err != nil {
 		log.Error("SetWhitelist failed: %v", err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "设置失败: "+err.Error(), nil))
 		return
@@ -227,7 +1224,20 @@ func handle_addWhitelistIP(c *gin.Context) {
 		return
 	}
 
-	if err := AddIP(req.ApiGroup, req.IP); err != nil {
+	if utf8.RuneCountInString(req.Note) > maxWhitelistNoteLen {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: note不能超过 255 个字符", nil))
+		return
+	}
+	if req.ExpireAt < 0 || req.TTLSec < 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: expire_at/ttl_sec不能为负数", nil))
+		return
+	}
+	expireAt := req.ExpireAt
+	if expireAt == 0 && req.TTLSec > 0 {
+		expireAt = time.Now().Unix() + req.TTLSec
+	}
+
+	if err := AddIP(req.ApiGroup, req.IP, expireAt, req.Note, req.Operator); err != nil {
 		log.Error("AddIP failed: %v", err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "添加失败: "+err.Error(), nil))
 		return
@@ -253,3 +1263,121 @@ func handle_removeWhitelistIP(c *gin.Context) {
 
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "删除成功", nil))
 }
+
+// handle_explainAccess 解释客户端 IP 访问指定路由的结果（黑名单、调试接口、白名单）
+// GET /whitelist/explain?ip=1.2.3.4&path=/loginServer/reportServerList
+func handle_explainAccess(c *gin.Context) {
+	ip := c.Query("ip")
+	path := c.Query("path")
+	if ip == "" || path == "" {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: ip和path不能为空", nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", explainAccess(ip, path)))
+}
+
+// ========== IP黑名单管理接口 ==========
+
+// DenylistAddReq 添加黑名单请求
+// expire_at 和 ttl_sec 都不传时永不过期；同时传入时以 expire_at 为准
+type DenylistAddReq struct {
+	IP       string `json:"ip" binding:"required"` // IP 或 CIDR
+	Reason   string `json:"reason"`                // 封禁原因
+	ExpireAt int64  `json:"expire_at"`             // 过期时间（Unix 秒）
+	TTLSec   int64  `json:"ttl_sec"`               // 有效时长（秒）
+	Operator string `json:"operator"`              // 操作人
+}
+
+// DenylistRemoveReq 删除黑名单请求（同时解除该 IP 的自动封禁）
+type DenylistRemoveReq struct {
+	IP       string `json:"ip" binding:"required"`
+	Operator string `json:"operator"`
+}
+
+// handle_getDenylist 获取手动黑名单和当前生效的自动封禁
+// GET /loginServer/denylist/list
+func handle_getDenylist(c *gin.Context) {
+	entries, bans := GetDenylist()
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", gin.H{
+		"entries": entries,
+		"bans":    bans,
+	}))
+}
+
+// handle_addDenylistIP 添加黑名单
+// POST /loginServer/denylist/add
+func handle_addDenylistIP(c *gin.Context) {
+	var req DenylistAddReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+	if utf8.RuneCountInString(req.Reason) > maxWhitelistNoteLen {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: reason不能超过 255 个字符", nil))
+		return
+	}
+	if req.ExpireAt < 0 || req.TTLSec < 0 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: expire_at/ttl_sec不能为负数", nil))
+		return
+	}
+	expireAt := req.ExpireAt
+	if expireAt == 0 && req.TTLSec > 0 {
+		expireAt = time.Now().Unix() + req.TTLSec
+	}
+
+	if err := AddDenyIP(req.IP, req.Reason, expireAt, req.Operator); err != nil {
+		log.Error("AddDenyIP failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "添加失败: "+err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "添加成功", nil))
+}
+
+// handle_removeDenylistIP 删除黑名单条目并解除该 IP 的自动封禁
+// POST /loginServer/denylist/remove
+func handle_removeDenylistIP(c *gin.Context) {
+	var req DenylistRemoveReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误: "+err.Error(), nil))
+		return
+	}
+
+	removedManual, removedBan, err := RemoveDenyIP(req.IP, req.Operator)
+	if err != nil {
+		log.Error("RemoveDenyIP failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "删除失败: "+err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "删除成功", gin.H{
+		"removed_entry": removedManual,
+		"removed_ban":   removedBan,
+	}))
+}
+
+// handle_clearAutoBans 解除全部自动封禁
+// POST /loginServer/denylist/clearBans
+func handle_clearAutoBans(c *gin.Context) {
+	count := ClearAutoBans()
+	log.Info("解除全部自动封禁, 数量: %d, 操作人: %s", count, c.PostForm("operator"))
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "已解除", gin.H{"cleared": count}))
+}
+
+// ========== 地区访问限制接口 ==========
+
+// handle_geoipStatus 查看 GeoIP 数据库和地区规则的状态
+// GET /loginServer/geoip/status?ip=1.2.3.4
+// 传入 ip 时返回该 IP 的国家代码和各分组的判断依据
+func handle_geoipStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", GetGeoIPStatus(c.Query("ip"))))
+}
+
+// handle_geoipReload 立即重新加载本实例的 GeoIP 数据库（文件变化时各实例也会自动加载）
+// POST /loginServer/geoip/reload
+func handle_geoipReload(c *gin.Context) {
+	if err := ReloadGeoDatabase(); err != nil {
+		log.Error("handle_geoipReload failed, err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "加载GeoIP数据库失败: "+err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "已重新加载", GetGeoIPStatus("")))
+}
@@ -1,25 +1,92 @@
 package request
 
 import (
-	"loginServer/src/db"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"loginServer/src/db/db_mysql"
 	"loginServer/src/log"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// HeaderDataVersion 响应头：当前数据版本号，客户端可用于增量同步
+const HeaderDataVersion = "X-Data-Version"
+
 // handle_getServerList 获取服务器列表处理函数
 // GET /loginServer/getServerList
+// 支持 If-None-Match 协商缓存，数据未变化时返回 304
 func handle_getServerList(c *gin.Context) {
-	servers, err := GetServerList()
+	servers, version, err := GetServerListSnapshot()
 	if err != nil {
 		log.Error("handle_getServerList failed, err: %v", err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "获取服务器列表失败", nil))
 		return
 	}
+
+	c.Header(HeaderDataVersion, strconv.FormatInt(version, 10))
+	if checkETag(c, fmt.Sprintf(`"s%d"`, version)) {
+		return
+	}
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", servers))
 }
 
+// handle_getServerListDelta 获取指定版本之后变更的服务器
+// GET /loginServer/getServerListDelta?version=xx
+// 参数说明：
+//   - version: 客户端上次同步得到的版本号，不传或为 0 时返回全量
+//
+// 返回 full=true 时表示版本过旧无法计算增量，servers 为全量列表，客户端需整体替换；
+// 否则 servers 为变更的服务器，removed 为已删除的服务器（cluster_id + game_id）
+func handle_getServerListDelta(c *gin.Context) {
+	var since int64
+	if v := c.Query("version"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusOK, retResponse(CodeBadRequest, "version必须是非负整数", nil))
+			return
+		}
+		since = parsed
+	}
+
+	version, full, servers, removed, err := GetServerListDelta(since)
+	if err != nil {
+		log.Error("handle_getServerListDelta failed, err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "获取服务器列表失败", nil))
+		return
+	}
+
+	c.Header(HeaderDataVersion, strconv.FormatInt(version, 10))
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", gin.H{
+		"version": version,
+		"full":    full,
+		"servers": servers,
+		"removed": removed,
+	}))
+}
+
+// handle_getServerListGrouped 获取按显示分组组织的服务器列表
+// GET /loginServer/getServerListGrouped
+// 返回分组数组，每个分组包含元数据和组内按顺序排列的服务器
+func handle_getServerListGrouped(c *gin.Context) {
+	groups, version, groupVersion, err := GetServerListGrouped()
+	if err != nil {
+		log.Error("handle_getServerListGrouped failed, err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "获取服务器列表失败", nil))
+		return
+	}
+
+	c.Header(HeaderDataVersion, strconv.FormatInt(version, 10))
+	if checkETag(c, fmt.Sprintf(`"g%d-%d"`, version, groupVersion)) {
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", groups))
+}
+
 // handle_getPlayerServerList 获取玩家服务器列表处理函数
 // GET /loginServer/getPlayerServerList
 func handle_getPlayerServerList(c *gin.Context) {
@@ -36,22 +103,180 @@ func handle_getPlayerServerList(c *gin.Context) {
 	}
 
 	// 传入 accountID
-	playerHistory, err := db.GetUserHistory(accountId)
+	playerHistory, err := getUserHistory(accountId)
 	if err != nil {
 		log.Error("handle_getPlayerServerList failed, err: %v", err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "获取服务器列表失败", nil))
 		return
 	}
 
-	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", playerHistory))
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", buildPlayerServerList(playerHistory)))
+}
+
+// PlayerServerItem 玩家角色记录 + 对应游戏服的展示信息（从服务器列表缓存关联）
+// 服务器已不在列表中时，服务器相关字段为 null
+type PlayerServerItem struct {
+	db_mysql.PlayerHistoryItem
+	ServerName *string `json:"server_name"`
+	State      *int    `json:"state"`
+	IsShow     *int    `json:"is_show"`
+	Addr       *string `json:"addr"`
+	Port       *int    `json:"port"`
+}
+
+// PlayerServerListResp getPlayerServerList 的返回结构
+type PlayerServerListResp struct {
+	AccountID  string             `json:"account_id"`
+	State      int                `json:"state"`
+	PlayerList []PlayerServerItem `json:"player_list"`
+	Info       *string            `json:"info"`
+}
+
+// buildPlayerServerList 将玩家历史与服务器列表缓存关联，客户端一次请求即可拿到服务器名称和状态
+func buildPlayerServerList(history db_mysql.UserPlayerHistory) PlayerServerListResp {
+	resp := PlayerServerListResp{
+		AccountID:  history.AccountID,
+		State:      history.State,
+		PlayerList: make([]PlayerServerItem, 0, len(history.PlayerList)),
+		Info:       history.Info,
+	}
+	for _, item := range history.PlayerList {
+		entry := PlayerServerItem{PlayerHistoryItem: item}
+		if server, ok := GetServer(int64(item.ClusterID), int64(item.GameID)); ok {
+			entry.ServerName = server.Name
+			entry.State = server.State
+			entry.IsShow = server.IsShow
+			entry.Addr = server.Addr
+			entry.Port = server.Port
+		}
+		resp.PlayerList = append(resp.PlayerList, entry)
+	}
+	return resp
 }
 
 // handle_clientGetLoginNotice 客户端(游戏)获取公告
 // GET /loginServer/getLoginNotice
+// 可选参数 platform、channel、version、cluster_id、lang 用于匹配定向公告；
+// lang 未传时按 Accept-Language 选择语言；账号定向公告需要携带 Authorization: Bearer <token>
 func handle_clientGetLoginNotice(c *gin.Context) {
 	// 直接走内存缓存，无需查库，高性能
-	list, _ := GetLoginNotice()
+	attrs := parseNoticeAttrs(c)
+	list, version, _ := GetLoginNotice(attrs)
+
+	// 公告是否生效还取决于当前时间，ETag 需同时包含版本号、当前生效的公告集合和语言
+	c.Header(HeaderDataVersion, strconv.FormatInt(version, 10))
+	c.Header("Vary", "Accept-Language, Authorization")
+	if checkETag(c, fmt.Sprintf(`"n%d-%x-%s"`, version, hashNoticeIDs(list), attrs.Lang)) {
+		return
+	}
 
 	// 返回给客户端的数据结构，根据你的客户端协议定义
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "获取成功", list))
 }
+
+// NoticeEventReq 公告事件上报参数
+type NoticeEventReq struct {
+	Events []NoticeEvent `json:"events" binding:"required"`
+}
+
+// handle_reportNoticeEvent 客户端批量上报公告的展示、关闭和 Banner 点击
+// POST /loginServer/reportNoticeEvent
+// {"events": [{"notice_id": 1, "event": "impression"}, {"notice_id": 1, "event": "click"}]}
+func handle_reportNoticeEvent(c *gin.Context) {
+	var req NoticeEventReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误", nil))
+		return
+	}
+
+	accepted, err := recordNoticeEvents(req.Events)
+	if err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", gin.H{"accepted": accepted}))
+}
+
+// hashNoticeIDs 计算公告 ID 集合的摘要（与顺序无关）
+func hashNoticeIDs(list []db_mysql.LoginNotice) uint64 {
+	ids := make([]uint64, 0, len(list))
+	for _, n := range list {
+		ids = append(ids, n.ID)
+	}
+	slices.Sort(ids)
+
+	h := fnv.New64a()
+	for _, id := range ids {
+		h.Write([]byte(strconv.FormatUint(id, 10)))
+		h.Write([]byte{','})
+	}
+	return h.Sum64()
+}
+
+// handle_pushEvents 实时推送（Server-Sent Events）
+// GET /loginServer/events?cluster_id=1
+// 断线重连时浏览器会自动携带 Last-Event-ID 请求头，其它客户端也可以通过 last_event_id 参数传入最后收到的事件 ID
+func handle_pushEvents(c *gin.Context) {
+	clusterID, _ := strconv.ParseInt(c.Query("cluster_id"), 10, 64)
+	cursorText := c.GetHeader("Last-Event-ID")
+	if cursorText == "" {
+		cursorText = c.Query("last_event_id")
+	}
+	cursor, err := strconv.ParseInt(cursorText, 10, 64)
+	hasCursor := cursorText != "" && err == nil
+
+	client, backlog, err := pushes.register(clusterID, cursor, hasCursor)
+	if errors.Is(err, errPushFull) {
+		c.Header("Retry-After", strconv.Itoa(pushRetryMs/1000))
+		c.JSON(http.StatusServiceUnavailable, retResponse(CodeError, "连接数已满，请稍后重试", nil))
+		return
+	} else if err != nil {
+		c.JSON(http.StatusServiceUnavailable, retResponse(CodeError, "服务正在关闭", nil))
+		return
+	}
+	defer pushes.unregister(client)
+
+	// 长连接不受 HTTP 服务写超时的限制
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn("handle_pushEvents: 清除写超时失败: %v", err)
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 nginx 的响应缓冲
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", pushRetryMs); err != nil {
+		return
+	}
+	for _, event := range backlog {
+		if err := writePushEvent(w, event); err != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(time.Duration(configIntDefault("push.heartbeat_sec", defaultPushHeartbeat)) * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-client.ch:
+			if !ok {
+				// 服务关闭或接收过慢被断开
+				return
+			}
+			if err := writePushEvent(w, event); err != nil {
+				return
+			}
+			w.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package request
 
 import (
+	"fmt"
 	"loginServer/src/db"
 	"loginServer/src/db/db_mysql"
 	"loginServer/src/log"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -125,12 +128,44 @@ func handle_changeServerState(c *gin.Context) {
 
 // SetHistoryReq 定义请求参数结构体
 // 使用 form 标签支持 PostForm (表单提交)
-// 指针类型 (*string, *int) 允许客户端不传这些参数，不传时为 nil
+// 指针类型 (*string, *int) 允许客户端不传这些参数，不传时为 nil，表示不修改该字段
 type SetHistoryReq struct {
 	AccountID string `form:"account_id" json:"account_id" binding:"required"`
 	ClusterID int    `form:"cluster_id" json:"cluster_id" binding:"required"`
 	GameID    int    `form:"game_id"    json:"game_id"    binding:"required"`
 	PlayerID  int64  `form:"player_id"  json:"player_id"  binding:"required"`
+
+	// 选填项：角色信息，支持部分更新
+	RoleName      *string `form:"role_name"       json:"role_name"`
+	Level         *int    `form:"level"           json:"level"`
+	Class         *int    `form:"class"           json:"class"`
+	Avatar        *string `form:"avatar"          json:"avatar"`
+	LastLoginTime *int64  `form:"last_login_time" json:"last_login_time"`
+	// MoveTop 是否将该服移动到列表最前：1是(默认，登录场景) 0否(如仅等级变化)
+	MoveTop *int `form:"move_top" json:"move_top"`
+}
+
+// toUpdate 转换为数据库层的增量更新
+// 登录场景（move_top=1）未传 last_login_time 时，使用当前时间
+func (req SetHistoryReq) toUpdate() db_mysql.PlayerHistoryUpdate {
+	moveTop := req.MoveTop == nil || *req.MoveTop != 0
+	lastLoginTime := req.LastLoginTime
+	if moveTop && lastLoginTime == nil {
+		now := time.Now().Unix()
+		lastLoginTime = &now
+	}
+
+	return db_mysql.PlayerHistoryUpdate{
+		ClusterID:     req.ClusterID,
+		GameID:        req.GameID,
+		PlayerID:      req.PlayerID,
+		RoleName:      req.RoleName,
+		Level:         req.Level,
+		Class:         req.Class,
+		Avatar:        req.Avatar,
+		LastLoginTime: lastLoginTime,
+		MoveTop:       moveTop,
+	}
 }
 
 // handle_SetUserHistory 玩家登录/升级上报历史记录
@@ -146,13 +181,7 @@ func handle_SetUserHistory(c *gin.Context) {
 		return
 	}
 
-	newItem := db_mysql.PlayerHistoryItem{
-		ClusterID: req.ClusterID,
-		GameID:    req.GameID,
-		PlayerID:  req.PlayerID,
-	}
-
-	err := db.SetUserHistory(req.AccountID, newItem)
+	err := submitUserHistory(req.AccountID, req.toUpdate())
 	if err != nil {
 		log.Error("handle_SetUserHistory db err: %v", err)
 		c.JSON(http.StatusOK, retResponse(CodeError, "保存历史记录失败", nil))
@@ -162,6 +191,66 @@ func handle_SetUserHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "上报成功", nil))
 }
 
+// handle_batchSetUserHistory 批量上报玩家历史记录（开服高峰时由游戏服合并上报）
+// POST /loginServer/batchSetUserHistory
+// 参数为 SetHistoryReq 的 JSON 数组，数组顺序即上报的时间顺序
+func handle_batchSetUserHistory(c *gin.Context) {
+	var reqs []SetHistoryReq
+	if err := c.ShouldBindJSON(&reqs); err != nil {
+		log.Warn("handle_batchSetUserHistory bind params failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误或缺失", nil))
+		return
+	}
+
+	if len(reqs) == 0 {
+		c.JSON(http.StatusOK, retResponse(CodeSuccess, "列表为空", nil))
+		return
+	}
+
+	// 按账号分组，保持同一账号内的上报顺序
+	updates := make(map[string][]db_mysql.PlayerHistoryUpdate)
+	for _, req := range reqs {
+		updates[req.AccountID] = append(updates[req.AccountID], req.toUpdate())
+	}
+
+	if err := submitUserHistoryBatch(updates); err != nil {
+		log.Error("handle_batchSetUserHistory db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "批量保存历史记录失败", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "批量上报成功", nil))
+}
+
+// DeleteHistoryReq 删除角色记录的参数
+type DeleteHistoryReq struct {
+	AccountID string `form:"account_id" json:"account_id" binding:"required"`
+	ClusterID int    `form:"cluster_id" json:"cluster_id" binding:"required"`
+	GameID    int    `form:"game_id"    json:"game_id"    binding:"required"`
+	PlayerID  int64  `form:"player_id"  json:"player_id"` // 选填：不传或为 0 时删除该服的记录
+}
+
+// handle_deleteUserHistory 游戏服删除角色后，从账号历史中移除该角色
+// POST /loginServer/deleteUserHistory
+func handle_deleteUserHistory(c *gin.Context) {
+	var req DeleteHistoryReq
+	if err := c.ShouldBind(&req); err != nil {
+		log.Warn("handle_deleteUserHistory bind params failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误或缺失", nil))
+		return
+	}
+
+	if err := removeUserHistoryItem(req.AccountID, req.ClusterID, req.GameID, req.PlayerID); err != nil {
+		log.Error("handle_deleteUserHistory db err: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeError, "删除角色记录失败", nil))
+		return
+	}
+	addAccountAudit(req.AccountID, auditActionRemoveRole, "sgame:"+getClientIP(c),
+		fmt.Sprintf("cluster_id=%d game_id=%d player_id=%d", req.ClusterID, req.GameID, req.PlayerID))
+
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "删除成功", nil))
+}
+
 // handle_SetUserState 用户账号状态修改
 // POST /loginServer/setUserState
 func handle_SetUserState(c *gin.Context) {
@@ -186,10 +275,47 @@ func handle_SetUserState(c *gin.Context) {
 		c.JSON(http.StatusOK, retResponse(CodeError, "更新状态失败", nil))
 		return
 	}
+	addAccountAudit(accountId, auditActionSetState, "sgame:"+getClientIP(c), "state="+stateStr)
 
 	c.JSON(http.StatusOK, retResponse(CodeSuccess, "操作成功", nil))
 }
 
+// ReportAbuseReq 游戏服上报客户端登录失败/签名校验失败
+type ReportAbuseReq struct {
+	IP    string `form:"ip"    json:"ip"    binding:"required"` // 客户端IP
+	Kind  string `form:"kind"  json:"kind"  binding:"required"` // login_fail / sign_fail
+	Count int64  `form:"count" json:"count"`                    // 次数（合并上报时使用），默认 1
+}
+
+// handle_reportAbuse 游戏服上报客户端登录失败或签名校验失败，同一 IP 一分钟内达到阈值时自动封禁
+// POST /loginServer/reportAbuse
+func handle_reportAbuse(c *gin.Context) {
+	var req ReportAbuseReq
+	if err := c.ShouldBind(&req); err != nil {
+		log.Warn("handle_reportAbuse bind params failed: %v", err)
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "参数错误或缺失", nil))
+		return
+	}
+	if req.Kind != AbuseLoginFail && req.Kind != AbuseSignFail {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "kind 只支持 login_fail / sign_fail", nil))
+		return
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 0 || req.Count > 1000 {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "count 取值 1-1000", nil))
+		return
+	}
+	if _, err := netip.ParseAddr(req.IP); err != nil {
+		c.JSON(http.StatusOK, retResponse(CodeBadRequest, "无效的IP地址", nil))
+		return
+	}
+
+	recordAbuse(req.IP, req.Kind, req.Count)
+	c.JSON(http.StatusOK, retResponse(CodeSuccess, "", nil))
+}
+
 // handle_test 测试接口处理函数（GET），能够测试所有的返回情况
 // GET /loginServer/test
 // 参数说明：
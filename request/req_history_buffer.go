@@ -0,0 +1,490 @@
+package request
+
+import (
+	"encoding/json"
+	"loginServer/config"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 玩家历史写缓冲（write-behind）
+// 开服高峰时 setUserHistory 每秒数千次，逐条 SELECT + 整行覆盖写回压力很大。
+// 开启后上报先进入内存缓冲，同一账号的多次上报在内存中合并，由后台协程按固定间隔批量事务写入。
+// 缓冲已满或已关闭时直接写库：写库前与 flush 串行，并先合并该账号尚未落库的更新，保证旧数据不会覆盖新数据。
+// 优雅关闭时会在 HTTP 服务停止后执行最后一次 flush，之后仍在处理的请求直接写库，保证不丢更新。
+//
+// 配置项（config.json）：
+//
+//	"history_buffer": {
+//	    "enable": true,            // 是否开启缓冲，默认关闭（直接写库）
+//	    "flush_interval_ms": 200,  // flush 间隔
+//	    "max_batch": 200,          // 单个事务最多写入的账号数
+//	    "max_pending": 100000      // 待写入更新条数上限，超过后新上报直接写库（反压）
+//	}
+
+const (
+	defaultHistoryFlushInterval = 200 * time.Millisecond
+	defaultHistoryMaxBatch      = 200
+	defaultHistoryMaxPending    = 100000
+	historyStopFlushRetry       = 3 // 关闭时最后一次 flush 的重试次数
+	historyReadRetry            = 3 // 读取时数据库在读取期间变化的重试次数
+)
+
+// historyBuffer 按账号合并的写缓冲
+type historyBuffer struct {
+	mu       sync.Mutex
+	pending  map[string][]db_mysql.PlayerHistoryUpdate // accountID -> 按时间顺序的增量更新（同服已合并）
+	updates  int                                       // 待写入的更新条数
+	inflight map[string][]db_mysql.PlayerHistoryUpdate // 正在 flush 的批次（早于 pending）
+	commits  uint64                                    // inflight/pending 落库或移出的次数，读取时用于判断数据库是否在读取期间变化
+	closed   bool                                      // 已关闭：新的更新直接写库
+
+	flushMu sync.Mutex // 串行化 flush，保证同一账号的更新按顺序落库
+
+	interval   time.Duration
+	maxBatch   int
+	maxPending int
+
+	flushedTotal int64  // 累计写入的更新条数
+	lastFlushAt  int64  // 最后一次成功 flush 的时间
+	lastError    string // 最后一次 flush 失败的原因
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// HistoryBufferStats 写缓冲状态
+type HistoryBufferStats struct {
+	Enabled      bool   `json:"enabled"`
+	Accounts     int    `json:"accounts"`      // 待写入的账号数
+	Updates      int    `json:"updates"`       // 待写入的更新条数（队列深度）
+	FlushedTotal int64  `json:"flushed_total"` // 累计写入的更新条数
+	LastFlushAt  int64  `json:"last_flush_at"`
+	LastError    string `json:"last_error"`
+}
+
+var historyBuf *historyBuffer
+
+// startHistoryBuffer 按配置启动写缓冲
+func startHistoryBuffer() {
+	if !config.Config.GetBool("history_buffer.enable") {
+		return
+	}
+
+	interval := time.Duration(config.Config.GetInt("history_buffer.flush_interval_ms")) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultHistoryFlushInterval
+	}
+	maxBatch := config.Config.GetInt("history_buffer.max_batch")
+	if maxBatch <= 0 {
+		maxBatch = defaultHistoryMaxBatch
+	}
+	maxPending := config.Config.GetInt("history_buffer.max_pending")
+	if maxPending <= 0 {
+		maxPending = defaultHistoryMaxPending
+	}
+
+	historyBuf = &historyBuffer{
+		pending:    make(map[string][]db_mysql.PlayerHistoryUpdate),
+		interval:   interval,
+		maxBatch:   maxBatch,
+		maxPending: maxPending,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	go historyBuf.run()
+	log.Info("玩家历史写缓冲已开启, flush间隔: %v, 单批账号数: %d", interval, maxBatch)
+}
+
+// stopHistoryBuffer 停止写缓冲并写入剩余数据（在 HTTP 服务停止接收请求后调用）
+func stopHistoryBuffer() {
+	if historyBuf == nil {
+		return
+	}
+	// 先标记关闭：HTTP 关闭超时后仍在执行的请求不再进入缓冲，改为直接写库
+	historyBuf.mu.Lock()
+	historyBuf.closed = true
+	historyBuf.mu.Unlock()
+	close(historyBuf.stopCh)
+	<-historyBuf.doneCh
+
+	stats := GetHistoryBufferStats()
+	if stats.Updates > 0 {
+		// 多次重试仍失败：把剩余数据完整输出到错误日志，便于人工补录
+		data, _ := json.Marshal(historyBuf.pending)
+		log.Error("玩家历史写缓冲关闭时仍有 %d 条更新未写入, 数据: %s", stats.Updates, string(data))
+		return
+	}
+	log.Info("玩家历史写缓冲已关闭, 累计写入: %d", stats.FlushedTotal)
+}
+
+// GetHistoryBufferStats 获取写缓冲状态（队列深度等）
+func GetHistoryBufferStats() HistoryBufferStats {
+	b := historyBuf
+	if b == nil {
+		return HistoryBufferStats{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return HistoryBufferStats{
+		Enabled:      true,
+		Accounts:     len(b.pending),
+		Updates:      b.updates,
+		FlushedTotal: b.flushedTotal,
+		LastFlushAt:  b.lastFlushAt,
+		LastError:    b.lastError,
+	}
+}
+
+// submitUserHistory 提交玩家历史更新
+// 缓冲开启且未满时进入缓冲异步写入，否则直接写库
+func submitUserHistory(accountID string, update db_mysql.PlayerHistoryUpdate) error {
+	if historyBuf == nil {
+		return db.SetUserHistory(accountID, update)
+	}
+	updates := []db_mysql.PlayerHistoryUpdate{update}
+	if historyBuf.enqueue(accountID, updates) {
+		return nil
+	}
+	return historyBuf.writeDirect(map[string][]db_mysql.PlayerHistoryUpdate{accountID: updates})
+}
+
+// submitUserHistoryBatch 批量提交玩家历史更新（accountID -> 按时间顺序的增量更新）
+func submitUserHistoryBatch(updates map[string][]db_mysql.PlayerHistoryUpdate) error {
+	if historyBuf == nil {
+		return db.BatchSetUserHistory(updates)
+	}
+	direct := make(map[string][]db_mysql.PlayerHistoryUpdate)
+	for accountID, list := range updates {
+		if !historyBuf.enqueue(accountID, list) {
+			direct[accountID] = list
+		}
+	}
+	if len(direct) == 0 {
+		return nil
+	}
+	return historyBuf.writeDirect(direct)
+}
+
+// getUserHistory 读取玩家历史，并叠加缓冲中尚未落库的更新（含正在 flush 的批次，保证读到自己刚写的数据）
+func getUserHistory(accountID string) (db_mysql.UserPlayerHistory, error) {
+	b := historyBuf
+	if b == nil {
+		return db.GetUserHistory(accountID)
+	}
+
+	// 读库期间若有批次落库，叠加的快照可能早于数据库中的数据，重新读取；多次仍变化时与 flush 串行读取
+	for i := 0; i < historyReadRetry; i++ {
+		b.mu.Lock()
+		commits := b.commits
+		b.mu.Unlock()
+
+		history, err := db.GetUserHistory(accountID)
+		if err != nil {
+			return history, err
+		}
+		if unflushed, ok := b.unflushedSince(accountID, commits); ok {
+			if len(unflushed) > 0 {
+				history.PlayerList = db_mysql.ApplyHistoryUpdates(history.PlayerList, unflushed)
+			}
+			return history, nil
+		}
+	}
+
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	commits := b.commits
+	b.mu.Unlock()
+	history, err := db.GetUserHistory(accountID)
+	if err != nil {
+		return history, err
+	}
+	if unflushed, _ := b.unflushedSince(accountID, commits); len(unflushed) > 0 {
+		history.PlayerList = db_mysql.ApplyHistoryUpdates(history.PlayerList, unflushed)
+	}
+	return history, nil
+}
+
+// unflushedSince 返回账号尚未落库的更新（正在 flush 的批次在前），
+// 自 commits 之后有批次落库或移出时返回 false
+func (b *historyBuffer) unflushedSince(accountID string, commits uint64) ([]db_mysql.PlayerHistoryUpdate, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.commits != commits {
+		return nil, false
+	}
+	list := append([]db_mysql.PlayerHistoryUpdate(nil), b.inflight[accountID]...)
+	for _, update := range b.pending[accountID] {
+		list = coalesceHistoryUpdate(list, update)
+	}
+	return list, true
+}
+
+// writeDirect 缓冲已满或已关闭时直接写库
+// 与 flush 串行，并把账号尚未落库的更新合并在本次更新之前一起写入，避免之后 flush 的旧数据覆盖本次写入
+func (b *historyBuffer) writeDirect(updates map[string][]db_mysql.PlayerHistoryUpdate) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	taken := make(map[string][]db_mysql.PlayerHistoryUpdate)
+	merged := make(map[string][]db_mysql.PlayerHistoryUpdate, len(updates))
+	b.mu.Lock()
+	for accountID, list := range updates {
+		older := b.pending[accountID]
+		if len(older) > 0 {
+			taken[accountID] = older
+			b.updates -= len(older)
+			delete(b.pending, accountID)
+		}
+		combined := append([]db_mysql.PlayerHistoryUpdate(nil), older...)
+		for _, update := range list {
+			combined = coalesceHistoryUpdate(combined, update)
+		}
+		if len(combined) > 0 {
+			merged[accountID] = combined
+		}
+	}
+	b.mu.Unlock()
+	if len(merged) == 0 {
+		return nil
+	}
+
+	if err := db.BatchSetUserHistory(merged); err != nil {
+		// 本次更新由调用方返回错误，缓冲中原有的更新放回缓冲
+		if len(taken) > 0 {
+			b.requeue(taken, err)
+		}
+		return err
+	}
+	b.mu.Lock()
+	b.commits++
+	b.mu.Unlock()
+	return nil
+}
+
+// flushAccountHistory 立即写入账号在缓冲中尚未落库的更新（导出等直接读 MySQL 的场景先调用）
+func flushAccountHistory(accountID string) error {
+	if historyBuf == nil {
+		return nil
+	}
+	return historyBuf.writeDirect(map[string][]db_mysql.PlayerHistoryUpdate{accountID: nil})
+}
+
+// removeUserHistoryItem 删除账号历史中的指定角色
+// 缓冲开启时先丢弃该服尚未落库的更新，并与 flush 串行执行，避免删除后又被缓冲中的旧数据写回
+func removeUserHistoryItem(accountID string, clusterID, gameID int, playerID int64) error {
+	return withHistoryFlushLock(func() error {
+		if historyBuf != nil {
+			historyBuf.discard(accountID, clusterID, gameID)
+		}
+		return db.RemoveUserHistoryItem(accountID, clusterID, gameID, playerID)
+	})
+}
+
+// withHistoryFlushLock 在写缓冲 flush 锁内执行（未开启缓冲时直接执行）
+// 用于删除类操作：保证执行期间缓冲中的旧数据不会写回
+func withHistoryFlushLock(fn func() error) error {
+	if historyBuf != nil {
+		historyBuf.flushMu.Lock()
+		defer historyBuf.flushMu.Unlock()
+	}
+	return fn()
+}
+
+// discardAccountHistory 丢弃账号在缓冲中全部尚未落库的更新（需在 withHistoryFlushLock 内调用）
+func discardAccountHistory(accountID string) {
+	if historyBuf == nil {
+		return
+	}
+	historyBuf.mu.Lock()
+	defer historyBuf.mu.Unlock()
+	historyBuf.updates -= len(historyBuf.pending[accountID])
+	delete(historyBuf.pending, accountID)
+}
+
+// discard 丢弃指定账号指定服尚未落库的更新
+func (b *historyBuffer) discard(accountID string, clusterID, gameID int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := b.pending[accountID]
+	kept := list[:0]
+	for _, u := range list {
+		if u.ClusterID == clusterID && u.GameID == gameID {
+			b.updates--
+			continue
+		}
+		kept = append(kept, u)
+	}
+	if len(kept) == 0 {
+		delete(b.pending, accountID)
+		return
+	}
+	b.pending[accountID] = kept
+}
+
+// enqueue 将更新放入缓冲，返回 false 表示缓冲已满或已关闭，调用方需调用 writeDirect 直接写库
+func (b *historyBuffer) enqueue(accountID string, updates []db_mysql.PlayerHistoryUpdate) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.updates+len(updates) > b.maxPending {
+		return false
+	}
+	list := b.pending[accountID]
+	before := len(list)
+	for _, update := range updates {
+		list = coalesceHistoryUpdate(list, update)
+	}
+	b.pending[accountID] = list
+	b.updates += len(list) - before
+	return true
+}
+
+// run 后台定时 flush
+func (b *historyBuffer) run() {
+	defer close(b.doneCh)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.stopCh:
+			for i := 0; i < historyStopFlushRetry; i++ {
+				if b.flush() {
+					return
+				}
+				time.Sleep(b.interval)
+			}
+			return
+		}
+	}
+}
+
+// flush 将缓冲中的数据批量写入数据库，返回 true 表示全部写入成功
+// 写入失败的批次会按原顺序放回缓冲，下次重试，不会丢弃
+func (b *historyBuffer) flush() bool {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	if len(b.pending) == 0 {
+		b.mu.Unlock()
+		return true
+	}
+	pending := b.pending
+	b.pending = make(map[string][]db_mysql.PlayerHistoryUpdate)
+	b.updates = 0
+	b.inflight = pending
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.inflight = nil
+		b.mu.Unlock()
+	}()
+
+	accountIDs := make([]string, 0, len(pending))
+	for accountID := range pending {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+
+	allOK := true
+	for start := 0; start < len(accountIDs); start += b.maxBatch {
+		end := min(start+b.maxBatch, len(accountIDs))
+		batch := make(map[string][]db_mysql.PlayerHistoryUpdate, end-start)
+		count := 0
+		for _, accountID := range accountIDs[start:end] {
+			batch[accountID] = pending[accountID]
+			count += len(pending[accountID])
+		}
+
+		if err := db.BatchSetUserHistory(batch); err != nil {
+			log.Error("historyBuffer flush failed, accounts: %d, updates: %d, err: %v", len(batch), count, err)
+			b.requeue(batch, err)
+			allOK = false
+			continue
+		}
+
+		b.mu.Lock()
+		for accountID := range batch {
+			delete(b.inflight, accountID)
+		}
+		b.commits++
+		b.flushedTotal += int64(count)
+		b.lastFlushAt = time.Now().Unix()
+		b.mu.Unlock()
+	}
+	return allOK
+}
+
+// requeue 将写入失败的批次放回缓冲（排在 flush 期间新到达的更新之前）
+func (b *historyBuffer) requeue(batch map[string][]db_mysql.PlayerHistoryUpdate, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastError = err.Error()
+	b.commits++
+	for accountID, older := range batch {
+		delete(b.inflight, accountID)
+		list := append([]db_mysql.PlayerHistoryUpdate(nil), older...)
+		before := len(b.pending[accountID])
+		for _, update := range b.pending[accountID] {
+			list = coalesceHistoryUpdate(list, update)
+		}
+		b.pending[accountID] = list
+		b.updates += len(list) - before
+	}
+}
+
+// coalesceHistoryUpdate 将一条更新合并进同一账号的待写入列表
+// 同一个服的多次更新合并为一条（后到的字段覆盖先到的），需要置顶的更新移动到列表末尾，
+// 保证按顺序应用后，列表顺序与逐条写入的结果一致
+func coalesceHistoryUpdate(list []db_mysql.PlayerHistoryUpdate, update db_mysql.PlayerHistoryUpdate) []db_mysql.PlayerHistoryUpdate {
+	idx := -1
+	for i, u := range list {
+		if u.ClusterID == update.ClusterID && u.GameID == update.GameID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return append(list, update)
+	}
+
+	merged := list[idx]
+	if update.PlayerID != 0 {
+		merged.PlayerID = update.PlayerID
+	}
+	if update.RoleName != nil {
+		merged.RoleName = update.RoleName
+	}
+	if update.Level != nil {
+		merged.Level = update.Level
+	}
+	if update.Class != nil {
+		merged.Class = update.Class
+	}
+	if update.Avatar != nil {
+		merged.Avatar = update.Avatar
+	}
+	if update.LastLoginTime != nil {
+		merged.LastLoginTime = update.LastLoginTime
+	}
+	merged.MoveTop = merged.MoveTop || update.MoveTop
+
+	if !update.MoveTop {
+		list[idx] = merged
+		return list
+	}
+	list = append(list[:idx], list[idx+1:]...)
+	return append(list, merged)
+}
@@ -0,0 +1,263 @@
+package request
+
+import (
+	"loginServer/config"
+	"loginServer/pkg/myutil"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func intPtr(v int) *int { return &v }
+
+func strPtr(v string) *string { return &v }
+
+func TestCoalesceHistoryUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		list   []db_mysql.PlayerHistoryUpdate
+		update db_mysql.PlayerHistoryUpdate
+		want   []db_mysql.PlayerHistoryUpdate
+	}{
+		{
+			name:   "空列表追加",
+			update: db_mysql.PlayerHistoryUpdate{ClusterID: 1, GameID: 1, Level: intPtr(1)},
+			want:   []db_mysql.PlayerHistoryUpdate{{ClusterID: 1, GameID: 1, Level: intPtr(1)}},
+		},
+		{
+			name:   "不同服追加到末尾",
+			list:   []db_mysql.PlayerHistoryUpdate{{ClusterID: 1, GameID: 1}},
+			update: db_mysql.PlayerHistoryUpdate{ClusterID: 2, GameID: 1, MoveTop: true},
+			want: []db_mysql.PlayerHistoryUpdate{
+				{ClusterID: 1, GameID: 1},
+				{ClusterID: 2, GameID: 1, MoveTop: true},
+			},
+		},
+		{
+			name: "同服不置顶：原位置合并，后到的字段覆盖先到的",
+			list: []db_mysql.PlayerHistoryUpdate{
+				{ClusterID: 1, GameID: 1, PlayerID: 100, RoleName: strPtr("a"), Level: intPtr(1)},
+				{ClusterID: 1, GameID: 2},
+			},
+			update: db_mysql.PlayerHistoryUpdate{ClusterID: 1, GameID: 1, Level: intPtr(2)},
+			want: []db_mysql.PlayerHistoryUpdate{
+				{ClusterID: 1, GameID: 1, PlayerID: 100, RoleName: strPtr("a"), Level: intPtr(2)},
+				{ClusterID: 1, GameID: 2},
+			},
+		},
+		{
+			name: "同服置顶：合并后移到末尾",
+			list: []db_mysql.PlayerHistoryUpdate{
+				{ClusterID: 1, GameID: 1, Level: intPtr(1)},
+				{ClusterID: 1, GameID: 2},
+			},
+			update: db_mysql.PlayerHistoryUpdate{ClusterID: 1, GameID: 1, PlayerID: 100, MoveTop: true},
+			want: []db_mysql.PlayerHistoryUpdate{
+				{ClusterID: 1, GameID: 2},
+				{ClusterID: 1, GameID: 1, PlayerID: 100, Level: intPtr(1), MoveTop: true},
+			},
+		},
+		{
+			name: "先置顶后不置顶：保留置顶标记和位置",
+			list: []db_mysql.PlayerHistoryUpdate{
+				{ClusterID: 1, GameID: 1, MoveTop: true},
+				{ClusterID: 1, GameID: 2},
+			},
+			update: db_mysql.PlayerHistoryUpdate{ClusterID: 1, GameID: 1, Level: intPtr(3)},
+			want: []db_mysql.PlayerHistoryUpdate{
+				{ClusterID: 1, GameID: 1, Level: intPtr(3), MoveTop: true},
+				{ClusterID: 1, GameID: 2},
+			},
+		},
+		{
+			name:   "PlayerID 为 0 时不覆盖",
+			list:   []db_mysql.PlayerHistoryUpdate{{ClusterID: 1, GameID: 1, PlayerID: 100}},
+			update: db_mysql.PlayerHistoryUpdate{ClusterID: 1, GameID: 1, Level: intPtr(5)},
+			want:   []db_mysql.PlayerHistoryUpdate{{ClusterID: 1, GameID: 1, PlayerID: 100, Level: intPtr(5)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := coalesceHistoryUpdate(tt.list, tt.update)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("coalesceHistoryUpdate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCoalesceMatchesStepwise 合并后按顺序应用，与逐条应用的结果一致
+func TestCoalesceMatchesStepwise(t *testing.T) {
+	config.Config.Set("player_history.max_items", 0)
+
+	updates := []db_mysql.PlayerHistoryUpdate{
+		{ClusterID: 1, GameID: 1, Level: intPtr(1), MoveTop: true},
+		{ClusterID: 1, GameID: 2, Level: intPtr(1), MoveTop: true},
+		{ClusterID: 1, GameID: 1, Level: intPtr(2)},
+		{ClusterID: 1, GameID: 3, RoleName: strPtr("c"), MoveTop: true},
+		{ClusterID: 1, GameID: 2, Level: intPtr(5), MoveTop: true},
+		{ClusterID: 1, GameID: 3, Level: intPtr(7)},
+	}
+	existing := func() []db_mysql.PlayerHistoryItem {
+		return []db_mysql.PlayerHistoryItem{{ClusterID: 1, GameID: 9, Level: 99}, {ClusterID: 1, GameID: 1}}
+	}
+
+	stepwise := existing()
+	var coalesced []db_mysql.PlayerHistoryUpdate
+	for _, update := range updates {
+		stepwise = db_mysql.ApplyHistoryUpdates(stepwise, []db_mysql.PlayerHistoryUpdate{update})
+		coalesced = coalesceHistoryUpdate(coalesced, update)
+	}
+	if got := db_mysql.ApplyHistoryUpdates(existing(), coalesced); !reflect.DeepEqual(got, stepwise) {
+		t.Fatalf("合并后应用 = %+v, 逐条应用 = %+v", got, stepwise)
+	}
+}
+
+// newTestHistoryBuffer 构造不启动后台 flush 的写缓冲
+func newTestHistoryBuffer(maxPending int) *historyBuffer {
+	return &historyBuffer{
+		pending:    make(map[string][]db_mysql.PlayerHistoryUpdate),
+		interval:   defaultHistoryFlushInterval,
+		maxBatch:   defaultHistoryMaxBatch,
+		maxPending: maxPending,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+}
+
+// checkConcurrentHistory 每个 game_id 都应存在，且等级为最后一轮的值
+func checkConcurrentHistory(t *testing.T, list []db_mysql.PlayerHistoryItem, workers, rounds int) {
+	t.Helper()
+	saved := make(map[int]int, len(list))
+	for _, item := range list {
+		saved[item.GameID] = item.Level
+	}
+	lost := 0
+	for w := 1; w <= workers; w++ {
+		if level, ok := saved[w]; !ok || level != rounds {
+			lost++
+		}
+	}
+	if lost > 0 || len(list) != workers {
+		t.Fatalf("workers: %d, rounds: %d, saved: %d, lost: %d", workers, rounds, len(list), lost)
+	}
+}
+
+// runConcurrentHistory workers 个协程各写一个 game_id，每个协程重复上报 rounds 次（模拟重试）
+func runConcurrentHistory(t *testing.T, workers, rounds int, submit func(update db_mysql.PlayerHistoryUpdate) error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds)
+	for w := 1; w <= workers; w++ {
+		wg.Add(1)
+		go func(gameID int) {
+			defer wg.Done()
+			for r := 1; r <= rounds; r++ {
+				update := db_mysql.PlayerHistoryUpdate{
+					ClusterID: 1,
+					GameID:    gameID,
+					PlayerID:  int64(gameID),
+					Level:     intPtr(r),
+					MoveTop:   true,
+				}
+				if err := submit(update); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("submit failed: %v", err)
+	}
+}
+
+func TestHistoryBufferConcurrentEnqueue(t *testing.T) {
+	// 不限制条数：max_items 小于 workers 时裁剪会被误判为丢失
+	config.Config.Set("player_history.max_items", 0)
+
+	const workers, rounds = 200, 5
+	b := newTestHistoryBuffer(defaultHistoryMaxPending)
+	accountID := "concurrency_test"
+	runConcurrentHistory(t, workers, rounds, func(update db_mysql.PlayerHistoryUpdate) error {
+		if !b.enqueue(accountID, []db_mysql.PlayerHistoryUpdate{update}) {
+			t.Error("enqueue rejected")
+		}
+		return nil
+	})
+
+	if b.updates != workers {
+		t.Fatalf("updates = %d, want %d（同服更新应合并）", b.updates, workers)
+	}
+	unflushed, ok := b.unflushedSince(accountID, b.commits)
+	if !ok {
+		t.Fatal("unflushedSince reported a commit")
+	}
+	checkConcurrentHistory(t, db_mysql.ApplyHistoryUpdates(nil, unflushed), workers, rounds)
+}
+
+func TestHistoryBufferEnqueueBackpressure(t *testing.T) {
+	b := newTestHistoryBuffer(2)
+	update := func(gameID int) []db_mysql.PlayerHistoryUpdate {
+		return []db_mysql.PlayerHistoryUpdate{{ClusterID: 1, GameID: gameID}}
+	}
+	if !b.enqueue("a", update(1)) || !b.enqueue("a", update(2)) {
+		t.Fatal("enqueue rejected before reaching max_pending")
+	}
+	if b.enqueue("b", update(1)) {
+		t.Fatal("enqueue accepted beyond max_pending")
+	}
+	b.closed = true
+	if b.enqueue("a", update(1)) {
+		t.Fatal("enqueue accepted after close")
+	}
+}
+
+// TestHistoryBufferConcurrentWrite 通过写缓冲并发写入 MySQL，验证不丢失更新（缓冲已满时的直接写库路径同样覆盖）
+// 需要 config.json 中配置的 MySQL：
+//
+//	LOGIN_SERVER_TEST_MYSQL=1 go test -run TestHistoryBufferConcurrentWrite ./request
+func TestHistoryBufferConcurrentWrite(t *testing.T) {
+	if os.Getenv("LOGIN_SERVER_TEST_MYSQL") == "" {
+		t.Skip("set LOGIN_SERVER_TEST_MYSQL=1 to run against the configured MySQL")
+	}
+	if err := db.Start(); err != nil {
+		t.Fatalf("db start failed: %v", err)
+	}
+	config.Config.Set("player_history.max_items", 0)
+
+	const workers, rounds = 100, 3
+	for _, maxPending := range []int{defaultHistoryMaxPending, workers / 2} {
+		config.Config.Set("history_buffer.enable", true)
+		config.Config.Set("history_buffer.max_pending", maxPending)
+		startHistoryBuffer()
+
+		accountID := "concurrency_test_" + myutil.RandomString(12)
+		t.Cleanup(func() { _ = db.DeleteUserHistory(accountID) })
+
+		runConcurrentHistory(t, workers, rounds, func(update db_mysql.PlayerHistoryUpdate) error {
+			return submitUserHistory(accountID, update)
+		})
+
+		// 读取时叠加缓冲中尚未落库的更新
+		history, err := getUserHistory(accountID)
+		if err != nil {
+			t.Fatalf("getUserHistory failed: %v", err)
+		}
+		checkConcurrentHistory(t, history.PlayerList, workers, rounds)
+
+		// 关闭后全部落库
+		stopHistoryBuffer()
+		historyBuf = nil
+		stored, exists, err := db_mysql.FindUserHistory(accountID)
+		if err != nil || !exists {
+			t.Fatalf("FindUserHistory failed, exists: %v, err: %v", exists, err)
+		}
+		checkConcurrentHistory(t, stored.PlayerList, workers, rounds)
+	}
+}
@@ -0,0 +1,60 @@
+package request
+
+import (
+	"errors"
+	"loginServer/config"
+	"loginServer/pkg/richtext"
+	"loginServer/src/db/db_mysql"
+	"strings"
+)
+
+// 公告正文富文本
+// 正文按 content_format（html / markdown / text）保存，保存时严格校验，
+// 加载到缓存时净化并转换为客户端使用的富文本格式（notice.markup），翻译内容与公告使用相同的格式。
+//
+// 配置项（config.json）：
+//
+//	"notice": {
+//	    "markup": "tmp" // 下发给客户端的格式：html（默认）/ tmp（Unity TextMeshPro）/ plain
+//	}
+
+// noticeMarkup 下发给客户端的富文本格式
+func noticeMarkup() string {
+	markup := strings.ToLower(config.Config.GetString("notice.markup"))
+	if richtext.IsTarget(markup) {
+		return markup
+	}
+	return richtext.TargetHTML
+}
+
+// noticeContentFormat 公告正文格式，未设置时按 html 处理
+func noticeContentFormat(format string) string {
+	if format = strings.ToLower(strings.TrimSpace(format)); format == "" {
+		return richtext.FormatHTML
+	}
+	return format
+}
+
+// normalizeNoticeContent 规范化正文格式并校验正文
+func normalizeNoticeContent(notice *db_mysql.LoginNotice) error {
+	notice.ContentFormat = noticeContentFormat(notice.ContentFormat)
+	if !richtext.IsFormat(notice.ContentFormat) {
+		return errors.New("不支持的正文格式: " + notice.ContentFormat + "（支持 html / markdown / text）")
+	}
+	return richtext.Validate(notice.Content, notice.ContentFormat)
+}
+
+// renderNoticeEntries 将公告及其翻译的正文转换为客户端格式
+func renderNoticeEntries(entries []noticeEntry) {
+	markup := noticeMarkup()
+	for i := range entries {
+		notice := &entries[i].notice
+		format := noticeContentFormat(notice.ContentFormat)
+		notice.Content = richtext.Render(notice.Content, format, markup)
+		notice.ContentFormat = markup
+		for locale, item := range entries[i].translations {
+			item.Content = richtext.Render(item.Content, format, markup)
+			entries[i].translations[locale] = item
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package request
+
+import (
+	"loginServer/config"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 公告多语言
+// login_notice 中的标题/正文为默认语言，其它语言的翻译保存在 login_notice_i18n。
+// 客户端语言按以下顺序回退，命中第一个有内容的语言：
+// 请求语言（zh-tw）-> 基础语言（zh）-> notice.fallback 配置的语言 -> 默认语言
+//
+// 配置项（config.json）：
+//
+//	"notice": {
+//	    "locales": ["zh-cn", "en", "ja"], // 启用的语言，缺少翻译的公告会在缺失报告中列出
+//	    "default_locale": "zh-cn",        // login_notice 本身内容的语言
+//	    "fallback": ["en"]                // 请求语言没有翻译时依次尝试的语言
+//	}
+
+const defaultNoticeLocale = "zh-cn"
+
+// NoticeMissingI18n 缺少翻译的公告
+type NoticeMissingI18n struct {
+	NoticeID uint64   `json:"notice_id"`
+	Title    string   `json:"title"`
+	Missing  []string `json:"missing"` // 缺少的语言
+}
+
+// noticeDefaultLocale 公告默认语言
+func noticeDefaultLocale() string {
+	if locale := normalizeLang(config.Config.GetString("notice.default_locale")); locale != "" {
+		return locale
+	}
+	return defaultNoticeLocale
+}
+
+// noticeLocales 启用的语言（已规范化）
+func noticeLocales() []string {
+	locales := make([]string, 0)
+	for _, locale := range config.Config.GetStringSlice("notice.locales") {
+		if locale = normalizeLang(locale); locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
+
+// baseLang 基础语言：zh-cn -> zh
+func baseLang(lang string) string {
+	base, _, _ := strings.Cut(lang, "-")
+	return base
+}
+
+// localeChain 生成语言回退链：客户端语言 -> 基础语言 -> notice.fallback，默认语言作为最终兜底
+// 客户端没有携带语言时回退链只有默认语言，不经过 notice.fallback
+func localeChain(lang string) []string {
+	if lang == "" {
+		return []string{noticeDefaultLocale()}
+	}
+	chain := make([]string, 0, 4)
+	seen := make(map[string]bool)
+	add := func(locale string) {
+		if locale != "" && !seen[locale] {
+			seen[locale] = true
+			chain = append(chain, locale)
+		}
+	}
+	add(lang)
+	add(baseLang(lang))
+	for _, locale := range config.Config.GetStringSlice("notice.fallback") {
+		add(normalizeLang(locale))
+	}
+	return chain
+}
+
+// localizeNotice 按语言回退链选择公告内容
+func localizeNotice(entry noticeEntry, lang string) db_mysql.LoginNotice {
+	notice := entry.notice
+	defaultLocale := noticeDefaultLocale()
+
+	for _, locale := range localeChain(lang) {
+		// 命中默认语言（zh 也视为命中 zh-cn）：直接使用公告本身的内容
+		if locale == defaultLocale || locale == baseLang(defaultLocale) {
+			return notice
+		}
+		if item, ok := findTranslation(entry.translations, locale); ok {
+			notice.Title = item.Title
+			notice.Content = item.Content
+			if item.BannerURL != "" {
+				notice.BannerURL = item.BannerURL
+			}
+			return notice
+		}
+	}
+	return notice
+}
+
+// findTranslation 查找翻译：先精确匹配，再按基础语言匹配（en 可命中 en-us）
+func findTranslation(translations map[string]db_mysql.LoginNoticeI18n, locale string) (db_mysql.LoginNoticeI18n, bool) {
+	if item, ok := translations[locale]; ok {
+		return item, true
+	}
+	if strings.Contains(locale, "-") {
+		return db_mysql.LoginNoticeI18n{}, false
+	}
+	// 按语言排序保证结果稳定
+	candidates := make([]string, 0)
+	for key := range translations {
+		if baseLang(key) == locale {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		return db_mysql.LoginNoticeI18n{}, false
+	}
+	sort.Strings(candidates)
+	return translations[candidates[0]], true
+}
+
+// pickAcceptLanguage 从 Accept-Language 中按权重选择语言
+// 优先选择已启用（或默认）的语言，都不匹配时返回权重最高的语言
+func pickAcceptLanguage(header string) string {
+	type tagQ struct {
+		lang string
+		q    float64
+	}
+	tags := make([]tagQ, 0)
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(part, ";")
+		lang = normalizeLang(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				q = f
+			}
+		}
+		tags = append(tags, tagQ{lang: lang, q: q})
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	enabled := map[string]bool{noticeDefaultLocale(): true, baseLang(noticeDefaultLocale()): true}
+	for _, locale := range noticeLocales() {
+		enabled[locale] = true
+		enabled[baseLang(locale)] = true
+	}
+	for _, tag := range tags {
+		if enabled[tag.lang] || enabled[baseLang(tag.lang)] {
+			return tag.lang
+		}
+	}
+	return tags[0].lang
+}
+
+// attachNoticeTranslations 加载公告的翻译并挂到缓存条目上
+func attachNoticeTranslations(entries []noticeEntry) error {
+	ids := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.notice.ID)
+	}
+	items, err := db.LoadNoticeI18n(ids)
+	if err != nil {
+		return err
+	}
+
+	byNotice := make(map[uint64]map[string]db_mysql.LoginNoticeI18n)
+	for _, item := range items {
+		if byNotice[item.NoticeID] == nil {
+			byNotice[item.NoticeID] = make(map[string]db_mysql.LoginNoticeI18n)
+		}
+		byNotice[item.NoticeID][normalizeLang(item.Locale)] = item
+	}
+	for i := range entries {
+		entries[i].translations = byNotice[entries[i].notice.ID]
+	}
+	return nil
+}
+
+// findMissingTranslations 找出缺少已启用语言翻译的公告（默认语言不需要翻译）
+func findMissingTranslations(entries []noticeEntry) []NoticeMissingI18n {
+	defaultLocale := noticeDefaultLocale()
+	locales := noticeLocales()
+
+	result := make([]NoticeMissingI18n, 0)
+	for _, entry := range entries {
+		var missing []string
+		for _, locale := range locales {
+			if locale == defaultLocale {
+				continue
+			}
+			if _, ok := entry.translations[locale]; !ok {
+				missing = append(missing, locale)
+			}
+		}
+		if len(missing) > 0 {
+			result = append(result, NoticeMissingI18n{NoticeID: entry.notice.ID, Title: entry.notice.Title, Missing: missing})
+		}
+	}
+	return result
+}
+
+// GetNoticeMissingTranslations 获取缓存中（已开启且未过期）缺少翻译的公告
+func GetNoticeMissingTranslations() ([]NoticeMissingI18n, error) {
+	data, err := GetFromCacheWithLoader(CacheKeyLoginNotice, loadLoginNotice)
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := data.([]noticeEntry)
+	return findMissingTranslations(entries), nil
+}
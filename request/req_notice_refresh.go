@@ -0,0 +1,138 @@
+package request
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"loginServer/config"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"time"
+)
+
+// 公告缓存后台刷新
+// 公告缓存只在后台写操作时刷新的话，直接修改数据库、或其它 loginServer 实例修改的公告永远不会生效，
+// 已过期的公告也会一直留在缓存里。后台协程在以下时机从数据库重新加载：
+//   - 最近一条公告的 start_time / end_time 到达时（公告上线/下线的时间点）
+//   - 固定间隔 notice.refresh_interval_sec（兜底，同步其它实例或数据库的修改）
+//
+// 重新加载会丢弃已过期的公告；只有内容确实变化时才递增公告版本号，避免客户端缓存无谓失效。
+//
+// 配置项（config.json）：
+//
+//	"notice": {
+//	    "refresh_interval_sec": 60 // 定期刷新间隔，默认 60 秒
+//	}
+
+const defaultNoticeRefreshInterval = time.Minute
+
+var (
+	noticeFingerprint uint64 // 当前缓存公告内容的摘要（受 versionMu 保护）
+
+	noticeRefreshWake = make(chan struct{}, 1)
+	noticeRefreshStop chan struct{}
+	noticeRefreshDone chan struct{}
+)
+
+// startNoticeRefresher 启动公告缓存后台刷新
+func startNoticeRefresher() {
+	if noticeRefreshStop != nil {
+		return
+	}
+	interval := time.Duration(config.Config.GetInt("notice.refresh_interval_sec")) * time.Second
+	if interval <= 0 {
+		interval = defaultNoticeRefreshInterval
+	}
+
+	noticeRefreshStop = make(chan struct{})
+	noticeRefreshDone = make(chan struct{})
+	go runNoticeRefresher(interval)
+}
+
+// stopNoticeRefresher 停止公告缓存后台刷新
+func stopNoticeRefresher() {
+	if noticeRefreshStop == nil {
+		return
+	}
+	close(noticeRefreshStop)
+	<-noticeRefreshDone
+	noticeRefreshStop = nil
+}
+
+// wakeNoticeRefresher 公告缓存变化后通知后台协程重新计算下一个时间点
+func wakeNoticeRefresher() {
+	select {
+	case noticeRefreshWake <- struct{}{}:
+	default:
+	}
+}
+
+// runNoticeRefresher 后台刷新循环
+func runNoticeRefresher(interval time.Duration) {
+	defer close(noticeRefreshDone)
+
+	lastRefresh := time.Now()
+	timer := time.NewTimer(nextNoticeRefresh(lastRefresh, interval))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-noticeRefreshStop:
+			return
+		case <-noticeRefreshWake:
+		case <-timer.C:
+			// 每个实例各自定期刷新，不需要通知其它实例
+			if err := reloadNoticeList(); err != nil {
+				log.Error("公告缓存定期刷新失败: %v", err)
+			}
+			lastRefresh = time.Now()
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(nextNoticeRefresh(lastRefresh, interval))
+	}
+}
+
+// nextNoticeRefresh 计算距离下次刷新的时间：定期刷新时间点与最近的公告上线/下线时间点取较早者
+func nextNoticeRefresh(lastRefresh time.Time, interval time.Duration) time.Duration {
+	wait := time.Until(lastRefresh.Add(interval))
+
+	if data, exists := globalCacheInstance.Get(CacheKeyLoginNotice); exists {
+		entries, _ := data.([]noticeEntry)
+		now := time.Now().Unix()
+		for _, entry := range entries {
+			for _, boundary := range []int64{entry.notice.StartTime, entry.notice.EndTime} {
+				if boundary > now {
+					// 秒级时间戳：在该秒开始时刷新即可看到状态变化
+					wait = min(wait, time.Until(time.Unix(boundary, 0))+10*time.Millisecond)
+				}
+			}
+		}
+	}
+	return max(wait, 0)
+}
+
+// fingerprintNotices 计算公告缓存内容的摘要（公告本身 + 翻译）
+func fingerprintNotices(entries []noticeEntry) uint64 {
+	type item struct {
+		Notice       db_mysql.LoginNotice
+		Translations map[string]db_mysql.LoginNoticeI18n
+	}
+	items := make([]item, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, item{Notice: entry.notice, Translations: entry.translations})
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		log.Error("fingerprintNotices marshal failed: %v", err)
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
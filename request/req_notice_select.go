@@ -0,0 +1,154 @@
+package request
+
+import (
+	"loginServer/config"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 公告选取策略
+// 每种公告类型可配置下发的数量：top1（默认，只下发优先级最高的一条）、topN（如 top3）或 all，
+// 类型内按 priority、id 从高到低选取；max_total 限制所有类型合计的下发数量。
+// 下发顺序固定为 sort（客户端 Tab 顺序）、priority 从高到低，再按 start_time 从新到旧，最后按 id 从大到小。
+// 策略在公告缓存刷新时读取，修改配置后通过 /loginServer/cache/reload 或等待下次定期刷新生效。
+//
+// 配置项（config.json）：
+//
+//	"notice": {
+//	    "select": {
+//	        "default": "top1", // 未单独配置的类型
+//	        "1": "top2",       // 按 notice_type 配置
+//	        "3": "all"
+//	    },
+//	    "max_total": 5         // 合计最多下发的公告数，0 表示不限
+//	}
+
+// noticeSelectPolicy 公告选取策略
+type noticeSelectPolicy struct {
+	defaultLimit int         // 未单独配置的类型最多下发的数量，0 表示不限
+	typeLimits   map[int]int // notice_type -> 最多下发的数量，0 表示不限
+	maxTotal     int         // 合计最多下发的数量，0 表示不限
+}
+
+var currentNoticePolicy atomic.Pointer[noticeSelectPolicy]
+
+// loadNoticeSelectPolicy 从配置读取选取策略（公告缓存刷新时调用）
+func loadNoticeSelectPolicy() *noticeSelectPolicy {
+	policy := &noticeSelectPolicy{defaultLimit: 1, typeLimits: make(map[int]int)}
+	for key, value := range config.Config.GetStringMapString("notice.select") {
+		limit, ok := parseNoticeSelect(value)
+		if !ok {
+			log.Error("notice.select 配置错误: %s = %s，应为 top1 / topN / all", key, value)
+			continue
+		}
+		if key == "default" {
+			policy.defaultLimit = limit
+			continue
+		}
+		noticeType, err := strconv.Atoi(key)
+		if err != nil {
+			log.Error("notice.select 配置错误: 未知的公告类型 %s", key)
+			continue
+		}
+		policy.typeLimits[noticeType] = limit
+	}
+	policy.maxTotal = max(config.Config.GetInt("notice.max_total"), 0)
+
+	currentNoticePolicy.Store(policy)
+	return policy
+}
+
+// getNoticeSelectPolicy 当前的选取策略
+func getNoticeSelectPolicy() *noticeSelectPolicy {
+	if policy := currentNoticePolicy.Load(); policy != nil {
+		return policy
+	}
+	return loadNoticeSelectPolicy()
+}
+
+// parseNoticeSelect 解析 top1 / topN / all，返回数量（0 表示不限）
+func parseNoticeSelect(value string) (int, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "all" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(value, "top"))
+	if !strings.HasPrefix(value, "top") || err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// limit 指定类型最多下发的数量，0 表示不限
+func (p *noticeSelectPolicy) limit(noticeType int) int {
+	if limit, ok := p.typeLimits[noticeType]; ok {
+		return limit
+	}
+	return p.defaultLimit
+}
+
+// apply 按策略从已匹配的公告中选取，并按下发顺序排序
+func (p *noticeSelectPolicy) apply(matched []noticeEntry) []noticeEntry {
+	byType := make(map[int][]noticeEntry)
+	for _, entry := range matched {
+		byType[entry.notice.NoticeType] = append(byType[entry.notice.NoticeType], entry)
+	}
+
+	selected := make([]noticeEntry, 0, len(matched))
+	for noticeType, list := range byType {
+		// 类型内选取：优先级高的优先；优先级相同则 ID 更大的（更"新"）优先
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].notice.Priority != list[j].notice.Priority {
+				return list[i].notice.Priority > list[j].notice.Priority
+			}
+			return list[i].notice.ID > list[j].notice.ID
+		})
+		if limit := p.limit(noticeType); limit > 0 && len(list) > limit {
+			list = list[:limit]
+		}
+		selected = append(selected, list...)
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		a, b := selected[i].notice, selected[j].notice
+		if a.Sort != b.Sort {
+			return a.Sort > b.Sort
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.StartTime != b.StartTime {
+			return a.StartTime > b.StartTime
+		}
+		return a.ID > b.ID
+	})
+	if p.maxTotal > 0 && len(selected) > p.maxTotal {
+		selected = selected[:p.maxTotal]
+	}
+	return selected
+}
+
+// selectNotices 从公告条目中选出 now 时刻对指定客户端生效的公告（预览接口也使用该函数，保证结果一致）
+func selectNotices(noticeCache []noticeEntry, attrs NoticeAttrs, now int64) []db_mysql.LoginNotice {
+	matched := make([]noticeEntry, 0, len(noticeCache))
+	for _, entry := range noticeCache {
+		n := entry.notice
+		if n.StartTime <= now && n.EndTime > now && entry.match(attrs) {
+			matched = append(matched, entry)
+		}
+	}
+
+	selected := getNoticeSelectPolicy().apply(matched)
+	valid := make([]db_mysql.LoginNotice, 0, len(selected))
+	for _, entry := range selected {
+		v := localizeNotice(entry, attrs.Lang)
+		// 账号白名单只用于服务端匹配，不下发给客户端
+		v.Accounts = ""
+		valid = append(valid, v)
+	}
+	return valid
+}
@@ -0,0 +1,242 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"loginServer/config"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 公告展示/点击统计
+// 客户端通过 reportNoticeEvent 批量上报公告的展示、关闭和 Banner 点击，
+// 事件先在内存中按 (公告, 日期) 聚合，由后台协程按固定间隔累加写入 notice_stat，上报接口本身不访问数据库。
+// 写库失败的计数会放回内存下次重试；优雅关闭时在 HTTP 服务停止后写入剩余计数。
+//
+// 配置项（config.json）：
+//
+//	"notice_stat": {
+//	    "flush_interval_sec": 30, // 写库间隔，默认 30 秒
+//	    "max_events": 50          // 单次上报的最大事件数
+//	}
+
+const (
+	defaultNoticeStatFlushInterval = 30 * time.Second
+	defaultNoticeStatMaxEvents     = 50
+	noticeStatDateLayout           = "20060102"
+	defaultNoticeStatDays          = 30 // 查询统计时默认的日期范围
+)
+
+// 公告事件类型
+const (
+	NoticeEventImpression = "impression" // 展示
+	NoticeEventDismiss    = "dismiss"    // 关闭
+	NoticeEventClick      = "click"      // 点击 Banner
+)
+
+// NoticeEvent 客户端上报的公告事件
+type NoticeEvent struct {
+	NoticeID uint64 `json:"notice_id"`
+	Event    string `json:"event"` // impression / dismiss / click
+}
+
+// noticeStatKey 聚合维度
+type noticeStatKey struct {
+	noticeID uint64
+	date     int
+}
+
+// noticeStatBuffer 内存中尚未写库的计数
+type noticeStatBuffer struct {
+	mu      sync.Mutex
+	pending map[noticeStatKey]*db_mysql.NoticeStat
+
+	flushMu sync.Mutex // 串行化 flush
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+var noticeStats = &noticeStatBuffer{pending: make(map[noticeStatKey]*db_mysql.NoticeStat)}
+
+// startNoticeStats 启动统计后台写库
+func startNoticeStats() {
+	if noticeStats.stopCh != nil {
+		return
+	}
+	interval := time.Duration(config.Config.GetInt("notice_stat.flush_interval_sec")) * time.Second
+	if interval <= 0 {
+		interval = defaultNoticeStatFlushInterval
+	}
+	noticeStats.stopCh = make(chan struct{})
+	noticeStats.doneCh = make(chan struct{})
+	go noticeStats.run(interval)
+}
+
+// stopNoticeStats 停止后台写库并写入剩余计数（在 HTTP 服务停止接收请求后调用）
+func stopNoticeStats() {
+	if noticeStats.stopCh == nil {
+		return
+	}
+	close(noticeStats.stopCh)
+	<-noticeStats.doneCh
+	noticeStats.stopCh = nil
+
+	if err := noticeStats.flush(); err != nil {
+		log.Error("公告统计关闭时写入失败, 丢弃 %d 条计数, err: %v", noticeStats.size(), err)
+		return
+	}
+	log.Info("公告统计已关闭")
+}
+
+// recordNoticeEvents 记录一批公告事件，返回计入统计的事件数
+// 只统计当前已发布的公告（忽略客户端缓存的过期公告）；同一请求内相同的公告和事件只计一次
+func recordNoticeEvents(events []NoticeEvent) (int, error) {
+	maxEvents := config.Config.GetInt("notice_stat.max_events")
+	if maxEvents <= 0 {
+		maxEvents = defaultNoticeStatMaxEvents
+	}
+	if len(events) > maxEvents {
+		return 0, fmt.Errorf("单次最多上报 %d 个事件", maxEvents)
+	}
+	for _, e := range events {
+		if e.Event != NoticeEventImpression && e.Event != NoticeEventDismiss && e.Event != NoticeEventClick {
+			return 0, errors.New("未知的事件类型: " + e.Event)
+		}
+	}
+
+	data, err := GetFromCacheWithLoader(CacheKeyLoginNotice, loadLoginNotice)
+	if err != nil {
+		return 0, err
+	}
+	entries, _ := data.([]noticeEntry)
+	published := make(map[uint64]bool, len(entries))
+	for _, entry := range entries {
+		published[entry.notice.ID] = true
+	}
+
+	date := noticeStatDate(time.Now())
+	seen := make(map[NoticeEvent]bool, len(events))
+
+	noticeStats.mu.Lock()
+	defer noticeStats.mu.Unlock()
+	for _, e := range events {
+		if !published[e.NoticeID] || seen[e] {
+			continue
+		}
+		seen[e] = true
+
+		key := noticeStatKey{noticeID: e.NoticeID, date: date}
+		stat := noticeStats.pending[key]
+		if stat == nil {
+			stat = &db_mysql.NoticeStat{NoticeID: e.NoticeID, StatDate: date}
+			noticeStats.pending[key] = stat
+		}
+		switch e.Event {
+		case NoticeEventImpression:
+			stat.Impressions++
+		case NoticeEventDismiss:
+			stat.Dismisses++
+		case NoticeEventClick:
+			stat.Clicks++
+		}
+	}
+	return len(seen), nil
+}
+
+// run 后台定时写库
+func (b *noticeStatBuffer) run(interval time.Duration) {
+	defer close(b.doneCh)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.flush(); err != nil {
+				log.Error("noticeStat flush failed, pending: %d, err: %v", b.size(), err)
+			}
+		case <-b.stopCh:
+			return
+		}
+	}
+}
+
+// flush 将内存中的计数累加写入数据库，失败时放回内存
+func (b *noticeStatBuffer) flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[noticeStatKey]*db_mysql.NoticeStat)
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	list := make([]db_mysql.NoticeStat, 0, len(pending))
+	for _, stat := range pending {
+		list = append(list, *stat)
+	}
+	if err := db.AddNoticeStats(list); err != nil {
+		b.requeue(pending)
+		return err
+	}
+	return nil
+}
+
+// requeue 将写库失败的计数合并回内存
+func (b *noticeStatBuffer) requeue(pending map[noticeStatKey]*db_mysql.NoticeStat) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, older := range pending {
+		if stat := b.pending[key]; stat != nil {
+			older.Impressions += stat.Impressions
+			older.Dismisses += stat.Dismisses
+			older.Clicks += stat.Clicks
+		}
+		b.pending[key] = older
+	}
+}
+
+// size 内存中尚未写库的计数条数
+func (b *noticeStatBuffer) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// noticeStatDate 统计日期（服务器本地时间）
+func noticeStatDate(t time.Time) int {
+	date, _ := strconv.Atoi(t.Format(noticeStatDateLayout))
+	return date
+}
+
+// parseNoticeStatRange 解析统计日期范围（yyyymmdd），默认最近 30 天
+func parseNoticeStatRange(start, end string) (int, int, error) {
+	endTime := time.Now()
+	if end != "" {
+		t, err := time.ParseInLocation(noticeStatDateLayout, end, time.Local)
+		if err != nil {
+			return 0, 0, errors.New("end_date 格式错误，应为 yyyymmdd")
+		}
+		endTime = t
+	}
+	startTime := endTime.AddDate(0, 0, 1-defaultNoticeStatDays)
+	if start != "" {
+		t, err := time.ParseInLocation(noticeStatDateLayout, start, time.Local)
+		if err != nil {
+			return 0, 0, errors.New("start_date 格式错误，应为 yyyymmdd")
+		}
+		startTime = t
+	}
+	if startTime.After(endTime) {
+		return 0, 0, errors.New("start_date 不能晚于 end_date")
+	}
+	return noticeStatDate(startTime), noticeStatDate(endTime), nil
+}
@@ -0,0 +1,241 @@
+package request
+
+import (
+	"fmt"
+	"loginServer/src/db/db_mysql"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 公告定向投放
+// 公告的定向条件在加载到缓存时预先解析，客户端请求时只做集合查找和版本比较
+
+// NoticeAttrs 客户端请求公告时携带的属性（均为可选）
+type NoticeAttrs struct {
+	Platform  string // 平台：ios / android / pc
+	Channel   string // 渠道
+	Version   []int  // 客户端版本（已解析）
+	ClusterID int64  // 当前选择的集群
+	Lang      string // 语言，如 zh-CN
+	AccountID string // 账号（只取自 Authorization 中经过校验的 token，见 req_auth.go）
+}
+
+// noticeEntry 缓存中的公告及其预解析的定向条件（nil 表示不限）
+type noticeEntry struct {
+	notice     db_mysql.LoginNotice
+	platforms  map[string]bool
+	channels   map[string]bool
+	minVersion []int
+	maxVersion []int
+	clusterIDs map[int64]bool
+	languages  []string
+	accounts   map[string]bool
+
+	translations map[string]db_mysql.LoginNoticeI18n // 语言 -> 翻译
+}
+
+// parseNoticeAttrs 从请求参数中读取客户端属性
+// GET /loginServer/getLoginNotice?platform=ios&channel=appstore&version=1.2.0&cluster_id=1&lang=zh-CN
+// lang 未传时从 Accept-Language 中选择；账号定向只使用 Authorization 中经过校验的账号，不接受 account_id 参数
+func parseNoticeAttrs(c *gin.Context) NoticeAttrs {
+	attrs := NoticeAttrs{
+		Platform:  strings.ToLower(strings.TrimSpace(c.Query("platform"))),
+		Channel:   strings.ToLower(strings.TrimSpace(c.Query("channel"))),
+		Lang:      normalizeLang(c.Query("lang")),
+		AccountID: authenticatedAccountID(c),
+	}
+	if version, err := parseVersion(c.Query("version")); err == nil {
+		attrs.Version = version
+	}
+	if clusterID, err := strconv.ParseInt(c.Query("cluster_id"), 10, 64); err == nil {
+		attrs.ClusterID = clusterID
+	}
+	if attrs.Lang == "" {
+		attrs.Lang = pickAcceptLanguage(c.GetHeader("Accept-Language"))
+	}
+	return attrs
+}
+
+// compileNotice 解析公告的定向条件，条件格式错误时返回具体原因
+func compileNotice(notice db_mysql.LoginNotice) (noticeEntry, error) {
+	entry := noticeEntry{
+		notice:    notice,
+		platforms: splitSet(notice.Platforms),
+		channels:  splitSet(notice.Channels),
+		accounts:  splitSetKeepCase(notice.Accounts),
+	}
+
+	var err error
+	if entry.minVersion, err = parseVersion(notice.MinVersion); err != nil {
+		return entry, fmt.Errorf("min_version 格式错误: %s", notice.MinVersion)
+	}
+	if entry.maxVersion, err = parseVersion(notice.MaxVersion); err != nil {
+		return entry, fmt.Errorf("max_version 格式错误: %s", notice.MaxVersion)
+	}
+	if entry.minVersion != nil && entry.maxVersion != nil && compareVersion(entry.minVersion, entry.maxVersion) > 0 {
+		return entry, fmt.Errorf("min_version(%s) 不能大于 max_version(%s)", notice.MinVersion, notice.MaxVersion)
+	}
+
+	for _, item := range splitList(notice.ClusterIDs) {
+		clusterID, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			return entry, fmt.Errorf("cluster_ids 包含非数字: %s", item)
+		}
+		if entry.clusterIDs == nil {
+			entry.clusterIDs = make(map[int64]bool)
+		}
+		entry.clusterIDs[clusterID] = true
+	}
+
+	for _, item := range splitList(notice.Languages) {
+		entry.languages = append(entry.languages, normalizeLang(item))
+	}
+	return entry, nil
+}
+
+// match 判断客户端属性是否满足公告的全部定向条件
+// 公告限制了某个条件而客户端没有携带对应属性时，视为不匹配
+func (e noticeEntry) match(attrs NoticeAttrs) bool {
+	if e.platforms != nil && !e.platforms[attrs.Platform] {
+		return false
+	}
+	if e.channels != nil && !e.channels[attrs.Channel] {
+		return false
+	}
+	if e.minVersion != nil || e.maxVersion != nil {
+		if attrs.Version == nil {
+			return false
+		}
+		if e.minVersion != nil && compareVersion(attrs.Version, e.minVersion) < 0 {
+			return false
+		}
+		if e.maxVersion != nil && compareVersion(attrs.Version, e.maxVersion) > 0 {
+			return false
+		}
+	}
+	if e.clusterIDs != nil && !e.clusterIDs[attrs.ClusterID] {
+		return false
+	}
+	if e.languages != nil && !matchLang(e.languages, attrs.Lang) {
+		return false
+	}
+	if e.accounts != nil && !e.accounts[attrs.AccountID] {
+		return false
+	}
+	return true
+}
+
+// normalizeNoticeTarget 规范化公告的定向条件（去空格、去重、统一大小写），并校验格式
+func normalizeNoticeTarget(notice *db_mysql.LoginNotice) error {
+	notice.Platforms = joinList(splitList(strings.ToLower(notice.Platforms)))
+	notice.Channels = joinList(splitList(strings.ToLower(notice.Channels)))
+	notice.MinVersion = strings.TrimSpace(notice.MinVersion)
+	notice.MaxVersion = strings.TrimSpace(notice.MaxVersion)
+	notice.ClusterIDs = joinList(splitList(notice.ClusterIDs))
+	notice.Accounts = joinList(splitList(notice.Accounts))
+
+	languages := splitList(notice.Languages)
+	for i, lang := range languages {
+		languages[i] = normalizeLang(lang)
+	}
+	notice.Languages = joinList(languages)
+
+	_, err := compileNotice(*notice)
+	return err
+}
+
+// matchLang 语言匹配：zh 匹配 zh、zh-cn、zh-tw；zh-tw 只匹配 zh-tw
+func matchLang(languages []string, lang string) bool {
+	if lang == "" {
+		return false
+	}
+	for _, l := range languages {
+		if lang == l || strings.HasPrefix(lang, l+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLang 语言标签统一为小写、以 - 分隔（zh_CN -> zh-cn）
+func normalizeLang(lang string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(lang)), "_", "-")
+}
+
+// parseVersion 解析点分版本号（如 1.2.10，允许 v 前缀），空字符串返回 nil
+func parseVersion(version string) ([]int, error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if version == "" {
+		return nil, nil
+	}
+	parts := strings.Split(version, ".")
+	result := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version: %s", version)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// compareVersion 按段比较版本号，缺失的段视为 0（1.2 == 1.2.0）
+func compareVersion(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// splitList 拆分逗号分隔的列表：去空格、去空项、去重，保持原有顺序
+func splitList(value string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		result = append(result, item)
+	}
+	return result
+}
+
+// joinList 合并为逗号分隔的列表
+func joinList(items []string) string {
+	return strings.Join(items, ",")
+}
+
+// splitSet 拆分为小写集合，空列表返回 nil（表示不限）
+func splitSet(value string) map[string]bool {
+	return splitSetKeepCase(strings.ToLower(value))
+}
+
+// splitSetKeepCase 拆分为集合（保留大小写），空列表返回 nil（表示不限）
+func splitSetKeepCase(value string) map[string]bool {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
@@ -0,0 +1,97 @@
+package request
+
+import (
+	"errors"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"slices"
+)
+
+// 公告审核流程
+// 草稿 -> 待审核 -> 已审核 -> 已发布 -> 已归档，只有已发布的公告会加载到缓存下发给客户端。
+// 审核必须由提交人、最后修改人以外的第二个人完成；每次修改和状态变化都会保存一份修订快照，可恢复到任意版本。
+// 发布前可以通过预览接口查看指定客户端属性下 getLoginNotice 的实际返回结果。
+
+// NoticePreview 公告预览结果
+type NoticePreview struct {
+	Visible bool                   `json:"visible"`          // 该公告是否会下发给该客户端
+	Reason  string                 `json:"reason,omitempty"` // 不会下发的原因
+	Notice  db_mysql.LoginNotice   `json:"notice"`           // 按客户端语言渲染后的公告
+	List    []db_mysql.LoginNotice `json:"list"`             // 客户端将收到的完整公告列表
+}
+
+// previewNotice 预览公告：假设该公告（或其指定修订版本）已发布，计算 now 时刻该客户端从 getLoginNotice 收到的结果
+// 其它公告使用当前缓存（即线上实际生效的公告）
+func previewNotice(id uint64, revision int, attrs NoticeAttrs, now int64) (NoticePreview, error) {
+	notice, err := db.FindLoginNotice(id)
+	if err != nil {
+		return NoticePreview{}, err
+	}
+	if notice.ID == 0 {
+		return NoticePreview{}, errors.New("公告不存在")
+	}
+	var translations []db_mysql.LoginNoticeI18n
+	if revision > 0 {
+		rev, err := db.FindNoticeRevision(id, revision)
+		if err != nil {
+			return NoticePreview{}, err
+		}
+		snapshot, err := db_mysql.ParseNoticeSnapshot(rev.Snapshot)
+		if err != nil {
+			return NoticePreview{}, err
+		}
+		notice, translations = snapshot.LoginNotice, snapshot.Translations
+	}
+
+	entry, err := compileNotice(notice)
+	if err != nil {
+		return NoticePreview{Reason: "定向条件错误: " + err.Error(), Notice: notice, List: []db_mysql.LoginNotice{}}, nil
+	}
+	preview := []noticeEntry{entry}
+	if translations == nil {
+		// 当前内容或旧版本的快照（没有保存翻译）使用当前翻译
+		if err := attachNoticeTranslations(preview); err != nil {
+			return NoticePreview{}, err
+		}
+	} else {
+		preview[0].translations = make(map[string]db_mysql.LoginNoticeI18n, len(translations))
+		for _, item := range translations {
+			preview[0].translations[normalizeLang(item.Locale)] = item
+		}
+	}
+	renderNoticeEntries(preview)
+	entry = preview[0]
+
+	data, err := GetFromCacheWithLoader(CacheKeyLoginNotice, loadLoginNotice)
+	if err != nil {
+		return NoticePreview{}, err
+	}
+	cached, _ := data.([]noticeEntry)
+	entries := make([]noticeEntry, 0, len(cached)+1)
+	for _, e := range cached {
+		if e.notice.ID != id {
+			entries = append(entries, e)
+		}
+	}
+	entries = append(entries, entry)
+
+	result := NoticePreview{
+		Notice: localizeNotice(entry, attrs.Lang),
+		List:   selectNotices(entries, attrs, now),
+	}
+	result.Notice.Accounts = ""
+	result.Visible = slices.ContainsFunc(result.List, func(n db_mysql.LoginNotice) bool { return n.ID == id })
+	if !result.Visible {
+		switch {
+		case now < notice.StartTime:
+			result.Reason = "未到开始时间"
+		case now >= notice.EndTime:
+			result.Reason = "已过结束时间"
+		case !entry.match(attrs):
+			result.Reason = "定向条件不匹配"
+		default:
+			result.Reason = "未被选取策略选中（同类型中有优先级更高的公告，或超过合计数量）"
+		}
+	}
+	return result, nil
+}
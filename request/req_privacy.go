@@ -0,0 +1,340 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginServer/config"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 账号数据导出与删除（隐私合规）
+// 导出：汇总账号在登录服保存的全部数据（玩家历史、账号状态、角色索引、审计记录、删除申请）
+// 删除：申请后进入冷静期，冷静期内可撤销；到期后由定时任务通知相关游戏服，再删除/匿名化数据，
+// 并在 erasure_log 中追加一条哈希链记录作为删除凭证
+//
+// 配置项（config.json）：
+//
+//	"privacy": {
+//	    "cooling_off_hours": 168,                              // 冷静期（小时），默认 7 天
+//	    "erasure_cron": "0 */10 * * * *",                      // 执行到期申请的定时任务
+//	    "callback_url": "http://{addr}:{port}/account/erase",  // 通知游戏服的地址模板，支持 {addr} {port} {cluster_id} {game_id}，为空时不通知
+//	    "callback_timeout_ms": 3000,                           // 单次通知超时
+//	    "notify_max_retry": 5,                                 // 通知失败的最大尝试次数，超过后仍执行删除并记录失败的游戏服
+//	    "hash_salt": ""                                        // 账号摘要的盐
+//	}
+
+const (
+	defaultCoolingOffHours    = 7 * 24
+	defaultErasureSpec        = "0 */10 * * * *"
+	defaultCallbackTimeout    = 3 * time.Second
+	defaultErasureNotifyRetry = 5
+	erasureBatchSize          = 100
+)
+
+// 审计操作类型
+const (
+	auditActionSetState       = "set_state"
+	auditActionRemoveRole     = "remove_role"
+	auditActionExport         = "export"
+	auditActionErasureRequest = "erasure_request"
+	auditActionErasureCancel  = "erasure_cancel"
+)
+
+// AccountExport 账号数据导出内容
+type AccountExport struct {
+	AccountID    string                       `json:"account_id"`
+	ExportedAt   int64                        `json:"exported_at"`
+	Exists       bool                         `json:"exists"`        // 玩家历史表中是否存在该账号
+	State        int                          `json:"state"`         // 账号状态
+	PlayerList   []db_mysql.PlayerHistoryItem `json:"player_list"`   // 角色记录
+	LoginRecords []LoginRecord                `json:"login_records"` // 登录记录（各游戏服最后登录时间）
+	PlayerIndex  []db_mysql.PlayerIndex       `json:"player_index"`
+	Audits       []db_mysql.AccountAudit      `json:"audits"`
+	Erasures     []db_mysql.AccountErasure    `json:"erasures"`
+	Info         *string                      `json:"info"`
+}
+
+// LoginRecord 登录记录（登录服只保存每个游戏服的最后一次登录）
+type LoginRecord struct {
+	ClusterID     int   `json:"cluster_id"`
+	GameID        int   `json:"game_id"`
+	PlayerID      int64 `json:"player_id"`
+	LastLoginTime int64 `json:"last_login_time"`
+}
+
+// ErasureNotifyResult 单个游戏服的通知结果
+type ErasureNotifyResult struct {
+	ClusterID int    `json:"cluster_id"`
+	GameID    int    `json:"game_id"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+}
+
+// addAccountAudit 写入审计记录，失败只记录日志（不影响业务）
+func addAccountAudit(accountID, action, operator, detail string) {
+	err := db.AddAccountAudit(db_mysql.AccountAudit{
+		AccountID: accountID,
+		Action:    action,
+		Operator:  operator,
+		Detail:    detail,
+	})
+	if err != nil {
+		log.Error("addAccountAudit failed, account: %s, action: %s, err: %v", accountID, action, err)
+	}
+}
+
+// exportAccount 导出账号的全部数据（直接读 MySQL，不走缓存；先写入该账号在写缓冲中尚未落库的更新）
+func exportAccount(accountID string) (AccountExport, error) {
+	if err := flushAccountHistory(accountID); err != nil {
+		return AccountExport{}, err
+	}
+	history, exists, err := db_mysql.FindUserHistory(accountID)
+	if err != nil {
+		return AccountExport{}, err
+	}
+	index, err := db.GetPlayerIndexByAccount(accountID)
+	if err != nil {
+		return AccountExport{}, err
+	}
+	audits, err := db.GetAccountAudits(accountID)
+	if err != nil {
+		return AccountExport{}, err
+	}
+	erasures, err := db.GetAccountErasures(accountID)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	export := AccountExport{
+		AccountID:    accountID,
+		ExportedAt:   time.Now().Unix(),
+		Exists:       exists,
+		State:        history.State,
+		PlayerList:   history.PlayerList,
+		LoginRecords: make([]LoginRecord, 0, len(history.PlayerList)),
+		PlayerIndex:  index,
+		Audits:       audits,
+		Erasures:     erasures,
+		Info:         history.Info,
+	}
+	for _, item := range history.PlayerList {
+		if item.LastLoginTime == 0 {
+			continue
+		}
+		export.LoginRecords = append(export.LoginRecords, LoginRecord{
+			ClusterID:     item.ClusterID,
+			GameID:        item.GameID,
+			PlayerID:      item.PlayerID,
+			LastLoginTime: item.LastLoginTime,
+		})
+	}
+	return export, nil
+}
+
+// requestErasure 创建删除申请，冷静期结束后才会执行
+func requestErasure(accountID, operator, reason string) (db_mysql.AccountErasure, error) {
+	hours := config.Config.GetInt("privacy.cooling_off_hours")
+	if hours <= 0 {
+		hours = defaultCoolingOffHours
+	}
+
+	erasure := db_mysql.AccountErasure{
+		AccountID:    accountID,
+		AccountHash:  db_mysql.AccountHash(accountID),
+		Reason:       reason,
+		Operator:     operator,
+		ExecuteAfter: time.Now().Add(time.Duration(hours) * time.Hour).Unix(),
+	}
+	if err := db.CreateAccountErasure(&erasure); err != nil {
+		return erasure, err
+	}
+	addAccountAudit(accountID, auditActionErasureRequest, operator, reason)
+	return erasure, nil
+}
+
+// cancelErasure 撤销冷静期中的删除申请
+func cancelErasure(id uint64, operator string) (db_mysql.AccountErasure, error) {
+	erasure, err := db.CancelAccountErasure(id, operator)
+	if err != nil {
+		return erasure, err
+	}
+	addAccountAudit(erasure.AccountID, auditActionErasureCancel, operator, strconv.FormatUint(id, 10))
+	return erasure, nil
+}
+
+// runDueErasures 执行所有冷静期已结束的删除申请，返回执行成功的数量
+// 单个申请失败不影响其它申请，下次定时任务会重试
+func runDueErasures() (int, error) {
+	done := 0
+	var lastID uint64
+	var lastErr error
+	for {
+		list, err := db.GetDueErasures(time.Now().Unix(), lastID, erasureBatchSize)
+		if err != nil {
+			return done, err
+		}
+
+		for _, erasure := range list {
+			lastID = erasure.ID
+			ok, err := executeErasure(erasure)
+			if err != nil {
+				log.Error("executeErasure failed, id: %d, err: %v", erasure.ID, err)
+				lastErr = err
+				continue
+			}
+			if ok {
+				done++
+			}
+		}
+		if len(list) < erasureBatchSize {
+			return done, lastErr
+		}
+	}
+}
+
+// executeErasure 执行单个删除申请
+// 先通知相关游戏服；通知失败且未超过重试次数时保留申请等待下次重试（返回 false）
+// 通知列表直接读 MySQL，先写入该账号在写缓冲中尚未落库的更新，避免刚上报的角色漏通知
+func executeErasure(erasure db_mysql.AccountErasure) (bool, error) {
+	if err := flushAccountHistory(erasure.AccountID); err != nil {
+		return false, err
+	}
+	history, _, err := db_mysql.FindUserHistory(erasure.AccountID)
+	if err != nil {
+		return false, err
+	}
+
+	results := notifyErasure(erasure.AccountID, history.PlayerList)
+	resultData, _ := json.Marshal(results)
+	failed := 0
+	for _, result := range results {
+		if !result.OK {
+			failed++
+		}
+	}
+
+	maxRetry := config.Config.GetInt("privacy.notify_max_retry")
+	if maxRetry <= 0 {
+		maxRetry = defaultErasureNotifyRetry
+	}
+	if failed > 0 && erasure.Attempts+1 < maxRetry {
+		return false, db.SetErasureNotifyFailed(erasure.ID, string(resultData))
+	}
+
+	summary, _ := json.Marshal(map[string]any{
+		"roles":          len(history.PlayerList),
+		"servers":        len(results),
+		"notify_failed":  failed,
+		"requested_at":   erasure.CreatedAt,
+		"requested_by":   erasure.Operator,
+		"execute_after":  erasure.ExecuteAfter,
+		"notify_attempt": erasure.Attempts + 1,
+	})
+
+	// 与写缓冲的 flush 串行，并丢弃该账号尚未落库的更新，避免删除后又被写回
+	var entry db_mysql.ErasureLog
+	err = withHistoryFlushLock(func() error {
+		discardAccountHistory(erasure.AccountID)
+		var err error
+		entry, err = db.ExecuteAccountErasure(erasure, string(summary), string(resultData))
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 已被撤销或已被其它实例执行
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	log.Info("账号数据删除完成, erasure_id: %d, account_hash: %s, log_id: %d, notify_failed: %d",
+		erasure.ID, erasure.AccountHash, entry.ID, failed)
+	return true, nil
+}
+
+// notifyErasure 通知账号涉及的游戏服删除角色数据（每个游戏服一次）
+// 未配置 privacy.callback_url 时不通知
+func notifyErasure(accountID string, list []db_mysql.PlayerHistoryItem) []ErasureNotifyResult {
+	tmpl := config.Config.GetString("privacy.callback_url")
+	results := make([]ErasureNotifyResult, 0, len(list))
+	if tmpl == "" {
+		return results
+	}
+
+	timeout := time.Duration(config.Config.GetInt("privacy.callback_timeout_ms")) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultCallbackTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	// 地址模板依赖游戏服地址时，已不存在的游戏服无需通知
+	needServer := strings.Contains(tmpl, "{addr}") || strings.Contains(tmpl, "{port}")
+	for _, item := range list {
+		result := ErasureNotifyResult{ClusterID: item.ClusterID, GameID: item.GameID}
+		server, ok := GetServer(int64(item.ClusterID), int64(item.GameID))
+		if needServer && (!ok || server.Addr == nil || server.Port == nil) {
+			result.OK = true
+			result.Error = "server not found, skipped"
+			results = append(results, result)
+			continue
+		}
+
+		url := strings.NewReplacer(
+			"{addr}", derefString(server.Addr),
+			"{port}", strconv.Itoa(derefInt(server.Port)),
+			"{cluster_id}", strconv.Itoa(item.ClusterID),
+			"{game_id}", strconv.Itoa(item.GameID),
+		).Replace(tmpl)
+		body, _ := json.Marshal(map[string]any{
+			"action":     "erase",
+			"account_id": accountID,
+			"cluster_id": item.ClusterID,
+			"game_id":    item.GameID,
+			"player_id":  item.PlayerID,
+		})
+
+		if err := postErasureCallback(client, url, body); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.OK = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// postErasureCallback 发送删除通知，HTTP 2xx 视为成功
+func postErasureCallback(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefInt(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
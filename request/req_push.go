@@ -0,0 +1,399 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"loginServer/config"
+	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
+	"loginServer/src/log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 实时推送
+// 客户端通过 GET /loginServer/events（SSE）建立长连接，接收以下事件：
+//   - server:    服务器状态/显示变化（来自游戏服上报和后台修改）
+//   - notice:    公告发布
+//   - marquee:   跑马灯消息（后台发送）
+//   - broadcast: 广播消息（后台发送）
+//   - reset:     断线期间的事件已无法补发，客户端应重新拉取服务器列表和公告
+//
+// 每个事件带递增 ID，客户端断线重连时携带 Last-Event-ID（或 last_event_id 参数），服务端补发缓冲中之后的事件。
+// 配置了 Redis 时，事件通过 Redis 频道分发到所有实例，任一实例产生的事件所有实例上的客户端都能收到；
+// 事件 ID 在发布时由 Redis 原子分配（分配序号和发布在同一个脚本内执行），频道上的顺序与 ID 顺序一致，
+// 所有实例使用同一个序列。未配置 Redis 时只推送给本实例的客户端，事件 ID 由本实例分配。
+// 发布到 Redis 在后台协程中按产生顺序进行，不阻塞调用方（如游戏服上报）；发布失败的事件无法补发，
+// 本实例的连接会收到 reset。
+// 客户端接收过慢（待发送队列已满）时断开连接，客户端携带游标重连即可补发。
+//
+// 配置项（config.json）：
+//
+//	"push": {
+//	    "max_conns": 10000,  // 单实例最大连接数，超过时返回 503
+//	    "heartbeat_sec": 15, // 心跳间隔
+//	    "buffer_size": 1000, // 用于断线补发的事件缓冲条数
+//	    "client_queue": 64   // 单个连接的待发送队列长度
+//	}
+
+const (
+	defaultPushMaxConns    = 10000
+	defaultPushHeartbeat   = 15
+	defaultPushBufferSize  = 1000
+	defaultPushClientQueue = 64
+	pushRetryMs            = 3000 // 建议客户端的重连间隔
+
+	pushChannel    = "loginServer:push"     // 实例间分发事件的 Redis 频道
+	pushSeqKey     = "loginServer:push:seq" // 事件 ID 计数器
+	pushOutboxSize = 1024                   // 待发布到 Redis 的事件队列长度
+)
+
+// 推送事件类型
+const (
+	PushEventServer    = "server"
+	PushEventNotice    = "notice"
+	PushEventMarquee   = "marquee"
+	PushEventBroadcast = "broadcast"
+	PushEventReset     = "reset"
+)
+
+var (
+	errPushFull   = errors.New("push connections full")
+	errPushClosed = errors.New("push closed")
+)
+
+// PushEvent 推送事件
+type PushEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	ClusterID int64           `json:"cluster_id,omitempty"` // 只推送给选择了该集群的客户端，0 表示全部
+	Data      json.RawMessage `json:"data"`
+}
+
+// PushServerState 服务器变化事件中的单个服务器
+type PushServerState struct {
+	ClusterID int64  `json:"cluster_id"`
+	GameID    int64  `json:"game_id"`
+	Name      string `json:"name"`
+	State     int    `json:"state"`
+	IsShow    int    `json:"is_show"`
+}
+
+// pushClient 一个推送连接
+type pushClient struct {
+	clusterID int64 // 客户端选择的集群，0 表示接收全部
+	ch        chan PushEvent
+}
+
+// wants 客户端是否需要该事件
+func (c *pushClient) wants(event PushEvent) bool {
+	return event.ClusterID == 0 || c.clusterID == 0 || event.ClusterID == c.clusterID
+}
+
+// pushHub 管理本实例的推送连接和最近事件
+type pushHub struct {
+	mu      sync.Mutex
+	clients map[*pushClient]struct{}
+	buffer  []PushEvent // 最近的事件，按收到的顺序
+	lastID  int64
+	closed  bool
+
+	maxConns    int
+	bufferSize  int
+	clientQueue int
+
+	outbox   chan PushEvent // 待发布到 Redis 的事件，由 sendLoop 按顺序发布
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	sendDone chan struct{}
+}
+
+var pushes = &pushHub{
+	clients:     make(map[*pushClient]struct{}),
+	outbox:      make(chan PushEvent, pushOutboxSize),
+	maxConns:    defaultPushMaxConns,
+	bufferSize:  defaultPushBufferSize,
+	clientQueue: defaultPushClientQueue,
+}
+
+// startPush 启动推送：读取配置，配置了 Redis 时订阅实例间的事件频道
+func startPush() {
+	if pushes.stopCh != nil {
+		return
+	}
+	pushes.mu.Lock()
+	pushes.maxConns = configIntDefault("push.max_conns", defaultPushMaxConns)
+	pushes.bufferSize = configIntDefault("push.buffer_size", defaultPushBufferSize)
+	pushes.clientQueue = configIntDefault("push.client_queue", defaultPushClientQueue)
+	pushes.closed = false
+	pushes.mu.Unlock()
+
+	pushes.stopCh = make(chan struct{})
+	pushes.doneCh = make(chan struct{})
+	pushes.sendDone = make(chan struct{})
+	if !db.BroadcastEnabled() {
+		close(pushes.doneCh)
+		close(pushes.sendDone)
+		return
+	}
+	go pushes.sendLoop()
+	go func() {
+		defer close(pushes.doneCh)
+		subscribed := false
+		db.SubscribeMessages(pushes.stopCh, pushChannel, func() {
+			// 重新订阅：断开期间的事件已丢失，通知客户端重新拉取
+			if subscribed {
+				log.Warn("推送频道重新订阅，通知客户端重新拉取")
+				pushes.resetAll()
+			}
+			subscribed = true
+		}, pushes.receive)
+	}()
+}
+
+// stopPush 停止推送并断开所有连接（在 HTTP 服务关闭前调用，避免长连接阻塞关闭）
+func stopPush() {
+	if pushes.stopCh == nil {
+		return
+	}
+	close(pushes.stopCh)
+	<-pushes.doneCh
+	<-pushes.sendDone
+	pushes.stopCh = nil
+
+	pushes.mu.Lock()
+	defer pushes.mu.Unlock()
+	pushes.closed = true
+	for client := range pushes.clients {
+		delete(pushes.clients, client)
+		close(client.ch)
+	}
+}
+
+// configIntDefault 读取正整数配置，未配置或非正数时返回默认值
+func configIntDefault(key string, def int) int {
+	if v := config.Config.GetInt(key); v > 0 {
+		return v
+	}
+	return def
+}
+
+// publishPushEvent 发布事件（不阻塞）
+// 配置了 Redis 时放入发布队列，经 Redis 分发到所有实例（包括本实例）；未配置 Redis 时直接推送给本实例的客户端
+func publishPushEvent(eventType string, clusterID int64, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Error("publishPushEvent marshal failed, type: %s, err: %v", eventType, err)
+		return
+	}
+	event := PushEvent{Type: eventType, ClusterID: clusterID, Data: payload}
+
+	if !db.BroadcastEnabled() {
+		pushes.deliver(event)
+		return
+	}
+	select {
+	case pushes.outbox <- event:
+	default:
+		log.Warn("推送事件发布队列已满，丢弃事件, type: %s, cluster_id: %d", eventType, clusterID)
+	}
+}
+
+// sendLoop 按产生顺序将事件发布到 Redis；停止时发布完队列中剩余的事件（Redis 不可用时放弃）
+func (h *pushHub) sendLoop() {
+	defer close(h.sendDone)
+	for {
+		select {
+		case event := <-h.outbox:
+			h.send(event)
+		case <-h.stopCh:
+			for {
+				select {
+				case event := <-h.outbox:
+					if !h.send(event) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send 发布一个事件，ID 由 Redis 在发布时分配；失败时该事件无法补发，通知本实例的连接重新拉取
+func (h *pushHub) send(event PushEvent) bool {
+	payload, err := json.Marshal(event)
+	if err == nil {
+		_, err = db.PublishSequenced(pushSeqKey, pushChannel, payload, 0)
+	}
+	if err != nil {
+		log.Warn("推送事件发布到 Redis 失败，通知本实例的连接重新拉取, type: %s, err: %v", event.Type, err)
+		h.resetAll()
+		return false
+	}
+	return true
+}
+
+// receive 处理 Redis 频道收到的事件（"ID|事件"）
+func (h *pushHub) receive(payload string) {
+	idText, body, _ := strings.Cut(payload, "|")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	var event PushEvent
+	if err != nil || id <= 0 || json.Unmarshal([]byte(body), &event) != nil {
+		log.Warn("推送频道收到无效消息: %s", payload)
+		return
+	}
+	event.ID = id
+	h.deliver(event)
+}
+
+// deliver 记录事件并推送给本实例的连接
+// 未配置 Redis 时事件 ID 为 0，按本实例序号分配；配置了 Redis 时 ID 已由 Redis 分配
+func (h *pushHub) deliver(event PushEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if event.ID == 0 {
+		event.ID = h.lastID + 1
+	} else if event.ID <= h.lastID {
+		// Redis 中的计数器被重置（如数据丢失），缓冲中的事件已无法按 ID 补发
+		log.Warn("推送事件 ID 回退: %d -> %d，清空事件缓冲", h.lastID, event.ID)
+		h.buffer = h.buffer[:0]
+	}
+	h.lastID = event.ID
+
+	if len(h.buffer) >= h.bufferSize {
+		n := copy(h.buffer, h.buffer[len(h.buffer)-h.bufferSize+1:])
+		h.buffer = h.buffer[:n]
+	}
+	h.buffer = append(h.buffer, event)
+
+	for client := range h.clients {
+		if !client.wants(event) {
+			continue
+		}
+		select {
+		case client.ch <- event:
+		default:
+			// 接收过慢：断开连接，由客户端携带游标重连补发
+			delete(h.clients, client)
+			close(client.ch)
+		}
+	}
+}
+
+// resetAll 清空事件缓冲并通知所有连接重新拉取
+func (h *pushHub) resetAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buffer = h.buffer[:0]
+	reset := PushEvent{ID: h.lastID, Type: PushEventReset, Data: json.RawMessage("{}")}
+	for client := range h.clients {
+		select {
+		case client.ch <- reset:
+		default:
+			delete(h.clients, client)
+			close(client.ch)
+		}
+	}
+}
+
+// register 注册连接，返回需要先补发的事件
+// hasCursor 为 true 时补发 cursor 之后的事件；缓冲已无法覆盖时返回一个 reset 事件
+func (h *pushHub) register(clusterID, cursor int64, hasCursor bool) (*pushClient, []PushEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, nil, errPushClosed
+	}
+	if len(h.clients) >= h.maxConns {
+		return nil, nil, errPushFull
+	}
+
+	client := &pushClient{clusterID: clusterID, ch: make(chan PushEvent, h.clientQueue)}
+	h.clients[client] = struct{}{}
+
+	backlog := make([]PushEvent, 0)
+	if !hasCursor || cursor == h.lastID {
+		return client, backlog, nil
+	}
+	covered := len(h.buffer) > 0 && h.buffer[0].ID <= cursor+1 && cursor < h.lastID
+	if !covered {
+		backlog = append(backlog, PushEvent{ID: h.lastID, Type: PushEventReset, Data: json.RawMessage("{}")})
+		return client, backlog, nil
+	}
+	for _, event := range h.buffer {
+		if event.ID > cursor && client.wants(event) {
+			backlog = append(backlog, event)
+		}
+	}
+	return client, backlog, nil
+}
+
+// unregister 注销连接
+func (h *pushHub) unregister(client *pushClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.ch)
+	}
+}
+
+// PushStats 推送状态
+type PushStats struct {
+	Conns    int   `json:"conns"`
+	MaxConns int   `json:"max_conns"`
+	LastID   int64 `json:"last_id"`
+	Buffered int   `json:"buffered"`
+}
+
+// stats 当前推送状态
+func (h *pushHub) stats() PushStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return PushStats{Conns: len(h.clients), MaxConns: h.maxConns, LastID: h.lastID, Buffered: len(h.buffer)}
+}
+
+// writePushEvent 按 SSE 格式写出事件
+func writePushEvent(w io.Writer, event PushEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
+
+// publishServerChanges 推送服务器状态/显示变化，按集群拆分为多个事件
+func publishServerChanges(servers []db_mysql.GameList) {
+	byCluster := make(map[int64][]PushServerState)
+	clusters := make([]int64, 0)
+	for _, server := range servers {
+		if _, ok := byCluster[server.ClusterID]; !ok {
+			clusters = append(clusters, server.ClusterID)
+		}
+		byCluster[server.ClusterID] = append(byCluster[server.ClusterID], PushServerState{
+			ClusterID: server.ClusterID,
+			GameID:    server.GameID,
+			Name:      derefString(server.Name),
+			State:     derefInt(server.State),
+			IsShow:    derefInt(server.IsShow),
+		})
+	}
+	for _, clusterID := range clusters {
+		publishPushEvent(PushEventServer, clusterID, map[string]any{"servers": byCluster[clusterID]})
+	}
+}
+
+// publishNoticePublished 推送公告发布事件
+// 事件广播给所有连接，不区分定向条件，只携带公告 ID 和类型，不含标题等内容：
+// 客户端收到后重新调用 getLoginNotice，由服务端按定向条件决定是否下发
+func publishNoticePublished(notice db_mysql.LoginNotice) {
+	publishPushEvent(PushEventNotice, 0, map[string]any{
+		"notice_id":   notice.ID,
+		"notice_type": notice.NoticeType,
+	})
+}
@@ -42,17 +42,24 @@ const (
 	PathDecodeJwt = "/loginServer/test/decodeJwt" // 解码JWT
 
 	// out 分组
-	PathGetServerList        = "/loginServer/getServerList"       // 获取服务器列表
-	PathGetPlayerServerList  = "/loginServer/getPlayerServerList" // 获取玩家服务器列表
-	PathClientGetLoginNotice = "/loginServer/getLoginNotice"      // 客户端获取登录公告
+	PathGetServerList        = "/loginServer/getServerList"        // 获取服务器列表
+	PathGetPlayerServerList  = "/loginServer/getPlayerServerList"  // 获取玩家服务器列表
+	PathClientGetLoginNotice = "/loginServer/getLoginNotice"       // 客户端获取登录公告
+	PathReportNoticeEvent    = "/loginServer/reportNoticeEvent"    // 客户端上报公告展示/关闭/点击 (POST)
+	PathGetServerListDelta   = "/loginServer/getServerListDelta"   // 增量获取服务器列表
+	PathGetServerListGrouped = "/loginServer/getServerListGrouped" // 按显示分组获取服务器列表
+	PathPushEvents           = "/loginServer/events"               // 实时推送 (SSE)
 
 	// sgame 分组
-	PathTest              = "/loginServer/test"              // 测试接口（GET）
-	PathTestPost          = "/loginServer/testPost"          // 测试接口（POST）
-	PathReportServerList  = "/loginServer/reportServerList"  // 游戏服上报服务器列表
-	PathChangeServerState = "/loginServer/changeServerState" // 游戏服服务器状态变更
-	PathSetUserHistory    = "/loginServer/setUserHistory"    // 玩家信息设置
-	PathSetUserState      = "/loginServer/setUserState"      // 玩家账号状态设置
+	PathTest                = "/loginServer/test"                // 测试接口（GET）
+	PathTestPost            = "/loginServer/testPost"            // 测试接口（POST）
+	PathReportServerList    = "/loginServer/reportServerList"    // 游戏服上报服务器列表
+	PathChangeServerState   = "/loginServer/changeServerState"   // 游戏服服务器状态变更
+	PathSetUserHistory      = "/loginServer/setUserHistory"      // 玩家信息设置
+	PathSetUserState        = "/loginServer/setUserState"        // 玩家账号状态设置
+	PathBatchSetUserHistory = "/loginServer/batchSetUserHistory" // 玩家信息批量设置
+	PathDeleteUserHistory   = "/loginServer/deleteUserHistory"   // 玩家角色删除
+	PathReportAbuse         = "/loginServer/reportAbuse"         // 上报客户端登录失败/签名校验失败
 
 	// admin 分组
 	// 公告管理接口
@@ -62,12 +69,59 @@ const (
 	PathUpdateLoginNotice      = "/loginServer/loginNotice/update"      // 更新公告
 	PathFindLoginNotice        = "/loginServer/loginNotice/find"        // 查询单条 (GET)
 	PathGetLoginNoticeList     = "/loginServer/loginNotice/list"        // 获取列表 (GET)
+	// 公告审核流程
+	PathTransitionLoginNotice = "/loginServer/loginNotice/transition"       // 审核流程操作 (POST)
+	PathGetNoticeRevisions    = "/loginServer/loginNotice/revision/list"    // 修订记录 (GET)
+	PathRestoreLoginNotice    = "/loginServer/loginNotice/revision/restore" // 恢复修订版本 (POST)
+	PathPreviewLoginNotice    = "/loginServer/loginNotice/preview"          // 预览 (GET)
+	// 公告统计
+	PathGetNoticeStat = "/loginServer/noticeStat/list" // 公告展示/点击统计 (GET)
+	// 公告多语言
+	PathGetNoticeI18nList    = "/loginServer/loginNotice/i18n/list"    // 获取公告翻译 (GET)
+	PathSetNoticeI18n        = "/loginServer/loginNotice/i18n/set"     // 设置公告翻译 (POST)
+	PathDeleteNoticeI18n     = "/loginServer/loginNotice/i18n/delete"  // 删除公告翻译 (POST)
+	PathGetNoticeMissingI18n = "/loginServer/loginNotice/i18n/missing" // 缺少翻译的公告 (GET)
+	// 服务器展示管理
+	PathSetServerDisplay   = "/loginServer/server/setDisplay"  // 设置服务器标签/排序/分组 (POST)
+	PathCreateServerGroup  = "/loginServer/serverGroup/create" // 创建分组 (POST)
+	PathUpdateServerGroup  = "/loginServer/serverGroup/update" // 更新分组 (POST)
+	PathDeleteServerGroup  = "/loginServer/serverGroup/delete" // 删除分组 (POST)
+	PathGetServerGroupList = "/loginServer/serverGroup/list"   // 获取分组列表 (GET)
+	// 运行状态
+	PathGetHistoryBufferStats = "/loginServer/historyBuffer/stats"   // 玩家历史写缓冲状态 (GET)
+	PathCleanupPlayerHistory  = "/loginServer/playerHistory/cleanup" // 清理失效服的历史记录 (POST)
+	PathReloadCaches          = "/loginServer/cache/reload"          // 从数据库重新加载缓存 (POST)
+	PathGetAdminJobStatus     = "/loginServer/job/status"            // 后台任务状态 (GET)
+	// 实时推送
+	PathPushBroadcast = "/loginServer/push/broadcast" // 发送跑马灯/广播消息 (POST)
+	PathGetPushStats  = "/loginServer/push/stats"     // 推送连接状态 (GET)
+	// 角色反查
+	PathSearchByPlayer     = "/loginServer/playerIndex/byPlayer"  // 按角色ID反查账号 (GET)
+	PathSearchByAccount    = "/loginServer/playerIndex/byAccount" // 按账号前缀查询 (GET)
+	PathSearchByServer     = "/loginServer/playerIndex/byServer"  // 按游戏服查询角色 (GET)
+	PathRebuildPlayerIndex = "/loginServer/playerIndex/rebuild"   // 重建角色索引 (POST)
+	// 账号数据导出与删除
+	PathExportAccount    = "/loginServer/account/export"          // 导出账号数据 (GET)
+	PathRequestErasure   = "/loginServer/account/erasure/request" // 创建删除申请 (POST)
+	PathCancelErasure    = "/loginServer/account/erasure/cancel"  // 撤销删除申请 (POST)
+	PathGetErasureList   = "/loginServer/account/erasure/list"    // 删除申请列表 (GET)
+	PathRunErasures      = "/loginServer/account/erasure/run"     // 立即执行到期的删除申请 (POST)
+	PathVerifyErasureLog = "/loginServer/account/erasure/verify"  // 校验删除记录哈希链 (GET)
 	// IP白名单管理
-	PathGetWhitelist      = "/loginServer/whitelist/get"    // 获取指定分组白名单 (GET)
-	PathGetAllWhitelists  = "/loginServer/whitelist/getAll" // 获取所有分组白名单 (GET)
-	PathSetWhitelist      = "/loginServer/whitelist/set"    // 设置白名单 (POST)
-	PathAddWhitelistIP    = "/loginServer/whitelist/add"    // 添加IP (POST)
-	PathRemoveWhitelistIP = "/loginServer/whitelist/remove" // 删除IP (POST)
+	PathGetWhitelist      = "/loginServer/whitelist/get"     // 获取指定分组白名单 (GET)
+	PathGetAllWhitelists  = "/loginServer/whitelist/getAll"  // 获取所有分组白名单 (GET)
+	PathSetWhitelist      = "/loginServer/whitelist/set"     // 设置白名单 (POST)
+	PathAddWhitelistIP    = "/loginServer/whitelist/add"     // 添加IP (POST)
+	PathRemoveWhitelistIP = "/loginServer/whitelist/remove"  // 删除IP (POST)
+	PathExplainAccess     = "/loginServer/whitelist/explain" // 解释IP访问路由的结果 (GET)
+	// IP黑名单管理
+	PathGetDenylist      = "/loginServer/denylist/list"      // 手动黑名单和自动封禁 (GET)
+	PathAddDenylistIP    = "/loginServer/denylist/add"       // 添加黑名单 (POST)
+	PathRemoveDenylistIP = "/loginServer/denylist/remove"    // 删除黑名单/解除封禁 (POST)
+	PathClearAutoBans    = "/loginServer/denylist/clearBans" // 解除全部自动封禁 (POST)
+	// 地区访问限制
+	PathGeoIPStatus = "/loginServer/geoip/status" // 数据库和规则状态，可查询指定IP (GET)
+	PathGeoIPReload = "/loginServer/geoip/reload" // 重新加载本实例的数据库 (POST)
 )
 
 // routeCache 路由映射表（path -> Route），在包初始化时构建一次，可供整个包复用。
@@ -76,13 +130,20 @@ var routeCache = map[string]Route{
 	PathGetServerList:        {Path: PathGetServerList, Method: MethodGET, Handler: handle_getServerList, IsDebug: false, ApiGroup: ApiGroupOut},
 	PathGetPlayerServerList:  {Path: PathGetPlayerServerList, Method: MethodGET, Handler: handle_getPlayerServerList, IsDebug: false, ApiGroup: ApiGroupOut},
 	PathClientGetLoginNotice: {Path: PathClientGetLoginNotice, Method: MethodGET, Handler: handle_clientGetLoginNotice, IsDebug: false, ApiGroup: ApiGroupOut},
+	PathReportNoticeEvent:    {Path: PathReportNoticeEvent, Method: MethodPOST, Handler: handle_reportNoticeEvent, IsDebug: false, ApiGroup: ApiGroupOut},
+	PathGetServerListDelta:   {Path: PathGetServerListDelta, Method: MethodGET, Handler: handle_getServerListDelta, IsDebug: false, ApiGroup: ApiGroupOut},
+	PathGetServerListGrouped: {Path: PathGetServerListGrouped, Method: MethodGET, Handler: handle_getServerListGrouped, IsDebug: false, ApiGroup: ApiGroupOut},
+	PathPushEvents:           {Path: PathPushEvents, Method: MethodGET, Handler: handle_pushEvents, IsDebug: false, ApiGroup: ApiGroupOut},
 	// sgame 分组
-	PathTest:              {Path: PathTest, Method: MethodGET, Handler: handle_test, IsDebug: true, ApiGroup: ApiGroupSgame},
-	PathTestPost:          {Path: PathTestPost, Method: MethodPOST, Handler: handle_testPost, IsDebug: true, ApiGroup: ApiGroupSgame},
-	PathReportServerList:  {Path: PathReportServerList, Method: MethodPOST, Handler: handle_reportServerList, IsDebug: false, ApiGroup: ApiGroupSgame},
-	PathChangeServerState: {Path: PathChangeServerState, Method: MethodPOST, Handler: handle_changeServerState, IsDebug: false, ApiGroup: ApiGroupSgame},
-	PathSetUserHistory:    {Path: PathSetUserHistory, Method: MethodPOST, Handler: handle_SetUserHistory, IsDebug: false, ApiGroup: ApiGroupSgame},
-	PathSetUserState:      {Path: PathSetUserState, Method: MethodPOST, Handler: handle_SetUserState, IsDebug: false, ApiGroup: ApiGroupSgame},
+	PathTest:                {Path: PathTest, Method: MethodGET, Handler: handle_test, IsDebug: true, ApiGroup: ApiGroupSgame},
+	PathTestPost:            {Path: PathTestPost, Method: MethodPOST, Handler: handle_testPost, IsDebug: true, ApiGroup: ApiGroupSgame},
+	PathReportServerList:    {Path: PathReportServerList, Method: MethodPOST, Handler: handle_reportServerList, IsDebug: false, ApiGroup: ApiGroupSgame},
+	PathChangeServerState:   {Path: PathChangeServerState, Method: MethodPOST, Handler: handle_changeServerState, IsDebug: false, ApiGroup: ApiGroupSgame},
+	PathSetUserHistory:      {Path: PathSetUserHistory, Method: MethodPOST, Handler: handle_SetUserHistory, IsDebug: false, ApiGroup: ApiGroupSgame},
+	PathSetUserState:        {Path: PathSetUserState, Method: MethodPOST, Handler: handle_SetUserState, IsDebug: false, ApiGroup: ApiGroupSgame},
+	PathBatchSetUserHistory: {Path: PathBatchSetUserHistory, Method: MethodPOST, Handler: handle_batchSetUserHistory, IsDebug: false, ApiGroup: ApiGroupSgame},
+	PathDeleteUserHistory:   {Path: PathDeleteUserHistory, Method: MethodPOST, Handler: handle_deleteUserHistory, IsDebug: false, ApiGroup: ApiGroupSgame},
+	PathReportAbuse:         {Path: PathReportAbuse, Method: MethodPOST, Handler: handle_reportAbuse, IsDebug: false, ApiGroup: ApiGroupSgame},
 
 	// admin 分组
 	// 公告管理接口
@@ -93,12 +154,59 @@ var routeCache = map[string]Route{
 	// 查询接口用 GET
 	PathFindLoginNotice:    {Path: PathFindLoginNotice, Method: MethodGET, Handler: handle_findLoginNotice, IsDebug: false, ApiGroup: ApiGroupAdminServer},
 	PathGetLoginNoticeList: {Path: PathGetLoginNoticeList, Method: MethodGET, Handler: handle_getLoginNoticeList, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 公告审核流程
+	PathTransitionLoginNotice: {Path: PathTransitionLoginNotice, Method: MethodPOST, Handler: handle_transitionLoginNotice, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathGetNoticeRevisions:    {Path: PathGetNoticeRevisions, Method: MethodGET, Handler: handle_getNoticeRevisions, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathRestoreLoginNotice:    {Path: PathRestoreLoginNotice, Method: MethodPOST, Handler: handle_restoreLoginNotice, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathPreviewLoginNotice:    {Path: PathPreviewLoginNotice, Method: MethodGET, Handler: handle_previewLoginNotice, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 公告统计
+	PathGetNoticeStat: {Path: PathGetNoticeStat, Method: MethodGET, Handler: handle_getNoticeStat, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 公告多语言
+	PathGetNoticeI18nList:    {Path: PathGetNoticeI18nList, Method: MethodGET, Handler: handle_getNoticeI18nList, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathSetNoticeI18n:        {Path: PathSetNoticeI18n, Method: MethodPOST, Handler: handle_setNoticeI18n, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathDeleteNoticeI18n:     {Path: PathDeleteNoticeI18n, Method: MethodPOST, Handler: handle_deleteNoticeI18n, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathGetNoticeMissingI18n: {Path: PathGetNoticeMissingI18n, Method: MethodGET, Handler: handle_getNoticeMissingI18n, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 服务器展示管理接口
+	PathSetServerDisplay:   {Path: PathSetServerDisplay, Method: MethodPOST, Handler: handle_setServerDisplay, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathCreateServerGroup:  {Path: PathCreateServerGroup, Method: MethodPOST, Handler: handle_createServerGroup, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathUpdateServerGroup:  {Path: PathUpdateServerGroup, Method: MethodPOST, Handler: handle_updateServerGroup, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathDeleteServerGroup:  {Path: PathDeleteServerGroup, Method: MethodPOST, Handler: handle_deleteServerGroup, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathGetServerGroupList: {Path: PathGetServerGroupList, Method: MethodGET, Handler: handle_getServerGroupList, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 运行状态
+	PathGetHistoryBufferStats: {Path: PathGetHistoryBufferStats, Method: MethodGET, Handler: handle_getHistoryBufferStats, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathCleanupPlayerHistory:  {Path: PathCleanupPlayerHistory, Method: MethodPOST, Handler: handle_cleanupPlayerHistory, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathGetAdminJobStatus:     {Path: PathGetAdminJobStatus, Method: MethodGET, Handler: handle_getAdminJobStatus, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathReloadCaches:          {Path: PathReloadCaches, Method: MethodPOST, Handler: handle_reloadCaches, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 实时推送
+	PathPushBroadcast: {Path: PathPushBroadcast, Method: MethodPOST, Handler: handle_pushBroadcast, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathGetPushStats:  {Path: PathGetPushStats, Method: MethodGET, Handler: handle_getPushStats, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 角色反查
+	PathSearchByPlayer:     {Path: PathSearchByPlayer, Method: MethodGET, Handler: handle_searchByPlayer, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathSearchByAccount:    {Path: PathSearchByAccount, Method: MethodGET, Handler: handle_searchByAccount, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathSearchByServer:     {Path: PathSearchByServer, Method: MethodGET, Handler: handle_searchByServer, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathRebuildPlayerIndex: {Path: PathRebuildPlayerIndex, Method: MethodPOST, Handler: handle_rebuildPlayerIndex, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 账号数据导出与删除
+	PathExportAccount:    {Path: PathExportAccount, Method: MethodGET, Handler: handle_exportAccount, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathRequestErasure:   {Path: PathRequestErasure, Method: MethodPOST, Handler: handle_requestErasure, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathCancelErasure:    {Path: PathCancelErasure, Method: MethodPOST, Handler: handle_cancelErasure, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathGetErasureList:   {Path: PathGetErasureList, Method: MethodGET, Handler: handle_getErasureList, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathRunErasures:      {Path: PathRunErasures, Method: MethodPOST, Handler: handle_runErasures, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathVerifyErasureLog: {Path: PathVerifyErasureLog, Method: MethodGET, Handler: handle_verifyErasureLog, IsDebug: false, ApiGroup: ApiGroupAdminServer},
 	// IP白名单管理接口
 	PathGetWhitelist:      {Path: PathGetWhitelist, Method: MethodGET, Handler: handle_getWhitelist, IsDebug: false, ApiGroup: ApiGroupAdminServer},
 	PathGetAllWhitelists:  {Path: PathGetAllWhitelists, Method: MethodGET, Handler: handle_getAllWhitelists, IsDebug: false, ApiGroup: ApiGroupAdminServer},
 	PathSetWhitelist:      {Path: PathSetWhitelist, Method: MethodPOST, Handler: handle_setWhitelist, IsDebug: false, ApiGroup: ApiGroupAdminServer},
 	PathAddWhitelistIP:    {Path: PathAddWhitelistIP, Method: MethodPOST, Handler: handle_addWhitelistIP, IsDebug: false, ApiGroup: ApiGroupAdminServer},
 	PathRemoveWhitelistIP: {Path: PathRemoveWhitelistIP, Method: MethodPOST, Handler: handle_removeWhitelistIP, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathExplainAccess:     {Path: PathExplainAccess, Method: MethodGET, Handler: handle_explainAccess, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// IP黑名单管理
+	PathGetDenylist:      {Path: PathGetDenylist, Method: MethodGET, Handler: handle_getDenylist, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathAddDenylistIP:    {Path: PathAddDenylistIP, Method: MethodPOST, Handler: handle_addDenylistIP, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathRemoveDenylistIP: {Path: PathRemoveDenylistIP, Method: MethodPOST, Handler: handle_removeDenylistIP, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathClearAutoBans:    {Path: PathClearAutoBans, Method: MethodPOST, Handler: handle_clearAutoBans, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	// 地区访问限制
+	PathGeoIPStatus: {Path: PathGeoIPStatus, Method: MethodGET, Handler: handle_geoipStatus, IsDebug: false, ApiGroup: ApiGroupAdminServer},
+	PathGeoIPReload: {Path: PathGeoIPReload, Method: MethodPOST, Handler: handle_geoipReload, IsDebug: false, ApiGroup: ApiGroupAdminServer},
 
 	// test 分组
 	PathEncrypt:   {Path: PathEncrypt, Method: MethodPOST, Handler: handle_encrypt, IsDebug: true, ApiGroup: ApiGroupTest},
@@ -3,9 +3,10 @@ package request
 import (
 	"loginServer/config"
 	"loginServer/src/log"
-	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,11 +23,14 @@ const (
 	CodeSuccess    = 0    // 成功
 	CodeError      = 1001 // 一般错误
 	CodeBadRequest = 1002 // 参数错误
+	CodeConflict   = 1003 // 数据已被修改（版本冲突）
+	CodeGeoBlocked = 1004 // 所在地区不允许访问
 
 	// 状态码对应的默认消息
 	MsgSuccess    = "success"
 	MsgError      = "failed"
 	MsgBadRequest = "parameter error"
+	MsgConflict   = "conflict"
 )
 
 // retResponse 统一返回响应（支持消息和数据）
@@ -47,6 +51,8 @@ func retResponse(code int, message string, data any) Response {
 			resp.Message = MsgError
 		case CodeBadRequest:
 			resp.Message = MsgBadRequest
+		case CodeConflict:
+			resp.Message = MsgConflict
 		default:
 			resp.Message = ""
 		}
@@ -63,92 +69,98 @@ func retResponse(code int, message string, data any) Response {
 // setupMiddleware 设置中间件
 func setupMiddleware(req *gin.Engine) {
 	req.Use(func(c *gin.Context) {
+		// 解析客户端真实 IP，后续黑白名单、日志等统一使用
+		clientIP := getClientIP(c)
+
+		// 检查IP黑名单（对所有路由和所有方法生效，包括 OPTIONS 预检请求）
+		if blocked, errMsg, retryAfter := checkDenylist(clientIP); blocked {
+			if retryAfter > 0 {
+				c.Header("Retry-After", retryAfterHeader(retryAfter))
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, retResponse(CodeBadRequest, errMsg, nil))
+			return
+		}
+
 		// 处理 OPTIONS 预检请求
 		if c.Request.Method == "OPTIONS" {
 			c.Header("Access-Control-Allow-Origin", "*")
 			c.Header("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Authorization, Content-Type")
+			c.Header("Access-Control-Allow-Headers", "Origin, Authorization, Content-Type, If-None-Match")
 			c.Status(http.StatusOK)
 			c.Abort()
 			return
 		}
 
-		// 检查路由访问权限
+		// 检查路由访问权限（白名单拒绝、生产环境的调试接口）
+		// 不计入滥用次数：IP 变化的运维机器或误配的白名单不应导致整个 IP 被封禁，访问本身已被拒绝
 		allowed, errMsg := shouldDisableRoute(c)
 		if !allowed {
 			log.Info("request can't used, err:%v", errMsg)
 			c.AbortWithStatusJSON(http.StatusForbidden, retResponse(CodeBadRequest, errMsg, nil))
 			return
 		}
+
+		// 检查地区限制（不计入滥用次数，避免被拒绝地区的正常玩家重试时被封禁）
+		if blocked, country := checkGeoAccess(c, clientIP); blocked {
+			c.AbortWithStatusJSON(http.StatusForbidden, retResponse(CodeGeoBlocked, geoBlockedMessage(c), gin.H{"country": country}))
+			return
+		}
 		c.Next()
+		recordStatusAbuse(c, clientIP)
 	})
 }
 
-// getClientIP 获取客户端真实IP地址
-// 优先级：X-Forwarded-For > X-Real-IP > RemoteAddr
-func getClientIP(c *gin.Context) string {
-	// 优先从 X-Forwarded-For 获取（经过代理时）
-	if ip := c.GetHeader("X-Forwarded-For"); ip != "" {
-		if ips := strings.Split(ip, ","); len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
+// recordStatusAbuse 响应为 4xx 时计入该 IP 的滥用次数
+func recordStatusAbuse(c *gin.Context, clientIP string) {
+	if status := c.Writer.Status(); status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+		recordAbuse(clientIP, Abuse4xx, 1)
 	}
+}
 
-	// 从 X-Real-IP 获取
-	if ip := c.GetHeader("X-Real-IP"); ip != "" {
-		return ip
-	}
+// checkETag 设置 ETag 响应头，并根据 If-None-Match 判断客户端缓存是否仍然有效
+// 返回 true 表示已响应 304 Not Modified，调用方无需再输出响应体
+func checkETag(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
 
-	// 直接从 RemoteAddr 获取
-	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
-	if err != nil {
-		return c.Request.RemoteAddr
+	match := c.GetHeader("If-None-Match")
+	if match == "" {
+		return false
+	}
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimSpace(tag)
+		// 弱校验：忽略 W/ 前缀
+		tag = strings.TrimPrefix(tag, "W/")
+		if tag == "*" || tag == etag {
+			c.Status(http.StatusNotModified)
+			return true
+		}
 	}
-	return ip
+	return false
 }
 
 // checkIPWhitelist 检查IP是否在白名单中
-// 支持精确匹配和CIDR格式（如 192.168.1.0/24）
-// 参数 allowedIPs 的含义：
+// 支持精确匹配和CIDR格式（如 192.168.1.0/24），IPv4 映射的 IPv6 地址按 IPv4 匹配，已过期的条目不生效
+// 参数 group 的含义：
 //   - nil: 配置不存在，返回 true（允许所有 IP 访问）
-//   - []: 配置存在但为空列表，返回 false（不允许任何 IP 访问）
-//   - [ip1, ip2, ...]: 检查 IP 是否在列表中
-func checkIPWhitelist(clientIP string, allowedIPs []string) bool {
-	// 如果 allowedIPs 为 nil，表示配置不存在，允许所有 IP 访问
-	if allowedIPs == nil {
+//   - 空集合（或条目全部已过期）: 返回 false（不允许任何 IP 访问）
+//   - 其它: 检查 IP 是否在集合中
+func checkIPWhitelist(clientIP string, group *whitelistGroup) bool {
+	// 如果 group 为 nil，表示配置不存在，允许所有 IP 访问
+	if group == nil {
 		return true
 	}
+	_, ok := matchIPWhitelist(clientIP, group, time.Now().Unix())
+	return ok
+}
 
-	// 如果 allowedIPs 为空列表，表示配置存在但为空，不允许任何 IP 访问
-	if len(allowedIPs) == 0 {
-		return false
-	}
-
-	clientIPAddr := net.ParseIP(clientIP)
-	if clientIPAddr == nil {
-		return false
-	}
-
-	for _, allowedIP := range allowedIPs {
-		allowedIP = strings.TrimSpace(allowedIP)
-		if allowedIP == "" {
-			continue
-		}
-
-		// 精确匹配
-		if allowedIP == clientIP {
-			return true
-		}
-
-		// CIDR格式匹配
-		if strings.Contains(allowedIP, "/") {
-			_, ipNet, err := net.ParseCIDR(allowedIP)
-			if err == nil && ipNet.Contains(clientIPAddr) {
-				return true
-			}
-		}
+// matchIPWhitelist 在分组中查找包含该 IP 的未过期条目，返回命中的前缀
+func matchIPWhitelist(clientIP string, group *whitelistGroup, now int64) (netip.Prefix, bool) {
+	clientIPAddr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return netip.Prefix{}, false
 	}
-	return false
+	return group.set.Match(clientIPAddr, now)
 }
 
 // shouldDisableRoute 检查路由是否应该被禁用
@@ -165,42 +177,82 @@ func shouldDisableRoute(c *gin.Context) (bool, string) {
 	return true, ""
 }
 
+// 路由访问限制的判断依据（用于解释访问结果）
+const (
+	limitRuleDevMode       = "dev_mode"      // 开发环境不限制
+	limitRuleUnknownRoute  = "unknown_route" // 未注册的路由，不限制（由路由返回 404）
+	limitRuleDebugRoute    = "debug_route"   // 生产环境禁止调试接口
+	limitRuleNoGroup       = "no_group"      // 路由未设置 API 分组，不限制
+	limitRuleGroupMissing  = "group_missing" // 分组没有配置白名单，允许所有 IP
+	limitRuleInvalidIP     = "invalid_ip"    // 无法解析客户端 IP
+	limitRuleMatched       = "matched"       // 命中白名单条目
+	limitRuleGroupEmpty    = "group_empty"   // 分组白名单为空，不允许任何 IP
+	limitRuleNotMatched    = "not_matched"   // 没有命中任何未过期的条目
+	msgWhitelistDenied     = "IP不在白名单中"
+	msgDebugRouteForbidden = "生产环境不允许访问调试接口"
+)
+
+// limitDecision 路由访问限制的判断结果
+type limitDecision struct {
+	allowed bool
+	message string // 拒绝时返回给调用方的信息
+	rule    string // 判断依据（limitRule*）
+	route   Route
+	group   *whitelistGroup
+	matched netip.Prefix // rule 为 matched 时命中的前缀
+}
+
 // checkLimitApi 检查 API 访问限制
 func checkLimitApi(fullpath string, c *gin.Context) (bool, string) {
+	decision := decideLimitApi(fullpath, getClientIP(c), time.Now().Unix())
+	return decision.allowed, decision.message
+}
+
+// decideLimitApi 判断客户端 IP 能否访问该路由（checkLimitApi 和访问解释接口共用）
+func decideLimitApi(fullpath, clientIP string, now int64) limitDecision {
 	// 开发环境不限制
 	if config.Config.GetString("server_mod") == "dev" {
-		return true, ""
+		return limitDecision{allowed: true, rule: limitRuleDevMode}
 	}
 
 	// 从全局路由表获取路由信息
 	route, exists := routeCache[fullpath]
 	if !exists {
-		return true, ""
+		return limitDecision{allowed: true, rule: limitRuleUnknownRoute}
 	}
 
 	// 检查调试接口限制
 	if route.IsDebug {
-		return false, "生产环境不允许访问调试接口"
+		return limitDecision{message: msgDebugRouteForbidden, rule: limitRuleDebugRoute, route: route}
 	}
 
 	// 检查IP白名单
-	if route.ApiGroup != "" {
-		allowedIPs := getAllowedIPsByGroup(route.ApiGroup)
-		clientIP := getClientIP(c)
-		if !checkIPWhitelist(clientIP, allowedIPs) {
-			return false, "IP不在白名单中"
-		}
+	if route.ApiGroup == "" {
+		return limitDecision{allowed: true, rule: limitRuleNoGroup, route: route}
 	}
-
-	return true, ""
+	group := getWhitelistGroup(route.ApiGroup)
+	if group == nil {
+		return limitDecision{allowed: true, rule: limitRuleGroupMissing, route: route}
+	}
+	decision := limitDecision{route: route, group: group}
+	switch prefix, ok := matchIPWhitelist(clientIP, group, now); {
+	case ok:
+		decision.allowed, decision.rule, decision.matched = true, limitRuleMatched, prefix
+	case !isValidIP(clientIP):
+		decision.rule = limitRuleInvalidIP
+	case len(group.entries) == 0:
+		decision.rule = limitRuleGroupEmpty
+	default:
+		decision.rule = limitRuleNotMatched
+	}
+	if !decision.allowed {
+		decision.message = msgWhitelistDenied
+	}
+	return decision
 }
 
-// getAllowedIPsByGroup 根据API分组获取IP白名单
-// 返回值和含义：
-//   - nil: 配置不存在，表示不限制IP（允许所有访问）
-//   - []: 配置存在但为空列表，表示不允许任何IP访问
-//   - [ip1, ip2, ...]: 配置了白名单IP列表
-func getAllowedIPsByGroup(apiGroup string) []string {
-	// 使用动态白名单管理器
-	return GetAllowedIPsByGroup(apiGroup)
+// isValidIP 是否为有效的 IP 地址
+func isValidIP(ip string) bool {
+	_, err := netip.ParseAddr(ip)
+	return err == nil
 }
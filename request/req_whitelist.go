@@ -5,11 +5,60 @@ import (
 	"fmt"
 	"loginServer/config"
 	"loginServer/src/db"
+	"loginServer/src/db/db_mysql"
 	"loginServer/src/log"
 	"net"
+	"reflect"
 	"strings"
+	"time"
 )
 
+// IP 白名单
+// 条目可以设置过期时间（如临时开放给供应商的地址），过期的条目在检查时直接忽略，
+// 再由定时任务（whitelist.purge_cron，见 req_cron.go）从数据库删除并刷新缓存。
+
+const defaultWhitelistPurgeSpec = "0 * * * * *"
+
+// WhitelistEntry 白名单条目
+type WhitelistEntry struct {
+	IP       string `json:"ip"`        // IP 或 CIDR
+	ExpireAt int64  `json:"expire_at"` // 过期时间，0 表示永不过期
+	Note     string `json:"note"`      // 备注
+	Operator string `json:"operator"`  // 添加人
+}
+
+// expired 条目在 now 时是否已过期
+func (e WhitelistEntry) expired(now int64) bool {
+	return e.ExpireAt > 0 && e.ExpireAt <= now
+}
+
+// toWhitelistEntry 数据库记录转换为缓存条目
+func toWhitelistEntry(wl db_mysql.IPWhitelist) WhitelistEntry {
+	return WhitelistEntry{IP: wl.IP, ExpireAt: wl.ExpireAt, Note: wl.Note, Operator: wl.Operator}
+}
+
+// toWhitelistEntries 数据库记录转换为缓存条目列表（跳过分组占位记录）
+func toWhitelistEntries(whitelists []db_mysql.IPWhitelist) []WhitelistEntry {
+	entries := make([]WhitelistEntry, 0, len(whitelists))
+	for _, wl := range whitelists {
+		if !wl.IsGroupMarker() {
+			entries = append(entries, toWhitelistEntry(wl))
+		}
+	}
+	return entries
+}
+
+// 分组来源
+// 白名单分组的唯一依据是数据库和配置文件 ip_whitelist：
+//   - 数据库中有记录的分组：使用数据库中的条目（只有占位记录时为空列表，禁止所有访问，见 IPWhitelist.IsGroupMarker）
+//   - 数据库中没有记录、但配置文件中配置了的分组：使用配置文件中的条目（空列表表示禁止所有访问）；
+//     正常情况下启动时已写入数据库，只有写入失败时才会出现
+//   - 两者都没有的分组：不存在，不限制访问
+//
+// 分组的条目被清空（SetWhitelist 空列表、删除最后一个IP、条目全部过期）时数据库保留占位记录，分组仍为空列表。
+// 启动、重新加载（ReloadWhitelists）、单个分组的同步（reloadWhitelistGroup）和全量同步（resyncWhitelists）
+// 都按此规则生成缓存（applyWhitelistGroups），重启前后、各实例之间同一分组的结果一致。
+
 // InitWhitelistFromDB 从数据库初始化白名单到缓存
 func InitWhitelistFromDB() {
 	// 从数据库加载所有白名单
@@ -20,124 +69,107 @@ func InitWhitelistFromDB() {
 		return
 	}
 
-	// 构建数据库中的白名单映射表：map[group][ip] = true，用于快速查找
-	dbWhitelistMap := make(map[string]map[string]bool)
-	groupMap := make(map[string][]string)
+	// 数据库中已有的分组（包括只有占位记录的空分组）
+	dbGroups := make(map[string]bool)
 	for _, wl := range whitelists {
-		groupLower := strings.ToLower(wl.APIGroup)
-		ip := wl.IP
-
-		// 初始化分组映射
-		if dbWhitelistMap[groupLower] == nil {
-			dbWhitelistMap[groupLower] = make(map[string]bool)
-		}
-		dbWhitelistMap[groupLower][ip] = true
-
-		// 按分组组织数据用于缓存
-		groupMap[groupLower] = append(groupMap[groupLower], ip)
+		dbGroups[strings.ToLower(wl.APIGroup)] = true
 	}
 
-	// 检查配置文件，将配置中有但数据库中没有的IP添加到数据库
-	allSettings := config.Config.AllSettings()
-	if whitelistRaw, exists := allSettings["ip_whitelist"]; exists {
-		if whitelistMap, ok := whitelistRaw.(map[string]interface{}); ok {
-			for group, value := range whitelistMap {
-				groupLower := strings.ToLower(group)
-
-				// 解析配置中的IP列表
-				var configIPs []string
-				if ips, ok := value.([]interface{}); ok {
-					for _, ip := range ips {
-						if ipStr, ok := ip.(string); ok {
-							ipStr = strings.TrimSpace(ipStr)
-							if ipStr != "" {
-								configIPs = append(configIPs, ipStr)
-							}
-						}
-					}
-				}
-
-				// 检查配置中的每个IP是否在数据库中
-				for _, configIP := range configIPs {
-					// 如果该分组在数据库中不存在，或者该IP在该分组中不存在，则添加到数据库
-					if dbWhitelistMap[groupLower] == nil || !dbWhitelistMap[groupLower][configIP] {
-						// 添加到数据库（AddWhitelistIP 会自动处理已存在的情况）
-						if err := db.AddWhitelistIP(groupLower, configIP); err == nil {
-							// 添加成功，更新本地映射和缓存
-							if dbWhitelistMap[groupLower] == nil {
-								dbWhitelistMap[groupLower] = make(map[string]bool)
-							}
-							dbWhitelistMap[groupLower][configIP] = true
-							groupMap[groupLower] = append(groupMap[groupLower], configIP)
-						} else {
-							// 记录错误日志，但不阻止启动
-							log.Warn("从配置文件同步IP到数据库失败: 分组=%s, IP=%s, 错误=%v", groupLower, configIP, err)
-						}
-					}
-				}
+	// 配置文件只用于初始化：数据库中还没有的分组写入数据库，已有的分组以数据库为准
+	// （后台删除的IP、清空的分组在重启后不会被配置文件恢复）
+	for group, entries := range configWhitelistGroups() {
+		if dbGroups[group] {
+			continue
+		}
+		if len(entries) == 0 {
+			// 空列表：写入占位记录，分组禁止所有访问
+			if err := db.SetWhitelist(group, nil, "config"); err != nil {
+				log.Warn("从配置文件同步空分组到数据库失败: 分组=%s, 错误=%v", group, err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			wl := db_mysql.IPWhitelist{APIGroup: group, IP: entry.IP, Note: "从配置文件同步", Operator: "config"}
+			if err := db.AddWhitelistIP(wl); err != nil {
+				// 记录错误日志，但不阻止启动
+				log.Warn("从配置文件同步IP到数据库失败: 分组=%s, IP=%s, 错误=%v", group, entry.IP, err)
 			}
 		}
 	}
 
-	// 写入缓存
-	for group, ips := range groupMap {
-		setWhitelistToCache(group, ips)
+	// 按统一规则写入缓存
+	if err := ReloadWhitelists(); err != nil {
+		log.Error("加载白名单失败，使用配置文件: %v", err)
+		InitWhitelistFromConfig()
 	}
 }
 
 // InitWhitelistFromConfig 从配置文件初始化白名单（兼容旧配置，仅在数据库加载失败时使用）
 func InitWhitelistFromConfig() {
-	// 使用 AllSettings() 获取所有配置（保持原始键名大小写）
-	allSettings := config.Config.AllSettings()
-	whitelistRaw, exists := allSettings["ip_whitelist"]
-	if !exists {
-		return
+	for group, entries := range configWhitelistGroups() {
+		setWhitelistToCache(group, entries)
 	}
+}
 
-	whitelistMap, ok := whitelistRaw.(map[string]interface{})
+// configWhitelistGroups 解析配置文件中的白名单分组（分组名统一小写，非数组时为空列表）
+func configWhitelistGroups() map[string][]WhitelistEntry {
+	result := make(map[string][]WhitelistEntry)
+
+	// 使用 AllSettings() 获取所有配置（保持原始键名大小写）
+	allSettings := config.Config.AllSettings()
+	whitelistMap, ok := allSettings["ip_whitelist"].(map[string]interface{})
 	if !ok {
-		return
+		return result
 	}
 
 	for group, value := range whitelistMap {
 		// 统一转换为小写存储，保证代码一致性（配置文件可以保持原始大小写）
 		groupLower := strings.ToLower(group)
-
-		var ipList []string
-
-		// 解析 IP 列表
+		entries := make([]WhitelistEntry, 0)
 		if ips, ok := value.([]interface{}); ok {
-			ipList = make([]string, 0, len(ips))
 			for _, ip := range ips {
 				if ipStr, ok := ip.(string); ok {
 					ipStr = strings.TrimSpace(ipStr)
 					if ipStr != "" {
-						ipList = append(ipList, ipStr)
+						entries = append(entries, WhitelistEntry{IP: ipStr, Operator: "config"})
 					}
 				}
 			}
-		} else {
-			ipList = []string{} // 设置为空数组
 		}
-
-		// 使用封装函数存储到缓存
-		setWhitelistToCache(groupLower, ipList)
+		result[groupLower] = append(result[groupLower], entries...)
 	}
+	return result
 }
 
-// GetAllowedIPsByGroup 根据API分组获取IP白名单（线程安全）
+// GetAllowedIPsByGroup 根据API分组获取当前生效（未过期）的IP白名单（线程安全）
 // 返回值和含义：
 //   - nil: 配置不存在，表示不限制IP（允许所有访问）
-//   - []: 配置存在但为空列表，表示不允许任何IP访问
+//   - []: 配置存在但为空列表（或全部已过期），表示不允许任何IP访问
 //   - [ip1, ip2, ...]: 配置了白名单IP列表
 func GetAllowedIPsByGroup(apiGroup string) []string {
+	entries := GetWhitelistEntries(apiGroup)
+	if entries == nil {
+		return nil
+	}
+	now := time.Now().Unix()
+	ips := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.expired(now) {
+			ips = append(ips, entry.IP)
+		}
+	}
+	return ips
+}
+
+// GetWhitelistEntries 根据API分组获取白名单条目（包含已过期但尚未删除的条目），nil 表示分组不存在
+func GetWhitelistEntries(apiGroup string) []WhitelistEntry {
 	// 统一转换为小写查找，保证代码一致性
 	apiGroup = strings.ToLower(apiGroup)
 	return getWhitelistFromCache(apiGroup)
 }
 
-// SetWhitelist 设置指定分组的IP白名单（完全替换）
-func SetWhitelist(apiGroup string, ips []string) error {
+// SetWhitelist 设置指定分组的IP白名单（完全替换，设置后的条目均为永久有效）
+func SetWhitelist(apiGroup string, ips []string, operator string) error {
 	// 统一转换为小写，保证代码一致性
 	apiGroup = strings.ToLower(apiGroup)
 	// 验证IP格式
@@ -163,28 +195,33 @@ func SetWhitelist(apiGroup string, ips []string) error {
 	}
 
 	// 写入数据库
-	if err := db.SetWhitelist(apiGroup, validIPs); err != nil {
+	if err := db.SetWhitelist(apiGroup, validIPs, operator); err != nil {
 		return fmt.Errorf("保存白名单到数据库失败: %w", err)
 	}
 
 	// 更新缓存
-	if len(validIPs) == 0 {
-		setWhitelistToCache(apiGroup, []string{})
-	} else {
-		setWhitelistToCache(apiGroup, validIPs)
+	entries := make([]WhitelistEntry, 0, len(validIPs))
+	for _, ip := range validIPs {
+		entries = append(entries, WhitelistEntry{IP: ip, Operator: operator})
 	}
+	setWhitelistToCache(apiGroup, entries)
+	publishWhitelistSync(apiGroup)
 
 	return nil
 }
 
-// AddIP 向指定分组添加IP（如果已存在则忽略）
-func AddIP(apiGroup string, ip string) error {
+// AddIP 向指定分组添加IP（如果已存在则更新过期时间、备注和添加人）
+// expireAt 为过期时间（Unix 秒），0 表示永不过期
+func AddIP(apiGroup string, ip string, expireAt int64, note, operator string) error {
 	// 统一转换为小写，保证代码一致性
 	apiGroup = strings.ToLower(apiGroup)
 	ip = strings.TrimSpace(ip)
 	if ip == "" {
 		return errors.New("IP地址不能为空")
 	}
+	if expireAt < 0 || (expireAt > 0 && expireAt <= time.Now().Unix()) {
+		return errors.New("过期时间必须晚于当前时间")
+	}
 
 	// 验证IP格式
 	if strings.Contains(ip, "/") {
@@ -199,7 +236,8 @@ func AddIP(apiGroup string, ip string) error {
 	}
 
 	// 写入数据库
-	if err := db.AddWhitelistIP(apiGroup, ip); err != nil {
+	wl := db_mysql.IPWhitelist{APIGroup: apiGroup, IP: ip, ExpireAt: expireAt, Note: note, Operator: operator}
+	if err := db.AddWhitelistIP(wl); err != nil {
 		return fmt.Errorf("添加IP到数据库失败: %w", err)
 	}
 
@@ -207,33 +245,32 @@ func AddIP(apiGroup string, ip string) error {
 	dbWhitelists, err := db.LoadWhitelist(apiGroup)
 	if err != nil {
 		// 如果重新加载失败，使用缓存更新逻辑（降级处理）
-		ips := getWhitelistFromCache(apiGroup)
-		if ips == nil {
-			ips = []string{}
+		entries := getWhitelistFromCache(apiGroup)
+		if entries == nil {
+			entries = []WhitelistEntry{}
 		}
 
-		// 检查是否已存在（避免重复添加到缓存）
-		exists := false
-		for _, existingIP := range ips {
-			if existingIP == ip {
-				exists = true
+		// 已存在时替换（更新过期时间等），否则追加
+		replaced := false
+		for i := range entries {
+			if entries[i].IP == ip {
+				entries[i] = toWhitelistEntry(wl)
+				replaced = true
 				break
 			}
 		}
 
-		if !exists {
-			ips = append(ips, ip)
-			setWhitelistToCache(apiGroup, ips)
+		if !replaced {
+			entries = append(entries, toWhitelistEntry(wl))
 		}
+		setWhitelistToCache(apiGroup, entries)
+		publishWhitelistSync(apiGroup)
 		return nil
 	}
 
-	// 将数据库中的数据转换为字符串数组并更新缓存
-	ips := make([]string, 0, len(dbWhitelists))
-	for _, wl := range dbWhitelists {
-		ips = append(ips, wl.IP)
-	}
-	setWhitelistToCache(apiGroup, ips)
+	// 将数据库中的数据转换为缓存条目并更新缓存
+	setWhitelistToCache(apiGroup, toWhitelistEntries(dbWhitelists))
+	publishWhitelistSync(apiGroup)
 
 	return nil
 }
@@ -256,29 +293,28 @@ func RemoveIP(apiGroup string, ip string) error {
 	dbWhitelists, err := db.LoadWhitelist(apiGroup)
 	if err != nil {
 		// 如果重新加载失败，使用缓存更新逻辑（降级处理）
-		ips := getWhitelistFromCache(apiGroup)
-		if ips == nil {
-			return nil // 分组不存在，无需删除
+		entries := getWhitelistFromCache(apiGroup)
+		if entries == nil {
+			publishWhitelistSync(apiGroup)
+			return nil // 本实例没有该分组，无需删除
 		}
 
 		// 查找并删除
-		newIPs := make([]string, 0, len(ips))
-		for _, existingIP := range ips {
-			if existingIP != ip {
-				newIPs = append(newIPs, existingIP)
+		newEntries := make([]WhitelistEntry, 0, len(entries))
+		for _, entry := range entries {
+			if entry.IP != ip {
+				newEntries = append(newEntries, entry)
 			}
 		}
 
-		setWhitelistToCache(apiGroup, newIPs)
+		setWhitelistToCache(apiGroup, newEntries)
+		publishWhitelistSync(apiGroup)
 		return nil
 	}
 
-	// 将数据库中的数据转换为字符串数组并更新缓存
-	ips := make([]string, 0, len(dbWhitelists))
-	for _, wl := range dbWhitelists {
-		ips = append(ips, wl.IP)
-	}
-	setWhitelistToCache(apiGroup, ips)
+	// 将数据库中的数据转换为缓存条目并更新缓存
+	setWhitelistToCache(apiGroup, toWhitelistEntries(dbWhitelists))
+	publishWhitelistSync(apiGroup)
 
 	return nil
 }
@@ -301,18 +337,102 @@ func GetWhitelist(apiGroup string) []string {
 	return GetAllowedIPsByGroup(apiGroup)
 }
 
-// GetAllWhitelists 获取所有分组的白名单（用于查询）
+// GetAllWhitelists 获取所有分组当前生效的白名单（用于查询）
 func GetAllWhitelists() map[string][]string {
-	items := getAllWhitelistItems()
-	result := make(map[string][]string, len(items))
-	prefix := CacheKeyWhitelist + "_"
+	result := make(map[string][]string)
+	for _, group := range GetAllGroups() {
+		result[group] = GetAllowedIPsByGroup(group)
+	}
+	return result
+}
 
-	for key, item := range items {
-		group := strings.TrimPrefix(key, prefix)
-		if ips, ok := item.Object.([]string); ok {
-			result[group] = make([]string, len(ips))
-			copy(result[group], ips)
+// ReloadWhitelists 从数据库重新加载所有分组的白名单到缓存（用于数据库被直接修改或其它实例修改后同步）
+// 与启动时的规则一致（见文件开头的"分组来源"）：数据库和配置文件中都没有的分组从缓存删除
+func ReloadWhitelists() error {
+	groupMap, err := loadAllWhitelistGroups()
+	if err != nil {
+		return err
+	}
+	applyWhitelistGroups(groupMap)
+	return nil
+}
+
+// applyWhitelistGroups 将按"分组来源"规则加载的全部分组写入缓存：替换内容不一致的分组，删除已不存在的分组
+// 返回缓存是否发生变化
+func applyWhitelistGroups(groupMap map[string][]WhitelistEntry) bool {
+	changed := false
+	for group, entries := range groupMap {
+		if current := getWhitelistGroup(group); current != nil && reflect.DeepEqual(current.entries, entries) {
+			continue
 		}
+		setWhitelistToCache(group, entries)
+		changed = true
 	}
-	return result
+	for _, group := range GetAllGroups() {
+		if _, ok := groupMap[group]; !ok {
+			deleteWhitelistFromCache(group)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// loadAllWhitelistGroups 按"分组来源"规则加载所有分组的白名单（分组名 -> 条目）
+func loadAllWhitelistGroups() (map[string][]WhitelistEntry, error) {
+	whitelists, err := db.LoadAllWhitelists()
+	if err != nil {
+		return nil, err
+	}
+
+	groupMap := make(map[string][]WhitelistEntry)
+	for _, wl := range whitelists {
+		group := strings.ToLower(wl.APIGroup)
+		if groupMap[group] == nil {
+			groupMap[group] = make([]WhitelistEntry, 0)
+		}
+		if !wl.IsGroupMarker() {
+			groupMap[group] = append(groupMap[group], toWhitelistEntry(wl))
+		}
+	}
+	for group, entries := range configWhitelistGroups() {
+		if _, ok := groupMap[group]; !ok {
+			groupMap[group] = entries
+		}
+	}
+	return groupMap, nil
+}
+
+// reloadWhitelistGroup 按"分组来源"规则重新加载一个分组的白名单（其它实例修改后同步）
+func reloadWhitelistGroup(apiGroup string) error {
+	apiGroup = strings.ToLower(apiGroup)
+	whitelists, err := db.LoadWhitelist(apiGroup)
+	if err != nil {
+		return err
+	}
+	if len(whitelists) > 0 {
+		setWhitelistToCache(apiGroup, toWhitelistEntries(whitelists))
+	} else if entries, ok := configWhitelistGroups()[apiGroup]; ok {
+		setWhitelistToCache(apiGroup, entries)
+	} else {
+		deleteWhitelistFromCache(apiGroup)
+	}
+	return nil
+}
+
+// purgeExpiredWhitelists 删除已过期的白名单条目并刷新缓存（定时任务）
+func purgeExpiredWhitelists() (int, error) {
+	expired, err := db.PurgeExpiredWhitelist(time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	for _, wl := range expired {
+		log.Info("白名单条目已过期删除: 分组=%s, IP=%s, 添加人=%s, 备注=%s", wl.APIGroup, wl.IP, wl.Operator, wl.Note)
+	}
+	if err := ReloadWhitelists(); err != nil {
+		return len(expired), fmt.Errorf("刷新白名单缓存失败: %w", err)
+	}
+	return len(expired), nil
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"loginServer/config"
+	"loginServer/pkg/proxyproto"
 	"loginServer/src/log"
 	"net"
 	"net/http"
@@ -39,11 +40,44 @@ func createHTTPServer(addr string, handler http.Handler) *http.Server {
 	}
 }
 
+// createListener 创建监听端口，按配置启用 PROXY protocol（只解析可信代理发来的头部）
+func createListener(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Config.GetBool("trusted_proxy.proxy_protocol") {
+		return listener, nil
+	}
+	log.Info("已启用 PROXY protocol")
+	return &proxyproto.Listener{
+		Listener:      listener,
+		Trusted:       isTrustedProxy,
+		HeaderTimeout: proxyProtocolTimeout(),
+	}, nil
+}
+
 // Start 启动 HTTP 服务器
 func Start() {
 	initCache()
+	// 玩家历史写缓冲（按配置开启）
+	startHistoryBuffer()
+	// 后台定时任务
+	startCronJobs()
+	// 公告缓存后台刷新
+	startNoticeRefresher()
+	// 公告统计后台写库
+	startNoticeStats()
+	// 实时推送
+	startPush()
 	// 初始化IP白名单（优先从数据库加载，失败则从配置文件加载）
 	InitWhitelistFromDB()
+	// 多实例缓存同步
+	startCacheSync()
+	// IP黑名单和自动封禁
+	startDenylist()
+	// 地区访问限制（GeoIP 数据库按文件变化自动重新加载）
+	startGeoIP()
 
 	// 获取并设置 Gin 运行模式
 	ginmod := config.Config.GetString("gin.mod")
@@ -51,7 +85,13 @@ func Start() {
 		ginmod = gin.DebugMode
 	}
 	gin.SetMode(ginmod)
-	req := gin.Default()
+	// 客户端 IP 由 getClientIP 按可信代理配置解析，不使用 gin 自带的转发头处理
+	loadTrustedProxies()
+	req := gin.New()
+	req.Use(gin.LoggerWithFormatter(accessLogFormatter), gin.Recovery())
+	if err := req.SetTrustedProxies(nil); err != nil {
+		log.Error("SetTrustedProxies failed: %v", err)
+	}
 	request(req)
 
 	// 1. 获取配置中的 IP
@@ -75,11 +115,17 @@ func Start() {
 
 	server := createHTTPServer(addr, req)
 
+	listener, err := createListener(addr)
+	if err != nil {
+		log.Error("HTTP server failed to listen on %s: %v", addr, err)
+		os.Exit(1)
+	}
+
 	// 启动服务器
 	serverErr := make(chan error, 1)
 	go func() {
 		log.Info("HTTP server starting on %s", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			serverErr <- err
 		}
 	}()
@@ -98,7 +144,13 @@ func Start() {
 
 // Stop 停止服务（预留函数，可在关闭时执行清理操作）
 func Stop() {
-	// 预留清理操作
+	stopCronJobs()
+	stopNoticeRefresher()
+	// 断开推送长连接，否则 HTTP 服务关闭时会一直等待这些连接
+	stopPush()
+	stopCacheSync()
+	stopDenylist()
+	stopGeoIP()
 }
 
 // gracefulExitServer 优雅关闭服务器，监听系统信号并安全关闭
@@ -125,6 +177,10 @@ func gracefulExitServer(server *http.Server) {
 	} else {
 		log.Info("HTTP server shutdown successfully, took: %v", time.Since(startTime))
 	}
+
+	// HTTP 服务已停止接收请求，写入缓冲中剩余的玩家历史和公告统计
+	stopHistoryBuffer()
+	stopNoticeStats()
 }
 
 // getLocalIPv4 获取本机首个非回环的 IPv4 地址
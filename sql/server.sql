@@ -11,23 +11,28 @@ CREATE TABLE IF NOT EXISTS `game_list` (
     `port` int NULL DEFAULT NULL COMMENT '游戏服登录端口',
     `desc` varchar(255) NULL DEFAULT NULL COMMENT '描述',
     `info` text NULL DEFAULT NULL COMMENT '额外信息',
+    `tags` varchar(255) NULL DEFAULT NULL COMMENT '角标标签，逗号分隔：hot,recommend,new',
+    `sort` int NULL DEFAULT 0 COMMENT '排序权重：数值越大越靠前',
+    `group_id` bigint UNSIGNED NULL DEFAULT 0 COMMENT '显示分组ID：0表示按分组范围自动归组',
     -- 复合主键
     PRIMARY KEY (`cluster_id`, `game_id`)
 ) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_general_ci COMMENT = '游戏服务器列表';
 CREATE TABLE IF NOT EXISTS `user_player_history` (
     `account_id` varchar(255) NOT NULL COMMENT '玩家账号id',
     `state` tinyint NULL DEFAULT 0 COMMENT '当前状态：0正常账号  1白名单',
-    `player_list` JSON NULL COMMENT '玩家游戏服列表数组，包含: cluster_id, game_id, player_id ...',
+    `player_list` JSON NULL COMMENT '玩家游戏服列表数组，包含: cluster_id, game_id, player_id, role_name, level, class, avatar, last_login_time',
     `info` text NULL DEFAULT NULL COMMENT '玩家历史额外信息',
+    `version` bigint NOT NULL DEFAULT 0 COMMENT '版本号：每次写入递增，用于 Redis 缓存的版本比较',
     PRIMARY KEY (`account_id`)
 ) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_general_ci ROW_FORMAT = Dynamic COMMENT = '玩家历史表';
 CREATE TABLE IF NOT EXISTS `login_notice` (
     `id` BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
     `notice_type` TINYINT(3) UNSIGNED NOT NULL DEFAULT '1' COMMENT '公告类型: 1-更新通知, 2-公平运营声明, 3-游戏圈邀请',
     `title` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '公告标题 (Tab页显示的文字)',
-    `content` TEXT COMMENT '公告正文内容 (支持HTML或富文本标记)',
+    `content` TEXT COMMENT '公告正文内容 (格式见 content_format，下发时转换为客户端富文本)',
     `banner_url` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '顶部Banner图片的URL地址',
     `priority` INT(11) NOT NULL DEFAULT '0' COMMENT '优先级: 数值越大越靠前',
+    `sort` INT(11) NOT NULL DEFAULT '0' COMMENT '下发顺序(客户端Tab顺序): 数值越大越靠前',
     `is_enable` TINYINT(1) NOT NULL DEFAULT '1' COMMENT '开关: 0-关闭, 1-开启',
     `start_time` BIGINT(20) NOT NULL COMMENT '开始展示时间',
     `end_time` BIGINT(20) NOT NULL COMMENT '结束展示时间',
@@ -35,6 +40,18 @@ CREATE TABLE IF NOT EXISTS `login_notice` (
     `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
     `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
     `info` text NULL DEFAULT NULL COMMENT '额外信息',
+    `platforms` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '定向平台，逗号分隔：ios,android,pc；空表示不限',
+    `channels` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '定向渠道，逗号分隔；空表示不限',
+    `min_version` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '客户端最低版本（含）；空表示不限',
+    `max_version` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '客户端最高版本（含）；空表示不限',
+    `cluster_ids` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '定向集群ID，逗号分隔；空表示不限',
+    `languages` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '定向语言，逗号分隔：zh,en,ja；空表示不限',
+    `accounts` TEXT NULL DEFAULT NULL COMMENT '定向账号白名单，逗号分隔；空表示不限',
+    `content_format` VARCHAR(16) NOT NULL DEFAULT 'html' COMMENT '正文格式: html/markdown/text',
+    `status` TINYINT(3) UNSIGNED NOT NULL DEFAULT '0' COMMENT '状态: 0-草稿, 1-待审核, 2-已审核, 3-已发布, 4-已归档',
+    `submitter` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '提交审核人',
+    `approver` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '审核人',
+    `version` INT(11) NOT NULL DEFAULT '1' COMMENT '乐观锁版本号，每次修改递增',
     PRIMARY KEY (`id`),
     KEY `idx_type_time` (`notice_type`, `start_time`, `end_time`) USING BTREE COMMENT '用于快速筛选当前有效的某类公告'
 ) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '登录服公告配置表';
@@ -44,7 +61,124 @@ CREATE TABLE IF NOT EXISTS `ip_whitelist` (
     `ip` VARCHAR(64) NOT NULL COMMENT 'IP地址或CIDR（如: 127.0.0.1 或 192.168.1.0/24）',
     `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
     `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
+    `info` TEXT NULL DEFAULT NULL COMMENT '备注；ip为空的记录是分组占位（分组存在但为空列表）',
+    `expire_at` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '过期时间，0表示永不过期',
+    `operator` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '添加人',
+    PRIMARY KEY (`id`),
+    KEY `idx_api_group` (`api_group`) USING BTREE COMMENT '用于快速查询指定分组的白名单',
+    KEY `idx_expire_at` (`expire_at`) USING BTREE COMMENT '用于清理已过期的条目'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = 'IP白名单配置表';
+CREATE TABLE IF NOT EXISTS `ip_denylist` (
+    `id` BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+    `ip` VARCHAR(64) NOT NULL COMMENT 'IP地址或CIDR',
+    `reason` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '封禁原因',
+    `expire_at` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '过期时间，0表示永不过期',
+    `operator` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '添加人',
+    `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
+    `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_ip` (`ip`) USING BTREE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = 'IP黑名单表（手动添加，自动封禁保存在Redis）';
+CREATE TABLE IF NOT EXISTS `server_group` (
+    `id` BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+    `name` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '分组名称 (页签显示的文字)',
+    `sort` INT(11) NOT NULL DEFAULT '0' COMMENT '排序权重: 数值越大越靠前',
+    `is_show` TINYINT(1) NOT NULL DEFAULT '1' COMMENT '是否展示：0否 1是',
+    `cluster_id` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '自动归组的集群限制：0表示不限',
+    `min_game_id` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '自动归组的区服范围下限（含）',
+    `max_game_id` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '自动归组的区服范围上限（含），0表示不按范围归组',
+    `desc` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '描述',
+    `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
+    `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
     `info` TEXT NULL DEFAULT NULL COMMENT '额外信息',
+    PRIMARY KEY (`id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '服务器显示分组表';
+CREATE TABLE IF NOT EXISTS `player_index` (
+    `cluster_id` bigint NOT NULL COMMENT '所属集群ID',
+    `game_id` bigint NOT NULL COMMENT '游戏服ID',
+    `player_id` bigint NOT NULL COMMENT '角色ID',
+    `account_id` varchar(255) NOT NULL COMMENT '所属账号id',
+    `last_login_time` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '角色最后登录时间：多个账号引用同一角色时归属最后登录的账号',
+    `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
+    PRIMARY KEY (`cluster_id`, `game_id`, `player_id`),
+    KEY `idx_player_id` (`player_id`) USING BTREE COMMENT '按角色ID反查（不指定游戏服时）',
+    KEY `idx_account_id` (`account_id`) USING BTREE COMMENT '按账号同步/删除索引'
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_general_ci COMMENT = '角色ID反查账号索引表';
+CREATE TABLE IF NOT EXISTS `account_audit` (
+    `id` BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+    `account_id` varchar(255) NOT NULL COMMENT '玩家账号id（数据删除后替换为 erased:摘要）',
+    `action` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '操作类型：set_state / remove_role / export / erasure_request / erasure_cancel',
+    `operator` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '操作人',
+    `detail` TEXT NULL DEFAULT NULL COMMENT '操作详情',
+    `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
     PRIMARY KEY (`id`),
-    KEY `idx_api_group` (`api_group`) USING BTREE COMMENT '用于快速查询指定分组的白名单'
-) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = 'IP白名单配置表';
\ No newline at end of file
+    KEY `idx_account_id` (`account_id`) USING BTREE COMMENT '按账号查询审计记录'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '账号操作审计表';
+CREATE TABLE IF NOT EXISTS `account_erasure` (
+    `id` BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+    `account_id` varchar(255) NOT NULL DEFAULT '' COMMENT '玩家账号id（执行后清空）',
+    `account_hash` CHAR(64) NOT NULL COMMENT '账号id摘要，执行后用于证明该账号已删除',
+    `status` TINYINT(3) NOT NULL DEFAULT '0' COMMENT '状态：0冷静期 1已执行 2已撤销',
+    `reason` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '申请原因/工单号',
+    `operator` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '申请人',
+    `cancel_operator` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '撤销人',
+    `execute_after` BIGINT(20) NOT NULL COMMENT '冷静期结束时间',
+    `executed_at` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '执行时间',
+    `attempts` INT(11) NOT NULL DEFAULT '0' COMMENT '通知游戏服失败次数',
+    `notify_result` TEXT NULL DEFAULT NULL COMMENT '最近一次通知游戏服的结果(JSON)',
+    `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
+    `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_account_id` (`account_id`) USING BTREE,
+    KEY `idx_status_time` (`status`, `execute_after`) USING BTREE COMMENT '定时任务查询到期申请'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '账号数据删除申请表';
+CREATE TABLE IF NOT EXISTS `erasure_log` (
+    `id` BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+    `erasure_id` BIGINT(20) UNSIGNED NOT NULL COMMENT '删除申请ID',
+    `account_hash` CHAR(64) NOT NULL COMMENT '账号id摘要',
+    `executed_at` BIGINT(20) NOT NULL COMMENT '执行时间',
+    `summary` TEXT NULL DEFAULT NULL COMMENT '删除内容摘要(JSON，不含个人数据)',
+    `prev_hash` CHAR(64) NOT NULL DEFAULT '' COMMENT '上一条记录的哈希',
+    `hash` CHAR(64) NOT NULL COMMENT 'sha256(prev_hash|erasure_id|account_hash|executed_at|summary)',
+    PRIMARY KEY (`id`),
+    KEY `idx_account_hash` (`account_hash`) USING BTREE COMMENT '按账号摘要查询删除凭证'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '账号数据删除记录（只追加，哈希链防篡改）';
+CREATE TABLE IF NOT EXISTS `erasure_log_lock` (
+    `id` TINYINT(3) UNSIGNED NOT NULL COMMENT '固定为1',
+    PRIMARY KEY (`id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '删除记录哈希链追加锁（只有一行，追加前 SELECT ... FOR UPDATE）';
+INSERT IGNORE INTO `erasure_log_lock` (`id`) VALUES (1);
+CREATE TABLE IF NOT EXISTS `login_notice_i18n` (
+    `notice_id` BIGINT(20) UNSIGNED NOT NULL COMMENT '公告ID',
+    `locale` VARCHAR(16) NOT NULL COMMENT '语言，如 en、ja、zh-tw',
+    `title` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '公告标题',
+    `content` TEXT COMMENT '公告正文内容',
+    `banner_url` VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Banner图片地址，为空时沿用默认语言',
+    `operator` VARCHAR(32) DEFAULT '' COMMENT '操作人 (GM账号)',
+    `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
+    `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
+    PRIMARY KEY (`notice_id`, `locale`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '登录服公告多语言翻译表';
+CREATE TABLE IF NOT EXISTS `login_notice_revision` (
+    `id` BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+    `notice_id` BIGINT(20) UNSIGNED NOT NULL COMMENT '公告ID',
+    `revision` INT(11) NOT NULL COMMENT '公告内的修订序号，从1开始',
+    `action` VARCHAR(16) NOT NULL COMMENT '操作: create/update/submit/approve/reject/publish/withdraw/archive/restore',
+    `status` TINYINT(3) UNSIGNED NOT NULL COMMENT '操作后的状态',
+    `operator` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '操作人 (GM账号)',
+    `comment` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '审核意见/恢复的版本号',
+    `snapshot` MEDIUMTEXT NOT NULL COMMENT '公告完整内容(JSON)',
+    `created_at` BIGINT(20) NOT NULL COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_notice_revision` (`notice_id`, `revision`) USING BTREE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '登录服公告修订记录表';
+CREATE TABLE IF NOT EXISTS `notice_stat` (
+    `notice_id` BIGINT(20) UNSIGNED NOT NULL COMMENT '公告ID',
+    `stat_date` INT(11) NOT NULL COMMENT '统计日期，如 20260101（服务器本地时间）',
+    `impressions` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '展示次数',
+    `dismisses` BIGINT(20) NOT NULL DEFAULT '0' COMMENT '关闭次数',
+    `clicks` BIGINT(20) NOT NULL DEFAULT '0' COMMENT 'Banner点击次数',
+    `updated_at` BIGINT(20) NOT NULL COMMENT '最后更新时间',
+    PRIMARY KEY (`notice_id`, `stat_date`),
+    KEY `idx_stat_date` (`stat_date`) USING BTREE COMMENT '按日期范围汇总'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '登录服公告每日统计表';
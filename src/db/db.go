@@ -1,9 +1,12 @@
 package db
 
 import (
+	"encoding/json"
 	"fmt"
+	"loginServer/config"
 	"loginServer/src/db/db_mysql"
 	"loginServer/src/db/db_redis"
+	"time"
 )
 
 func Start() error {
@@ -29,39 +32,270 @@ func BatchUpdateServerInfo(serverReqs []db_mysql.GameList) error {
 	return db_mysql.BatchUpdateServerInfo(serverReqs)
 }
 
+// UpdateServerDisplay 更新服务器展示属性（标签、排序、分组）
+func UpdateServerDisplay(serverReqs []db_mysql.GameList) error {
+	return db_mysql.UpdateServerDisplay(serverReqs)
+}
+
+// LoadServerGroups 加载所有服务器分组
+func LoadServerGroups() ([]db_mysql.ServerGroup, error) {
+	return db_mysql.LoadServerGroups()
+}
+
+// CreateServerGroup 创建服务器分组
+func CreateServerGroup(group db_mysql.ServerGroup) error {
+	return db_mysql.CreateServerGroup(group)
+}
+
+// UpdateServerGroup 更新服务器分组
+func UpdateServerGroup(group db_mysql.ServerGroup) error {
+	return db_mysql.UpdateServerGroup(group)
+}
+
+// DeleteServerGroup 删除服务器分组
+func DeleteServerGroup(id uint64) error {
+	return db_mysql.DeleteServerGroup(id)
+}
+
+// ========== 玩家历史（Redis 写穿缓存 + MySQL） ==========
+// 读：先查 Redis，未命中查 MySQL 后回填；不存在的账号做短时间的负缓存
+// 写：MySQL 事务提交后把写入后的完整记录写入 Redis；删除账号时写入带版本号的负缓存
+// 缓存值带有记录的版本号（每次写入递增），Redis 只接受比已缓存版本更新的数据，
+// 多个实例并发写入/回填时旧数据不会覆盖新数据；Redis 未配置或故障时所有操作直接走 MySQL
+
+const (
+	keyUserHistory            = "loginServer:history:" // 玩家历史缓存 key 前缀
+	negativeHistoryValue      = "-"                    // 负缓存占位值（账号不存在）
+	defaultHistoryTTL         = 10 * time.Minute
+	defaultNegativeHistoryTTL = time.Minute
+)
+
+// userHistoryKey 生成玩家历史缓存 key
+func userHistoryKey(accountID string) string {
+	return keyUserHistory + accountID
+}
+
+// cacheUserHistory 把写入后的记录写入缓存（版本号不高于已缓存版本时忽略）
+func cacheUserHistory(histories ...db_mysql.UserPlayerHistory) {
+	ttl := configDuration("redis.history_ttl_sec", defaultHistoryTTL)
+	for _, history := range histories {
+		data, err := json.Marshal(history)
+		if err != nil {
+			db_redis.Del(userHistoryKey(history.AccountID))
+			continue
+		}
+		db_redis.SetIfNewer(userHistoryKey(history.AccountID), history.Version, data, ttl)
+	}
+}
+
+// cacheDeletedUserHistory 账号记录被删除后写入负缓存，版本号取当前毫秒时间戳，
+// 删除前读到旧数据的实例不会再把旧数据回填到缓存
+func cacheDeletedUserHistory(accountID string) {
+	db_redis.SetIfNewer(userHistoryKey(accountID), time.Now().UnixMilli(), []byte(negativeHistoryValue),
+		configDuration("redis.history_negative_ttl_sec", defaultNegativeHistoryTTL))
+}
+
 // GetUserHistory 获取用户服务器列表
 func GetUserHistory(accountID string) (db_mysql.UserPlayerHistory, error) {
-	return db_mysql.GetUserHistory(accountID)
+	key := userHistoryKey(accountID)
+	if version, data, found := db_redis.GetVersioned(key); found {
+		if string(data) == negativeHistoryValue {
+			return db_mysql.UserPlayerHistory{AccountID: accountID, PlayerList: []db_mysql.PlayerHistoryItem{}}, nil
+		}
+		var history db_mysql.UserPlayerHistory
+		if err := json.Unmarshal(data, &history); err == nil {
+			history.Version = version
+			return history, nil
+		}
+	}
+
+	history, exists, err := db_mysql.FindUserHistory(accountID)
+	if err != nil {
+		return history, err
+	}
+
+	if !exists {
+		// 版本号 0：不会覆盖任何写入的数据
+		db_redis.SetIfNewer(key, 0, []byte(negativeHistoryValue), configDuration("redis.history_negative_ttl_sec", defaultNegativeHistoryTTL))
+	} else {
+		cacheUserHistory(history)
+	}
+	return history, nil
 }
 
 // SetUserHistory 保存/更新玩家历史
-func SetUserHistory(accountID string, newItem db_mysql.PlayerHistoryItem) error {
-	return db_mysql.SetUserHistory(accountID, newItem)
+func SetUserHistory(accountID string, update db_mysql.PlayerHistoryUpdate) error {
+	history, err := db_mysql.SetUserHistory(accountID, update)
+	if err != nil {
+		db_redis.Del(userHistoryKey(accountID))
+		return err
+	}
+	cacheUserHistory(history)
+	return nil
+}
+
+// BatchSetUserHistory 批量保存/更新玩家历史（accountID -> 按时间顺序的增量更新）
+func BatchSetUserHistory(updates map[string][]db_mysql.PlayerHistoryUpdate) error {
+	histories, err := db_mysql.BatchSetUserHistory(updates)
+	if err != nil {
+		keys := make([]string, 0, len(updates))
+		for accountID := range updates {
+			keys = append(keys, userHistoryKey(accountID))
+		}
+		db_redis.Del(keys...)
+		return err
+	}
+	cacheUserHistory(histories...)
+	return nil
+}
+
+// RemoveUserHistoryItem 从账号历史中删除指定角色
+func RemoveUserHistoryItem(accountID string, clusterID, gameID int, playerID int64) error {
+	history, changed, err := db_mysql.RemoveUserHistoryItem(accountID, clusterID, gameID, playerID)
+	if err != nil {
+		db_redis.Del(userHistoryKey(accountID))
+		return err
+	}
+	if changed {
+		cacheUserHistory(history)
+	}
+	return nil
+}
+
+// CleanupHistoryByServers 清理指向已不存在游戏服的历史记录，返回清理的记录条数
+func CleanupHistoryByServers(validServers map[db_mysql.ServerKey]bool) (int, error) {
+	removed, changed, err := db_mysql.CleanupHistoryByServers(validServers)
+	cacheUserHistory(changed...)
+	return removed, err
+}
+
+// DeleteUserHistory 删除账号的历史记录
+func DeleteUserHistory(accountID string) error {
+	if err := db_mysql.DeleteUserHistory(accountID); err != nil {
+		db_redis.Del(userHistoryKey(accountID))
+		return err
+	}
+	cacheDeletedUserHistory(accountID)
+	return nil
 }
 
 // SetUserState 更新用户账号状态
 func SetUserState(accountID string, state int) error {
-	return db_mysql.SetUserState(accountID, state)
+	history, exists, err := db_mysql.SetUserState(accountID, state)
+	if err != nil {
+		db_redis.Del(userHistoryKey(accountID))
+		return err
+	}
+	if exists {
+		cacheUserHistory(history)
+	}
+	return nil
+}
+
+// SearchPlayerIndex 分页查询角色反查索引
+func SearchPlayerIndex(filter db_mysql.PlayerIndexFilter, page, pageSize int) ([]db_mysql.PlayerIndex, int64, error) {
+	return db_mysql.SearchPlayerIndex(filter, page, pageSize)
+}
+
+// SearchUserHistoryByPrefix 按账号前缀分页查询玩家历史
+func SearchUserHistoryByPrefix(prefix string, page, pageSize int) ([]db_mysql.UserPlayerHistory, int64, error) {
+	return db_mysql.SearchUserHistoryByPrefix(prefix, page, pageSize)
+}
+
+// RebuildPlayerIndex 全量重建角色反查索引，返回处理的账号数
+func RebuildPlayerIndex() (int, error) {
+	return db_mysql.RebuildPlayerIndex()
+}
+
+// ========== 账号审计与数据删除 ==========
+
+// AddAccountAudit 写入账号审计记录
+func AddAccountAudit(audit db_mysql.AccountAudit) error {
+	return db_mysql.AddAccountAudit(audit)
+}
+
+// GetAccountAudits 获取账号的审计记录
+func GetAccountAudits(accountID string) ([]db_mysql.AccountAudit, error) {
+	return db_mysql.GetAccountAudits(accountID)
+}
+
+// GetPlayerIndexByAccount 获取账号下的全部角色索引
+func GetPlayerIndexByAccount(accountID string) ([]db_mysql.PlayerIndex, error) {
+	return db_mysql.GetPlayerIndexByAccount(accountID)
+}
+
+// CreateAccountErasure 创建数据删除申请
+func CreateAccountErasure(erasure *db_mysql.AccountErasure) error {
+	return db_mysql.CreateAccountErasure(erasure)
+}
+
+// CancelAccountErasure 撤销冷静期中的数据删除申请
+func CancelAccountErasure(id uint64, operator string) (db_mysql.AccountErasure, error) {
+	return db_mysql.CancelAccountErasure(id, operator)
+}
+
+// GetAccountErasures 获取账号的数据删除申请
+func GetAccountErasures(accountID string) ([]db_mysql.AccountErasure, error) {
+	return db_mysql.GetAccountErasures(accountID)
+}
+
+// GetErasureList 分页查询数据删除申请
+func GetErasureList(page, pageSize int, status *int) ([]db_mysql.AccountErasure, int64, error) {
+	return db_mysql.GetErasureList(page, pageSize, status)
+}
+
+// GetDueErasures 获取冷静期已结束的数据删除申请
+func GetDueErasures(now int64, afterID uint64, limit int) ([]db_mysql.AccountErasure, error) {
+	return db_mysql.GetDueErasures(now, afterID, limit)
+}
+
+// SetErasureNotifyFailed 记录通知游戏服失败
+func SetErasureNotifyFailed(id uint64, notifyResult string) error {
+	return db_mysql.SetErasureNotifyFailed(id, notifyResult)
+}
+
+// ExecuteAccountErasure 执行数据删除并追加哈希链记录
+func ExecuteAccountErasure(erasure db_mysql.AccountErasure, summary string, notifyResult string) (db_mysql.ErasureLog, error) {
+	entry, err := db_mysql.ExecuteAccountErasure(erasure.ID, summary, notifyResult)
+	if err != nil {
+		db_redis.Del(userHistoryKey(erasure.AccountID))
+		return entry, err
+	}
+	cacheDeletedUserHistory(erasure.AccountID)
+	return entry, nil
+}
+
+// VerifyErasureLog 校验数据删除记录的哈希链
+func VerifyErasureLog() (int, uint64, error) {
+	return db_mysql.VerifyErasureLog()
+}
+
+// configDuration 读取秒级配置，未配置时使用默认值
+func configDuration(key string, defaultValue time.Duration) time.Duration {
+	if sec := config.Config.GetInt(key); sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return defaultValue
 }
 
 // CreateLoginNotice 创建公告
-func CreateLoginNotice(notice db_mysql.LoginNotice) error {
+func CreateLoginNotice(notice db_mysql.LoginNotice) (db_mysql.LoginNotice, error) {
 	return db_mysql.CreateLoginNotice(notice)
 }
 
-// DeleteLoginNotice 删除公告
-func DeleteLoginNotice(id uint64) error {
-	return db_mysql.DeleteLoginNotice(id)
+// DeleteLoginNotice 删除已归档的公告
+func DeleteLoginNotice(id uint64, operator string) error {
+	return db_mysql.DeleteLoginNotice(id, operator)
 }
 
-// BatchDeleteLoginNotice 批量删除公告
-func BatchDeleteLoginNotice(ids []uint64) error {
-	return db_mysql.BatchDeleteLoginNotice(ids)
+// BatchDeleteLoginNotice 批量删除已归档的公告
+func BatchDeleteLoginNotice(ids []uint64, operator string) error {
+	return db_mysql.BatchDeleteLoginNotice(ids, operator)
 }
 
-// UpdateLoginNotice 更新公告
-func UpdateLoginNotice(notice db_mysql.LoginNotice) error {
-	return db_mysql.UpdateLoginNotice(notice)
+// UpdateLoginNotice 更新公告（乐观锁，apply 只修改请求中携带的字段）
+func UpdateLoginNotice(id uint64, version int, apply func(notice *db_mysql.LoginNotice) error) (db_mysql.LoginNotice, error) {
+	return db_mysql.UpdateLoginNotice(id, version, apply)
 }
 
 // FindLoginNotice 单条查询
@@ -70,8 +304,28 @@ func FindLoginNotice(id uint64) (db_mysql.LoginNotice, error) {
 }
 
 // GetLoginNoticeList 分页查询 (带搜索)
-func GetLoginNoticeList(page, pageSize int, title string, noticeType int, isEnable *int) ([]db_mysql.LoginNotice, int64, error) {
-	return db_mysql.GetLoginNoticeList(page, pageSize, title, noticeType, isEnable)
+func GetLoginNoticeList(page, pageSize int, title string, noticeType int, isEnable, status *int) ([]db_mysql.LoginNotice, int64, error) {
+	return db_mysql.GetLoginNoticeList(page, pageSize, title, noticeType, isEnable, status)
+}
+
+// TransitionLoginNotice 执行公告审核流程操作（乐观锁）
+func TransitionLoginNotice(id uint64, version int, action, operator, comment string) (db_mysql.LoginNotice, error) {
+	return db_mysql.TransitionLoginNotice(id, version, action, operator, comment)
+}
+
+// RestoreLoginNotice 将公告恢复到指定修订版本（乐观锁）
+func RestoreLoginNotice(id uint64, version, revision int, operator string) (db_mysql.LoginNotice, error) {
+	return db_mysql.RestoreLoginNotice(id, version, revision, operator)
+}
+
+// GetNoticeRevisions 获取公告的全部修订记录
+func GetNoticeRevisions(noticeID uint64) ([]db_mysql.LoginNoticeRevision, error) {
+	return db_mysql.GetNoticeRevisions(noticeID)
+}
+
+// FindNoticeRevision 查询公告的指定修订版本
+func FindNoticeRevision(noticeID uint64, revision int) (db_mysql.LoginNoticeRevision, error) {
+	return db_mysql.FindNoticeRevision(noticeID, revision)
 }
 
 // LoadNotice 从数据库加载数据
@@ -79,6 +333,36 @@ func LoadNotice() ([]db_mysql.LoginNotice, error) {
 	return db_mysql.LoadNotice()
 }
 
+// AddNoticeStats 累加公告统计
+func AddNoticeStats(list []db_mysql.NoticeStat) error {
+	return db_mysql.AddNoticeStats(list)
+}
+
+// GetNoticeStats 获取单个公告的每日统计
+func GetNoticeStats(noticeID uint64, startDate, endDate int) ([]db_mysql.NoticeStat, error) {
+	return db_mysql.GetNoticeStats(noticeID, startDate, endDate)
+}
+
+// GetNoticeStatSummary 获取每个公告的合计
+func GetNoticeStatSummary(startDate, endDate int) ([]db_mysql.NoticeStat, error) {
+	return db_mysql.GetNoticeStatSummary(startDate, endDate)
+}
+
+// LoadNoticeI18n 加载指定公告的全部翻译
+func LoadNoticeI18n(noticeIDs []uint64) ([]db_mysql.LoginNoticeI18n, error) {
+	return db_mysql.LoadNoticeI18n(noticeIDs)
+}
+
+// SetNoticeI18n 新增或覆盖一条公告翻译（乐观锁，修改后公告退回草稿）
+func SetNoticeI18n(item db_mysql.LoginNoticeI18n, version int) (db_mysql.LoginNotice, error) {
+	return db_mysql.SetNoticeI18n(item, version)
+}
+
+// DeleteNoticeI18n 删除一条公告翻译（乐观锁，修改后公告退回草稿）
+func DeleteNoticeI18n(noticeID uint64, locale string, version int, operator string) (db_mysql.LoginNotice, error) {
+	return db_mysql.DeleteNoticeI18n(noticeID, locale, version, operator)
+}
+
 // ========== IP白名单 ==========
 
 // LoadWhitelist 从数据库加载指定分组的白名单
@@ -92,13 +376,13 @@ func LoadAllWhitelists() ([]db_mysql.IPWhitelist, error) {
 }
 
 // SetWhitelist 设置指定分组的IP白名单（完全替换）
-func SetWhitelist(apiGroup string, ips []string) error {
-	return db_mysql.SetWhitelist(apiGroup, ips)
+func SetWhitelist(apiGroup string, ips []string, operator string) error {
+	return db_mysql.SetWhitelist(apiGroup, ips, operator)
 }
 
-// AddWhitelistIP 向指定分组添加IP
-func AddWhitelistIP(apiGroup string, ip string) error {
-	return db_mysql.AddWhitelistIP(apiGroup, ip)
+// AddWhitelistIP 向指定分组添加IP（已存在时更新过期时间、备注和添加人）
+func AddWhitelistIP(entry db_mysql.IPWhitelist) error {
+	return db_mysql.AddWhitelistIP(entry)
 }
 
 // RemoveWhitelistIP 从指定分组删除IP
@@ -110,3 +394,79 @@ func RemoveWhitelistIP(apiGroup string, ip string) error {
 func RemoveWhitelistGroup(apiGroup string) error {
 	return db_mysql.RemoveWhitelistGroup(apiGroup)
 }
+
+// PurgeExpiredWhitelist 删除已过期的白名单记录
+func PurgeExpiredWhitelist(now int64) ([]db_mysql.IPWhitelist, error) {
+	return db_mysql.PurgeExpiredWhitelist(now)
+}
+
+// ========== IP黑名单 ==========
+// 手动条目保存在 MySQL；自动封禁和滥用计数保存在 Redis（未配置或不可用时调用方使用本实例内存）
+
+// LoadDenylist 从数据库加载全部黑名单
+func LoadDenylist() ([]db_mysql.IPDenylist, error) {
+	return db_mysql.LoadDenylist()
+}
+
+// AddDenylistIP 添加黑名单（已存在时更新）
+func AddDenylistIP(entry db_mysql.IPDenylist) error {
+	return db_mysql.AddDenylistIP(entry)
+}
+
+// RemoveDenylistIP 删除黑名单，返回是否存在该记录
+func RemoveDenylistIP(ip string) (bool, error) {
+	return db_mysql.RemoveDenylistIP(ip)
+}
+
+// PurgeExpiredDenylist 删除已过期的黑名单记录
+func PurgeExpiredDenylist(now int64) (int64, error) {
+	return db_mysql.PurgeExpiredDenylist(now)
+}
+
+// CountInWindow 按时间窗口计数（key 中应包含窗口编号），返回窗口内的累计次数
+func CountInWindow(key string, n int64, ttl time.Duration) (int64, error) {
+	return db_redis.IncrExpire(key, n, ttl)
+}
+
+// ResetCounters 删除计数器
+func ResetCounters(keys ...string) {
+	db_redis.Del(keys...)
+}
+
+// SaveSharedBan 保存自动封禁到 Redis 哈希表
+func SaveSharedBan(key, ip string, payload []byte) error {
+	return db_redis.HSet(key, ip, payload)
+}
+
+// DeleteSharedBans 从 Redis 哈希表删除自动封禁
+func DeleteSharedBans(key string, ips ...string) error {
+	return db_redis.HDel(key, ips...)
+}
+
+// LoadSharedBans 读取 Redis 哈希表中的全部自动封禁（ip -> payload）
+func LoadSharedBans(key string) (map[string]string, error) {
+	return db_redis.HGetAll(key)
+}
+
+// ========== 实例间消息广播（Redis 发布/订阅） ==========
+// 多个 loginServer 实例通过 Redis 频道互相通知；未配置 Redis 时只在本实例内生效
+
+// BroadcastEnabled 是否配置了 Redis（可以跨实例广播）
+func BroadcastEnabled() bool {
+	return db_redis.DB != nil
+}
+
+// PublishSequenced 分配全局递增序号（不小于 floor）并发布消息（原子执行，订阅方按序号顺序收到 "序号|消息"）
+func PublishSequenced(seqKey, channel string, payload []byte, floor int64) (int64, error) {
+	return db_redis.PublishSequenced(seqKey, channel, payload, floor)
+}
+
+// PublishMessage 发布消息到频道
+func PublishMessage(channel string, payload []byte) error {
+	return db_redis.Publish(channel, payload)
+}
+
+// SubscribeMessages 订阅频道，阻塞直到 stop 关闭；每次（重新）订阅成功时调用 onSubscribe
+func SubscribeMessages(stop <-chan struct{}, channel string, onSubscribe func(), onMessage func(payload string)) {
+	db_redis.Subscribe(stop, channel, onSubscribe, onMessage)
+}
@@ -1,11 +1,20 @@
 package db_mysql
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"loginServer/config"
 	"loginServer/pkg/mysql"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -44,6 +53,9 @@ type GameList struct {
 	Port      *int    `gorm:"column:port" json:"port"`
 	Desc      *string `gorm:"column:desc" json:"desc"`
 	Info      *string `gorm:"column:info" json:"info"`
+	Tags      *string `gorm:"column:tags" json:"tags"`                   // 角标标签，逗号分隔：hot,recommend,new
+	Sort      *int    `gorm:"column:sort;default:0" json:"sort"`         // 排序权重：数值越大越靠前
+	GroupID   *uint64 `gorm:"column:group_id;default:0" json:"group_id"` // 显示分组ID：0 表示按分组的区服范围自动归组
 }
 
 // GetServerList 获取服务器列表
@@ -115,6 +127,15 @@ func updateServerInfoWithTx(tx *gorm.DB, server GameList) error {
 	if server.Info != nil {
 		cols = append(cols, "info")
 	}
+	if server.Tags != nil {
+		cols = append(cols, "tags")
+	}
+	if server.Sort != nil {
+		cols = append(cols, "sort")
+	}
+	if server.GroupID != nil {
+		cols = append(cols, "group_id")
+	}
 	return tx.Clauses(clause.OnConflict{
 		// 1. 冲突检测：复合主键 (cluster_id, game_id)
 		Columns: []clause.Column{{Name: "cluster_id"}, {Name: "game_id"}},
@@ -123,11 +144,97 @@ func updateServerInfoWithTx(tx *gorm.DB, server GameList) error {
 	}).Create(&server).Error
 }
 
+// UpdateServerDisplay 批量更新服务器的展示属性（标签、排序、分组、显示/新服标记）
+// 只更新已存在的服务器，不存在时返回错误，避免运营后台误建空服务器
+func UpdateServerDisplay(servers []GameList) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, server := range servers {
+			updates := make(map[string]any)
+			if server.Tags != nil {
+				updates["tags"] = *server.Tags
+			}
+			if server.Sort != nil {
+				updates["sort"] = *server.Sort
+			}
+			if server.GroupID != nil {
+				updates["group_id"] = *server.GroupID
+			}
+			if server.IsShow != nil {
+				updates["is_show"] = *server.IsShow
+			}
+			if server.IsNew != nil {
+				updates["is_new"] = *server.IsNew
+			}
+			if len(updates) == 0 {
+				continue
+			}
+
+			var count int64
+			if err := tx.Model(&GameList{}).
+				Where("cluster_id = ? AND game_id = ?", server.ClusterID, server.GameID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return fmt.Errorf("服务器不存在: cluster_id=%d, game_id=%d", server.ClusterID, server.GameID)
+			}
+
+			if err := tx.Model(&GameList{}).
+				Where("cluster_id = ? AND game_id = ?", server.ClusterID, server.GameID).
+				Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // PlayerHistoryItem JSON 数组里的每一个元素（单个游戏服记录）
 type PlayerHistoryItem struct {
-	ClusterID int   `json:"cluster_id"`
-	GameID    int   `json:"game_id"`
-	PlayerID  int64 `json:"player_id"`
+	ClusterID     int    `json:"cluster_id"`
+	GameID        int    `json:"game_id"`
+	PlayerID      int64  `json:"player_id"`
+	RoleName      string `json:"role_name"`       // 角色名
+	Level         int    `json:"level"`           // 角色等级
+	Class         int    `json:"class"`           // 职业
+	Avatar        string `json:"avatar"`          // 头像
+	LastLoginTime int64  `json:"last_login_time"` // 最后登录时间（秒级时间戳）
+}
+
+// PlayerHistoryUpdate 单个游戏服记录的增量更新
+// 指针字段为 nil 表示不修改；MoveTop 为 true 表示登录场景，需要把该服移动到列表最前
+type PlayerHistoryUpdate struct {
+	ClusterID     int
+	GameID        int
+	PlayerID      int64
+	RoleName      *string
+	Level         *int
+	Class         *int
+	Avatar        *string
+	LastLoginTime *int64
+	MoveTop       bool
+}
+
+// apply 将增量更新合并到已有记录上
+func (u PlayerHistoryUpdate) apply(item *PlayerHistoryItem) {
+	if u.PlayerID != 0 {
+		item.PlayerID = u.PlayerID
+	}
+	if u.RoleName != nil {
+		item.RoleName = *u.RoleName
+	}
+	if u.Level != nil {
+		item.Level = *u.Level
+	}
+	if u.Class != nil {
+		item.Class = *u.Class
+	}
+	if u.Avatar != nil {
+		item.Avatar = *u.Avatar
+	}
+	if u.LastLoginTime != nil {
+		item.LastLoginTime = *u.LastLoginTime
+	}
 }
 
 // UserPlayerHistory 对应数据库表
@@ -136,90 +243,563 @@ type UserPlayerHistory struct {
 	State      int                 `gorm:"column:state; default:0" json:"state"` //0 正常账号  1 白名单
 	PlayerList []PlayerHistoryItem `gorm:"column:player_list;serializer:json" json:"player_list"`
 	Info       *string             `gorm:"column:info" json:"info"`
+	Version    int64               `gorm:"column:version" json:"-"` // 每次写入递增（不小于当前毫秒时间戳），用于 Redis 缓存的版本比较
+}
+
+// nextHistoryVersion 生成下一个版本号：至少比上一个大 1，且不小于当前毫秒时间戳（账号被删除后重建时版本号也不会回退）
+func nextHistoryVersion(prev int64) int64 {
+	return max(prev+1, time.Now().UnixMilli())
 }
 
 // GetUserHistory 获取玩家的历史记录
 func GetUserHistory(accountID string) (UserPlayerHistory, error) {
-	var history UserPlayerHistory
+	history, _, err := FindUserHistory(accountID)
+	return history, err
+}
 
+// FindUserHistory 获取玩家的历史记录，exists 表示数据库中是否存在该账号
+// 如果记录不存在，返回一个空的结构体（方便前端处理，不要返回 nil）
+func FindUserHistory(accountID string) (history UserPlayerHistory, exists bool, err error) {
 	// 根据 AccountID 查询
-	err := DB.Where("account_id = ?", accountID).First(&history).Error
+	err = DB.Where("account_id = ?", accountID).First(&history).Error
 
-	// 如果记录不存在，返回一个空的结构体（方便前端处理，不要返回 nil）
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return UserPlayerHistory{
 			AccountID:  accountID,
 			PlayerList: []PlayerHistoryItem{},
-		}, nil
+		}, false, nil
+	}
+	if history.PlayerList == nil {
+		history.PlayerList = []PlayerHistoryItem{}
 	}
 
-	return history, err
+	return history, err == nil, err
 }
 
 // SetUserHistory 保存/更新玩家历史
-// 场景：玩家登录游戏服成功、或者升级时调用
-// 逻辑：取出旧数据 -> 更新列表 -> 覆盖写回数据库
-func SetUserHistory(accountID string, newItem PlayerHistoryItem) error {
-	var history UserPlayerHistory
+// 场景：玩家登录游戏服成功、或者升级/改名等角色信息变化时调用
+// 逻辑：事务内锁定账号记录 -> 合并增量更新 -> 写回数据库
+// 同一账号的并发上报（同时登录多个服、Erlang 重试）会在行锁上串行化，不会丢失更新
+// 返回写入后的完整记录
+func SetUserHistory(accountID string, update PlayerHistoryUpdate) (history UserPlayerHistory, err error) {
+	err = withDeadlockRetry(func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			history, err = lockUserHistory(tx, accountID)
+			if err != nil {
+				return err
+			}
 
-	// 先查询是否存在记录
-	err := DB.Where("account_id = ?", accountID).First(&history).Error
+			// 逻辑：如果这个服已经在列表里，更新信息；如果不在，追加。
+			history.PlayerList = mergeAndSortList(history.PlayerList, update)
+			return saveUserHistoryList(tx, &history)
+		})
+	})
+	return history, err
+}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		// 如果是新用户：直接创建
-		history = UserPlayerHistory{
-			AccountID:  accountID,
-			PlayerList: []PlayerHistoryItem{newItem},
-		}
-		return DB.Create(&history).Error
-	} else if err != nil {
-		// 数据库报错
+// BatchSetUserHistory 批量保存玩家历史（开服高峰的批量/缓冲写入）
+// updates: accountID -> 该账号按时间顺序排列的增量更新
+// 单个事务内：批量补齐缺失账号 -> 一次性 SELECT ... FOR UPDATE 锁定所有账号 -> 逐个合并写回
+// 账号按字典序加锁，避免多个批次并发时出现死锁；返回写入后的完整记录
+func BatchSetUserHistory(updates map[string][]PlayerHistoryUpdate) ([]UserPlayerHistory, error) {
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	accountIDs := make([]string, 0, len(updates))
+	for accountID := range updates {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+
+	var histories []UserPlayerHistory
+	err := withDeadlockRetry(func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			empties := make([]UserPlayerHistory, 0, len(accountIDs))
+			for _, accountID := range accountIDs {
+				empties = append(empties, UserPlayerHistory{AccountID: accountID, PlayerList: []PlayerHistoryItem{}})
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&empties).Error; err != nil {
+				return err
+			}
+
+			histories = nil
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("account_id IN ?", accountIDs).
+				Order("account_id ASC").
+				Find(&histories).Error; err != nil {
+				return err
+			}
+
+			for i := range histories {
+				histories[i].PlayerList = ApplyHistoryUpdates(histories[i].PlayerList, updates[histories[i].AccountID])
+				if err := saveUserHistoryList(tx, &histories[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// ApplyHistoryUpdates 按顺序将多条增量更新合并到列表中（与 SetUserHistory 的合并规则一致）
+func ApplyHistoryUpdates(list []PlayerHistoryItem, updates []PlayerHistoryUpdate) []PlayerHistoryItem {
+	for _, update := range updates {
+		list = mergeAndSortList(list, update)
+	}
+	return list
+}
+
+// lockUserHistory 在事务内锁定账号的历史记录（SELECT ... FOR UPDATE）
+// 新账号先以 INSERT ... ON DUPLICATE KEY 方式插入空记录：
+// 既避免并发创建时的主键冲突，也保证后续 FOR UPDATE 一定有行可锁
+func lockUserHistory(tx *gorm.DB, accountID string) (UserPlayerHistory, error) {
+	empty := UserPlayerHistory{
+		AccountID:  accountID,
+		PlayerList: []PlayerHistoryItem{},
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&empty).Error; err != nil {
+		return UserPlayerHistory{}, err
+	}
+
+	var history UserPlayerHistory
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("account_id = ?", accountID).
+		First(&history).Error
+	return history, err
+}
+
+// saveUserHistoryList 只写回 player_list 列（并递增版本号），避免覆盖并发修改的 state 等字段，并在同一事务内同步角色索引
+// GORM 自动将 Slice -> JSON
+func saveUserHistoryList(tx *gorm.DB, history *UserPlayerHistory) error {
+	history.Version = nextHistoryVersion(history.Version)
+	if err := tx.Model(history).Select("player_list", "version").Updates(history).Error; err != nil {
 		return err
 	}
+	return syncPlayerIndex(tx, history.AccountID, history.PlayerList)
+}
 
-	// 如果是老用户更新切片
-	// 逻辑：如果这个服已经在列表里，更新信息；如果不在，追加。
-	history.PlayerList = mergeAndSortList(history.PlayerList, newItem)
+// withDeadlockRetry 事务遇到死锁(1213)或锁等待超时(1205)时重试
+func withDeadlockRetry(fn func() error) error {
+	const maxRetry = 3
+	var err error
+	for i := 0; i < maxRetry; i++ {
+		err = fn()
+		var mysqlErr *mysqldriver.MySQLError
+		if err == nil || !errors.As(err, &mysqlErr) || (mysqlErr.Number != 1213 && mysqlErr.Number != 1205) {
+			return err
+		}
+		time.Sleep(time.Duration(i+1) * 10 * time.Millisecond)
+	}
+	return err
+}
 
-	// 2. 写回数据库 (Save 会自动处理 UPDATE)
-	// GORM 自动将 Slice -> JSON
-	return DB.Save(&history).Error
+// DeleteUserHistory 删除账号的历史记录（连同角色索引）
+func DeleteUserHistory(accountID string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", accountID).Delete(&PlayerIndex{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("account_id = ?", accountID).Delete(&UserPlayerHistory{}).Error
+	})
 }
 
 // mergeAndSortList 列表去重、更新、排序
-func mergeAndSortList(list []PlayerHistoryItem, target PlayerHistoryItem) []PlayerHistoryItem {
+func mergeAndSortList(list []PlayerHistoryItem, update PlayerHistoryUpdate) []PlayerHistoryItem {
 	foundIdx := -1
 	// 1. 寻找是否已存在该服记录
 	for i, item := range list {
-		if item.ClusterID == target.ClusterID && item.GameID == target.GameID {
+		if item.ClusterID == update.ClusterID && item.GameID == update.GameID {
 			foundIdx = i
 			break
 		}
 	}
-	// 2. 更新列表
+
+	// 2. 已存在且不需要置顶（如仅等级变化）：原地更新，不改变顺序
+	if foundIdx != -1 && !update.MoveTop {
+		update.apply(&list[foundIdx])
+		return list
+	}
+
+	// 3. 合并出最新的条目
+	target := PlayerHistoryItem{ClusterID: update.ClusterID, GameID: update.GameID}
 	if foundIdx != -1 {
-		// 如果找到了：更新该条目，并把它移动到数组最前面（最近登录的在最前）
+		target = list[foundIdx]
 		// 删除旧的位置
 		list = append(list[:foundIdx], list[foundIdx+1:]...)
 	}
+	update.apply(&target)
+
 	// 将最新的插入到头部 (Prepend)
 	// 这样前端拿到数组时，第一个就是最近玩的服
 	list = append([]PlayerHistoryItem{target}, list...)
+
+	// 4. 超过上限时按配置的策略裁剪（不会裁掉本次更新的服）
+	return pruneHistoryList(list, update.ClusterID, update.GameID)
+}
+
+// 历史列表裁剪策略（player_history.prune_policy）
+const (
+	PrunePolicyRecent = "recent" // 按列表顺序保留最近玩过的服，裁掉末尾（默认）
+	PrunePolicyLevel  = "level"  // 优先裁掉等级最低的角色，等级相同时裁掉最久未登录的
+)
+
+// pruneHistoryList 列表超过 player_history.max_items 时按策略裁剪，0 或未配置表示不限制
+// keepClusterID/keepGameID 为本次更新的服，始终保留
+func pruneHistoryList(list []PlayerHistoryItem, keepClusterID, keepGameID int) []PlayerHistoryItem {
+	maxItems := config.Config.GetInt("player_history.max_items")
+	if maxItems <= 0 || len(list) <= maxItems {
+		return list
+	}
+
+	if config.Config.GetString("player_history.prune_policy") != PrunePolicyLevel {
+		return list[:maxItems]
+	}
+
+	for len(list) > maxItems {
+		victim := -1
+		for i, item := range list {
+			if item.ClusterID == keepClusterID && item.GameID == keepGameID {
+				continue
+			}
+			if victim == -1 || item.Level < list[victim].Level ||
+				(item.Level == list[victim].Level && item.LastLoginTime <= list[victim].LastLoginTime) {
+				victim = i
+			}
+		}
+		if victim == -1 {
+			break
+		}
+		list = append(list[:victim], list[victim+1:]...)
+	}
 	return list
 }
 
-// SetUserState 修改用户账号状态
-func SetUserState(accountID string, state int) error {
-	// 根据 accountID 更新
-	err := DB.Model(&UserPlayerHistory{}).
-		Where("account_id = ?", accountID).
-		Update("state", state).Error
+// RemoveUserHistoryItem 从账号历史中删除指定角色（游戏服删除角色时调用）
+// playerID 为 0 时删除该服的记录，不校验角色ID；账号或记录不存在时视为成功
+// changed 为 true 时 history 为写入后的完整记录
+func RemoveUserHistoryItem(accountID string, clusterID, gameID int, playerID int64) (history UserPlayerHistory, changed bool, err error) {
+	err = withDeadlockRetry(func() error {
+		changed = false
+		return DB.Transaction(func(tx *gorm.DB) error {
+			history = UserPlayerHistory{}
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("account_id = ?", accountID).
+				First(&history).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			} else if err != nil {
+				return err
+			}
 
-	if err != nil {
+			kept := make([]PlayerHistoryItem, 0, len(history.PlayerList))
+			for _, item := range history.PlayerList {
+				if item.ClusterID == clusterID && item.GameID == gameID && (playerID == 0 || item.PlayerID == playerID) {
+					continue
+				}
+				kept = append(kept, item)
+			}
+			if len(kept) == len(history.PlayerList) {
+				return nil
+			}
+
+			history.PlayerList = kept
+			if err := saveUserHistoryList(tx, &history); err != nil {
+				return err
+			}
+			changed = true
+			return nil
+		})
+	})
+	return history, changed && err == nil, err
+}
+
+// ServerKey 游戏服唯一标识（cluster_id + game_id）
+type ServerKey struct {
+	ClusterID int64
+	GameID    int64
+}
+
+// CleanupHistoryByServers 清理指向已不存在游戏服的历史记录
+// validServers: 当前 game_list 中存在的游戏服；返回被清理的记录条数和被修改的账号（写入后的完整记录）
+// 按主键分批扫描，只对包含失效记录的账号加锁重写
+func CleanupHistoryByServers(validServers map[ServerKey]bool) (removed int, changed []UserPlayerHistory, err error) {
+	const batchSize = 500
+	lastAccountID := ""
+
+	for {
+		var batch []UserPlayerHistory
+		if err := DB.Where("account_id > ?", lastAccountID).
+			Order("account_id ASC").
+			Limit(batchSize).
+			Find(&batch).Error; err != nil {
+			return removed, changed, err
+		}
+		if len(batch) == 0 {
+			return removed, changed, nil
+		}
+		lastAccountID = batch[len(batch)-1].AccountID
+
+		for _, history := range batch {
+			if !hasStaleServer(history.PlayerList, validServers) {
+				continue
+			}
+
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				// 加锁后重新读取，避免覆盖扫描期间的新上报
+				var locked UserPlayerHistory
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("account_id = ?", history.AccountID).
+					First(&locked).Error; err != nil {
+					return err
+				}
+
+				kept := make([]PlayerHistoryItem, 0, len(locked.PlayerList))
+				for _, item := range locked.PlayerList {
+					if validServers[ServerKey{ClusterID: int64(item.ClusterID), GameID: int64(item.GameID)}] {
+						kept = append(kept, item)
+					}
+				}
+				if len(kept) == len(locked.PlayerList) {
+					return nil
+				}
+				count := len(locked.PlayerList) - len(kept)
+				locked.PlayerList = kept
+				if err := saveUserHistoryList(tx, &locked); err != nil {
+					return err
+				}
+				removed += count
+				changed = append(changed, locked)
+				return nil
+			})
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return removed, changed, err
+			}
+		}
+	}
+}
+
+// hasStaleServer 判断列表中是否存在已失效游戏服的记录
+func hasStaleServer(list []PlayerHistoryItem, validServers map[ServerKey]bool) bool {
+	for _, item := range list {
+		if !validServers[ServerKey{ClusterID: int64(item.ClusterID), GameID: int64(item.GameID)}] {
+			return true
+		}
+	}
+	return false
+}
+
+// SetUserState 修改用户账号状态（同时递增版本号），账号不存在时 exists 为 false
+func SetUserState(accountID string, state int) (history UserPlayerHistory, exists bool, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		history = UserPlayerHistory{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("account_id = ?", accountID).
+			First(&history).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		history.State = state
+		history.Version = nextHistoryVersion(history.Version)
+		if err := tx.Model(&history).Select("state", "version").Updates(&history).Error; err != nil {
+			return err
+		}
+		exists = true
+		return nil
+	})
+	return history, exists && err == nil, err
+}
+
+// ========== 角色反查索引 ==========
+
+// PlayerIndex 角色ID -> 账号的反查索引（player_list 是 JSON，无法直接按角色ID查询）
+// 与 user_player_history 在同一事务内维护
+type PlayerIndex struct {
+	ClusterID     int64  `gorm:"column:cluster_id;primaryKey;autoIncrement:false" json:"cluster_id"`
+	GameID        int64  `gorm:"column:game_id;primaryKey;autoIncrement:false" json:"game_id"`
+	PlayerID      int64  `gorm:"column:player_id;primaryKey;autoIncrement:false" json:"player_id"`
+	AccountID     string `gorm:"column:account_id" json:"account_id"`
+	LastLoginTime int64  `gorm:"column:last_login_time" json:"last_login_time"` // 该账号下角色的最后登录时间，用于决定归属
+	UpdatedAt     int64  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// playerIndexKey 角色索引主键
+type playerIndexKey struct {
+	ClusterID int64
+	GameID    int64
+	PlayerID  int64
+}
+
+// playerIndexClaim 同一角色被多个账号的历史记录引用时（转移账号、数据错误等）的归属规则：
+// 最后登录时间更晚的账号拥有该角色，时间相同时账号ID字典序较小的账号拥有；当前归属账号自身的更新总是生效
+// 在 ON DUPLICATE KEY UPDATE 中先按此规则更新 account_id，其余列只在归属为本账号时更新
+const playerIndexClaim = "account_id = VALUES(account_id) OR VALUES(last_login_time) > last_login_time OR " +
+	"(VALUES(last_login_time) = last_login_time AND VALUES(account_id) < account_id)"
+
+// syncPlayerIndex 用账号当前的角色列表同步该账号的索引
+// 与已有索引比较，只删除已不在列表中的角色、写入新增或最后登录时间变化的角色；归属规则见 playerIndexClaim
+func syncPlayerIndex(tx *gorm.DB, accountID string, list []PlayerHistoryItem) error {
+	var existing []PlayerIndex
+	if err := tx.Where("account_id = ?", accountID).Find(&existing).Error; err != nil {
 		return err
 	}
+	owned := make(map[playerIndexKey]PlayerIndex, len(existing))
+	for _, row := range existing {
+		owned[playerIndexKey{row.ClusterID, row.GameID, row.PlayerID}] = row
+	}
 
-	return nil
+	now := time.Now().Unix()
+	upserts := make([]PlayerIndex, 0, len(list))
+	wanted := make(map[playerIndexKey]bool, len(list))
+	for _, item := range list {
+		if item.PlayerID == 0 {
+			continue
+		}
+		key := playerIndexKey{int64(item.ClusterID), int64(item.GameID), item.PlayerID}
+		wanted[key] = true
+		if row, ok := owned[key]; ok && row.LastLoginTime == item.LastLoginTime {
+			continue
+		}
+		upserts = append(upserts, PlayerIndex{
+			ClusterID:     key.ClusterID,
+			GameID:        key.GameID,
+			PlayerID:      key.PlayerID,
+			AccountID:     accountID,
+			LastLoginTime: item.LastLoginTime,
+			UpdatedAt:     now,
+		})
+	}
+
+	for key := range owned {
+		if wanted[key] {
+			continue
+		}
+		if err := tx.Where("cluster_id = ? AND game_id = ? AND player_id = ? AND account_id = ?",
+			key.ClusterID, key.GameID, key.PlayerID, accountID).Delete(&PlayerIndex{}).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(upserts) == 0 {
+		return nil
+	}
+	// 按主键排序写入，多个事务并发时加锁顺序一致
+	sort.Slice(upserts, func(i, j int) bool {
+		a, b := upserts[i], upserts[j]
+		if a.ClusterID != b.ClusterID {
+			return a.ClusterID < b.ClusterID
+		}
+		if a.GameID != b.GameID {
+			return a.GameID < b.GameID
+		}
+		return a.PlayerID < b.PlayerID
+	})
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "account_id"}, Value: gorm.Expr("IF(" + playerIndexClaim + ", VALUES(account_id), account_id)")},
+			{Column: clause.Column{Name: "last_login_time"}, Value: gorm.Expr("IF(account_id = VALUES(account_id), VALUES(last_login_time), last_login_time)")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("IF(account_id = VALUES(account_id), VALUES(updated_at), updated_at)")},
+		},
+	}).Create(&upserts).Error
+}
+
+// PlayerIndexFilter 角色索引查询条件，零值表示不限
+type PlayerIndexFilter struct {
+	ClusterID int64
+	GameID    int64
+	PlayerID  int64
+}
+
+// SearchPlayerIndex 分页查询角色索引（按角色ID 或 按游戏服）
+func SearchPlayerIndex(filter PlayerIndexFilter, page, pageSize int) ([]PlayerIndex, int64, error) {
+	var list []PlayerIndex
+	var total int64
+
+	tx := DB.Model(&PlayerIndex{})
+	if filter.ClusterID != 0 {
+		tx = tx.Where("cluster_id = ?", filter.ClusterID)
+	}
+	if filter.GameID != 0 {
+		tx = tx.Where("game_id = ?", filter.GameID)
+	}
+	if filter.PlayerID != 0 {
+		tx = tx.Where("player_id = ?", filter.PlayerID)
+	}
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := tx.Order("cluster_id ASC, game_id ASC, player_id ASC").Limit(pageSize).Offset(offset).Find(&list).Error
+	return list, total, err
+}
+
+// SearchUserHistoryByPrefix 按账号前缀分页查询玩家历史（走主键索引的范围扫描）
+func SearchUserHistoryByPrefix(prefix string, page, pageSize int) ([]UserPlayerHistory, int64, error) {
+	var list []UserPlayerHistory
+	var total int64
+
+	// 转义 LIKE 通配符，保证只做前缀匹配
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+	tx := DB.Model(&UserPlayerHistory{}).Where("account_id LIKE ?", escaped+"%")
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := tx.Order("account_id ASC").Limit(pageSize).Offset(offset).Find(&list).Error
+	return list, total, err
+}
+
+// RebuildPlayerIndex 按 user_player_history 全量重建角色索引（上线索引前的历史数据、或数据修复时使用）
+// 按主键分批扫描，每个账号在独立事务中加锁重建，不阻塞正常上报
+func RebuildPlayerIndex() (accounts int, err error) {
+	const batchSize = 500
+	lastAccountID := ""
+
+	for {
+		var batch []string
+		if err := DB.Model(&UserPlayerHistory{}).
+			Where("account_id > ?", lastAccountID).
+			Order("account_id ASC").
+			Limit(batchSize).
+			Pluck("account_id", &batch).Error; err != nil {
+			return accounts, err
+		}
+		if len(batch) == 0 {
+			return accounts, nil
+		}
+		lastAccountID = batch[len(batch)-1]
+
+		for _, accountID := range batch {
+			err := withDeadlockRetry(func() error {
+				return DB.Transaction(func(tx *gorm.DB) error {
+					var history UserPlayerHistory
+					if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+						Where("account_id = ?", accountID).
+						First(&history).Error; err != nil {
+						return err
+					}
+					return syncPlayerIndex(tx, accountID, history.PlayerList)
+				})
+			})
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			} else if err != nil {
+				return accounts, err
+			}
+			accounts++
+		}
+	}
 }
 
 // LoginNotice 登录服公告结构
@@ -230,6 +810,7 @@ type LoginNotice struct {
 	Content    string `gorm:"column:content" json:"content"`
 	BannerURL  string `gorm:"column:banner_url" json:"banner_url"`
 	Priority   int    `gorm:"column:priority" json:"priority"`
+	Sort       int    `gorm:"column:sort" json:"sort"` // 下发顺序（客户端 Tab 顺序）：数值越大越靠前
 	IsEnable   int    `gorm:"column:is_enable" json:"is_enable"`
 	StartTime  int64  `gorm:"column:start_time" json:"start_time"`
 	EndTime    int64  `gorm:"column:end_time" json:"end_time"`
@@ -237,10 +818,73 @@ type LoginNotice struct {
 	CreatedAt  int64  `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt  int64  `gorm:"column:updated_at" json:"updated_at"`
 	Info       string `gorm:"column:info" json:"info"`
+
+	// 定向投放条件：均为空表示对所有客户端生效，多个条件之间为"且"关系
+	Platforms  string `gorm:"column:platforms" json:"platforms"`     // 平台，逗号分隔：ios,android,pc
+	Channels   string `gorm:"column:channels" json:"channels"`       // 渠道，逗号分隔
+	MinVersion string `gorm:"column:min_version" json:"min_version"` // 客户端最低版本（含），如 1.2.0
+	MaxVersion string `gorm:"column:max_version" json:"max_version"` // 客户端最高版本（含）
+	ClusterIDs string `gorm:"column:cluster_ids" json:"cluster_ids"` // 集群ID，逗号分隔
+	Languages  string `gorm:"column:languages" json:"languages"`     // 语言，逗号分隔：zh,en,ja（zh 可匹配 zh-CN）
+	Accounts   string `gorm:"column:accounts" json:"accounts"`       // 账号白名单，逗号分隔
+
+	// 正文格式：html / markdown / text，下发时转换为客户端的富文本格式
+	ContentFormat string `gorm:"column:content_format" json:"content_format"`
+
+	// 审核流程：只有已发布的公告才会下发给客户端
+	Status    int    `gorm:"column:status" json:"status"`       // 0草稿 1待审核 2已审核 3已发布 4已归档
+	Submitter string `gorm:"column:submitter" json:"submitter"` // 提交审核人
+	Approver  string `gorm:"column:approver" json:"approver"`   // 审核人（不能与提交人、最后修改人相同）
+
+	// 乐观锁：每次修改（包括状态变化）递增，修改时必须携带读取到的版本号
+	Version int `gorm:"column:version" json:"version"`
+}
+
+// ErrNoticeConflict 公告已被其他人修改（版本号不一致）
+var ErrNoticeConflict = errors.New("公告已被其他人修改，请刷新后重试")
+
+// noticeEditColumns 修改公告内容时写入的字段（不包括 id、created_at）
+var noticeEditColumns = []string{
+	"notice_type", "title", "content", "banner_url", "priority", "sort", "is_enable", "start_time", "end_time",
+	"operator", "info", "platforms", "channels", "min_version", "max_version", "cluster_ids", "languages",
+	"accounts", "content_format", "status", "submitter", "approver", "version", "updated_at",
+}
+
+// 公告状态
+const (
+	NoticeStatusDraft     = 0 // 草稿
+	NoticeStatusPending   = 1 // 待审核
+	NoticeStatusApproved  = 2 // 已审核，待发布
+	NoticeStatusPublished = 3 // 已发布
+	NoticeStatusArchived  = 4 // 已归档
+)
+
+// 公告操作（同时作为修订记录的 action）
+const (
+	NoticeActionCreate   = "create"
+	NoticeActionUpdate   = "update"
+	NoticeActionSubmit   = "submit"   // 草稿 -> 待审核
+	NoticeActionApprove  = "approve"  // 待审核 -> 已审核
+	NoticeActionReject   = "reject"   // 待审核 -> 草稿
+	NoticeActionPublish  = "publish"  // 已审核 -> 已发布
+	NoticeActionWithdraw = "withdraw" // 待审核/已审核/已发布 -> 草稿
+	NoticeActionArchive  = "archive"  // 任意 -> 已归档
+	NoticeActionRestore  = "restore"  // 恢复到指定修订版本（成为草稿）
+	NoticeActionDelete   = "delete"   // 已归档 -> 删除（修订记录保留）
+)
+
+// noticeTransitions 状态流转：操作 -> 允许的原状态
+var noticeTransitions = map[string][]int{
+	NoticeActionSubmit:   {NoticeStatusDraft},
+	NoticeActionApprove:  {NoticeStatusPending},
+	NoticeActionReject:   {NoticeStatusPending},
+	NoticeActionPublish:  {NoticeStatusApproved},
+	NoticeActionWithdraw: {NoticeStatusPending, NoticeStatusApproved, NoticeStatusPublished},
+	NoticeActionArchive:  {NoticeStatusDraft, NoticeStatusPending, NoticeStatusApproved, NoticeStatusPublished},
 }
 
 // LoadNotice 从数据库加载数据到缓存
-// 只获取 [已开启] 且 [未过期] 的数据
+// 只获取 [已发布]、[已开启] 且 [未过期] 的数据
 func LoadNotice() ([]LoginNotice, error) {
 	var list []LoginNotice
 
@@ -248,41 +892,236 @@ func LoadNotice() ([]LoginNotice, error) {
 	now := time.Now().Unix()
 
 	// SQL 逻辑：
-	// 1. is_enable = 1 (必须是开启的)
-	// 2. end_time > now (结束时间必须在未来，意味着还没过期)
+	// 1. status = 3 (必须是已发布的)
+	// 2. is_enable = 1 (必须是开启的)
+	// 3. end_time > now (结束时间必须在未来，意味着还没过期)
 	// 注意：这里不判断 start_time，因为我们允许把“明天开始”的公告也缓存在内存里，
 	//      等到了明天时间一到，GetValidNoticesFromCache 就能自动把它刷出来，而不需要重新查库。
-	err := DB.Where("is_enable = ? AND end_time > ?", 1, now).
+	err := DB.Where("status = ? AND is_enable = ? AND end_time > ?", NoticeStatusPublished, 1, now).
 		Order("priority DESC, id DESC"). // 按优先级排序，方便后续处理
 		Find(&list).Error
 
-	if err != nil {
-		return nil, err
-	}
+	if err != nil {
+		return nil, err
+	}
+
+	return list, err
+}
+
+// CreateLoginNotice 创建（草稿），同时记录第一个修订版本，返回创建后的公告
+// 创建/更新时间和版本号由服务端设置
+func CreateLoginNotice(notice LoginNotice) (LoginNotice, error) {
+	now := time.Now().Unix()
+	notice.ID = 0
+	notice.Status = NoticeStatusDraft
+	notice.Submitter = ""
+	notice.Approver = ""
+	notice.Version = 1
+	notice.CreatedAt = now
+	notice.UpdatedAt = now
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&notice).Error; err != nil {
+			return err
+		}
+		return addNoticeRevision(tx, notice, NoticeActionCreate, notice.Operator, "")
+	})
+	return notice, err
+}
+
+// ErrNoticeNotArchived 删除未归档的公告
+var ErrNoticeNotArchived = errors.New("只能删除已归档的公告，请先归档")
+
+// DeleteLoginNotice 删除已归档的公告
+func DeleteLoginNotice(id uint64, operator string) error {
+	return BatchDeleteLoginNotice([]uint64{id}, operator)
+}
+
+// BatchDeleteLoginNotice 批量删除已归档的公告（连同多语言翻译），不存在的公告忽略
+// 有未归档的公告时全部不删除，返回 ErrNoticeNotArchived；
+// 删除前追加一条 delete 修订记录（含删除前的内容和翻译），修订记录保留，删除后仍可查询
+func BatchDeleteLoginNotice(ids []uint64, operator string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var list []LoginNotice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Find(&list).Error; err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return nil
+		}
+
+		found := make([]uint64, 0, len(list))
+		for _, notice := range list {
+			if notice.Status != NoticeStatusArchived {
+				return fmt.Errorf("%w: id %d", ErrNoticeNotArchived, notice.ID)
+			}
+			found = append(found, notice.ID)
+		}
+		for _, notice := range list {
+			if err := addNoticeRevision(tx, notice, NoticeActionDelete, operator, ""); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("notice_id IN ?", found).Delete(&LoginNoticeI18n{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&LoginNotice{}, found).Error
+	})
+}
+
+// UpdateLoginNotice 更新，返回更新后的公告
+// version 为客户端读取到的版本号，与当前版本不一致时返回 ErrNoticeConflict；
+// apply 在行锁内修改当前公告（只修改请求中携带的字段），返回错误时放弃修改。
+// 已发布/已归档的公告不能直接修改（需先撤回）；待审核/已审核的公告修改后退回草稿，需要重新审核
+func UpdateLoginNotice(id uint64, version int, apply func(notice *LoginNotice) error) (LoginNotice, error) {
+	var notice LoginNotice
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&notice, id).Error; err != nil {
+			return err
+		}
+		if notice.Version != version {
+			return ErrNoticeConflict
+		}
+		if err := checkNoticeEditable(notice); err != nil {
+			return err
+		}
+		if err := apply(&notice); err != nil {
+			return err
+		}
+
+		// 状态只能通过审核流程修改；id、创建时间不允许修改
+		notice.ID = id
+		notice.Status = NoticeStatusDraft
+		notice.Submitter = ""
+		notice.Approver = ""
+		notice.Version = version + 1
+		notice.UpdatedAt = time.Now().Unix()
+		if err := tx.Model(&LoginNotice{}).Where("id = ?", id).Select(noticeEditColumns).Updates(&notice).Error; err != nil {
+			return err
+		}
+		return addNoticeRevision(tx, notice, NoticeActionUpdate, notice.Operator, "")
+	})
+	return notice, err
+}
+
+// TransitionLoginNotice 执行审核流程操作，返回操作后的公告
+// version 为客户端读取到的版本号，与当前版本不一致时返回 ErrNoticeConflict（避免审核/发布别人刚修改过、自己没看到的内容）
+func TransitionLoginNotice(id uint64, version int, action, operator, comment string) (LoginNotice, error) {
+	var notice LoginNotice
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&notice, id).Error; err != nil {
+			return err
+		}
+		if notice.Version != version {
+			return ErrNoticeConflict
+		}
+		from, ok := noticeTransitions[action]
+		if !ok {
+			return fmt.Errorf("未知的操作: %s", action)
+		}
+		if !slices.Contains(from, notice.Status) {
+			return fmt.Errorf("公告当前状态(%d)不允许执行 %s", notice.Status, action)
+		}
+
+		switch action {
+		case NoticeActionSubmit:
+			notice.Status = NoticeStatusPending
+			notice.Submitter = operator
+		case NoticeActionApprove:
+			// 审核必须由第二个人完成
+			if operator == notice.Submitter || operator == notice.Operator {
+				return fmt.Errorf("审核人不能是提交人或最后修改人: %s", operator)
+			}
+			notice.Status = NoticeStatusApproved
+			notice.Approver = operator
+		case NoticeActionReject:
+			notice.Status = NoticeStatusDraft
+			notice.Submitter = ""
+		case NoticeActionPublish:
+			notice.Status = NoticeStatusPublished
+			notice.IsEnable = 1
+		case NoticeActionWithdraw:
+			notice.Status = NoticeStatusDraft
+			notice.Submitter = ""
+			notice.Approver = ""
+		case NoticeActionArchive:
+			notice.Status = NoticeStatusArchived
+			notice.IsEnable = 0
+		}
 
-	return list, err
+		notice.Version++
+		notice.UpdatedAt = time.Now().Unix()
+		if err := tx.Model(&LoginNotice{}).Where("id = ?", id).Updates(map[string]any{
+			"status":     notice.Status,
+			"submitter":  notice.Submitter,
+			"approver":   notice.Approver,
+			"is_enable":  notice.IsEnable,
+			"version":    notice.Version,
+			"updated_at": notice.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return addNoticeRevision(tx, notice, action, operator, comment)
+	})
+	return notice, err
 }
 
-// CreateLoginNotice 创建
-func CreateLoginNotice(notice LoginNotice) error {
-	return DB.Create(&notice).Error
-}
+// RestoreLoginNotice 将公告内容恢复到指定修订版本，恢复后为草稿，需要重新审核
+// version 为客户端读取到的版本号，与当前版本不一致时返回 ErrNoticeConflict
+func RestoreLoginNotice(id uint64, version, revision int, operator string) (LoginNotice, error) {
+	var notice LoginNotice
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var current LoginNotice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, id).Error; err != nil {
+			return err
+		}
+		if current.Version != version {
+			return ErrNoticeConflict
+		}
+		if current.Status == NoticeStatusPublished {
+			return errors.New("已发布的公告不能直接修改，请先撤回")
+		}
 
-// DeleteLoginNotice 删除
-func DeleteLoginNotice(id uint64) error {
-	return DB.Delete(&LoginNotice{}, id).Error
-}
+		var rev LoginNoticeRevision
+		if err := tx.Where("notice_id = ? AND revision = ?", id, revision).First(&rev).Error; err != nil {
+			return err
+		}
+		snapshot, err := ParseNoticeSnapshot(rev.Snapshot)
+		if err != nil {
+			return fmt.Errorf("修订版本 %d 内容损坏: %v", revision, err)
+		}
+		notice = snapshot.LoginNotice
 
-// BatchDeleteLoginNotice 批量删除
-func BatchDeleteLoginNotice(ids []uint64) error {
-	return DB.Delete(&LoginNotice{}, ids).Error
+		notice.ID = current.ID
+		notice.CreatedAt = current.CreatedAt
+		notice.Status = NoticeStatusDraft
+		notice.Submitter = ""
+		notice.Approver = ""
+		notice.Operator = operator
+		notice.Version = current.Version + 1
+		notice.UpdatedAt = time.Now().Unix()
+		if err := tx.Model(&LoginNotice{}).Where("id = ?", id).Select(noticeEditColumns).Updates(&notice).Error; err != nil {
+			return err
+		}
+		// 旧版本的快照没有保存翻译，恢复时保留当前翻译
+		if snapshot.Translations != nil {
+			if err := replaceNoticeI18n(tx, id, snapshot.Translations); err != nil {
+				return err
+			}
+		}
+		return addNoticeRevision(tx, notice, NoticeActionRestore, operator, strconv.Itoa(revision))
+	})
+	return notice, err
 }
 
-// UpdateLoginNotice 更新
-func UpdateLoginNotice(notice LoginNotice) error {
-	// 使用 Updates 更新非零值，或者使用 map 更新指定字段
-	// 这里GVA 传过来的是完整对象，直接 Save 即可
-	return DB.Save(&notice).Error
+// checkNoticeEditable 检查公告内容是否允许修改
+func checkNoticeEditable(notice LoginNotice) error {
+	switch notice.Status {
+	case NoticeStatusPublished:
+		return errors.New("已发布的公告不能直接修改，请先撤回")
+	case NoticeStatusArchived:
+		return errors.New("已归档的公告不能修改，请恢复为草稿后再修改")
+	}
+	return nil
 }
 
 // FindLoginNotice 单条查询
@@ -296,7 +1135,7 @@ func FindLoginNotice(id uint64) (LoginNotice, error) {
 }
 
 // GetLoginNoticeList 分页查询 (带搜索)
-func GetLoginNoticeList(page, pageSize int, title string, noticeType int, isEnable *int) ([]LoginNotice, int64, error) {
+func GetLoginNoticeList(page, pageSize int, title string, noticeType int, isEnable, status *int) ([]LoginNotice, int64, error) {
 	var list []LoginNotice
 	var total int64
 
@@ -312,6 +1151,9 @@ func GetLoginNoticeList(page, pageSize int, title string, noticeType int, isEnab
 	if isEnable != nil {
 		tx = tx.Where("is_enable = ?", *isEnable)
 	}
+	if status != nil {
+		tx = tx.Where("status = ?", *status)
+	}
 
 	err := tx.Count(&total).Error
 	if err != nil {
@@ -324,6 +1166,229 @@ func GetLoginNoticeList(page, pageSize int, title string, noticeType int, isEnab
 	return list, total, err
 }
 
+// ========== 公告修订记录 ==========
+
+// LoginNoticeRevision 公告修订记录：每次修改和状态变化都保存一份完整快照
+type LoginNoticeRevision struct {
+	ID        uint64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	NoticeID  uint64 `gorm:"column:notice_id" json:"notice_id"`
+	Revision  int    `gorm:"column:revision" json:"revision"` // 公告内的修订序号，从 1 开始
+	Action    string `gorm:"column:action" json:"action"`
+	Status    int    `gorm:"column:status" json:"status"` // 操作后的状态
+	Operator  string `gorm:"column:operator" json:"operator"`
+	Comment   string `gorm:"column:comment" json:"comment"`   // 审核意见/恢复的版本号/修改的翻译
+	Snapshot  string `gorm:"column:snapshot" json:"snapshot"` // 公告完整内容(JSON，见 NoticeSnapshot)
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// NoticeSnapshot 修订快照：公告本身及当时的全部翻译
+type NoticeSnapshot struct {
+	LoginNotice
+	Translations []LoginNoticeI18n `json:"translations"` // 旧版本的快照没有该字段（nil）
+}
+
+// ParseNoticeSnapshot 解析修订快照
+func ParseNoticeSnapshot(data string) (NoticeSnapshot, error) {
+	var snapshot NoticeSnapshot
+	err := json.Unmarshal([]byte(data), &snapshot)
+	return snapshot, err
+}
+
+// addNoticeRevision 追加一条修订记录（调用方需持有公告行锁，保证序号连续）
+func addNoticeRevision(tx *gorm.DB, notice LoginNotice, action, operator, comment string) error {
+	translations := make([]LoginNoticeI18n, 0)
+	if err := tx.Where("notice_id = ?", notice.ID).Order("locale ASC").Find(&translations).Error; err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(NoticeSnapshot{LoginNotice: notice, Translations: translations})
+	if err != nil {
+		return err
+	}
+
+	var last int
+	if err := tx.Model(&LoginNoticeRevision{}).
+		Where("notice_id = ?", notice.ID).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&last).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&LoginNoticeRevision{
+		NoticeID: notice.ID,
+		Revision: last + 1,
+		Action:   action,
+		Status:   notice.Status,
+		Operator: operator,
+		Comment:  comment,
+		Snapshot: string(snapshot),
+	}).Error
+}
+
+// GetNoticeRevisions 获取公告的全部修订记录（新的在前）
+func GetNoticeRevisions(noticeID uint64) ([]LoginNoticeRevision, error) {
+	var list []LoginNoticeRevision
+	err := DB.Where("notice_id = ?", noticeID).Order("revision DESC").Find(&list).Error
+	return list, err
+}
+
+// FindNoticeRevision 查询公告的指定修订版本
+func FindNoticeRevision(noticeID uint64, revision int) (LoginNoticeRevision, error) {
+	var rev LoginNoticeRevision
+	err := DB.Where("notice_id = ? AND revision = ?", noticeID, revision).First(&rev).Error
+	return rev, err
+}
+
+// ========== 公告统计 ==========
+
+// NoticeStat 公告每日统计（按服务端收到事件的日期）
+type NoticeStat struct {
+	NoticeID    uint64 `gorm:"column:notice_id;primaryKey;autoIncrement:false" json:"notice_id"`
+	StatDate    int    `gorm:"column:stat_date;primaryKey;autoIncrement:false" json:"stat_date"` // 日期，如 20260101
+	Impressions int64  `gorm:"column:impressions" json:"impressions"`                            // 展示次数
+	Dismisses   int64  `gorm:"column:dismisses" json:"dismisses"`                                // 关闭次数
+	Clicks      int64  `gorm:"column:clicks" json:"clicks"`                                      // Banner 点击次数
+	UpdatedAt   int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// AddNoticeStats 累加公告统计（按主键合并）
+func AddNoticeStats(list []NoticeStat) error {
+	if len(list) == 0 {
+		return nil
+	}
+	return DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]any{
+			"impressions": gorm.Expr("impressions + VALUES(impressions)"),
+			"dismisses":   gorm.Expr("dismisses + VALUES(dismisses)"),
+			"clicks":      gorm.Expr("clicks + VALUES(clicks)"),
+			"updated_at":  gorm.Expr("VALUES(updated_at)"),
+		}),
+	}).Create(&list).Error
+}
+
+// GetNoticeStats 获取单个公告在日期范围内的每日统计
+func GetNoticeStats(noticeID uint64, startDate, endDate int) ([]NoticeStat, error) {
+	var list []NoticeStat
+	err := DB.Where("notice_id = ? AND stat_date BETWEEN ? AND ?", noticeID, startDate, endDate).
+		Order("stat_date ASC").
+		Find(&list).Error
+	return list, err
+}
+
+// GetNoticeStatSummary 获取日期范围内每个公告的合计（StatDate 为 0）
+func GetNoticeStatSummary(startDate, endDate int) ([]NoticeStat, error) {
+	var list []NoticeStat
+	err := DB.Model(&NoticeStat{}).
+		Select("notice_id, SUM(impressions) AS impressions, SUM(dismisses) AS dismisses, SUM(clicks) AS clicks, MAX(updated_at) AS updated_at").
+		Where("stat_date BETWEEN ? AND ?", startDate, endDate).
+		Group("notice_id").
+		Order("impressions DESC").
+		Scan(&list).Error
+	return list, err
+}
+
+// ========== 公告多语言 ==========
+
+// LoginNoticeI18n 公告的单个语言翻译（默认语言的内容保存在 login_notice 本身）
+type LoginNoticeI18n struct {
+	NoticeID  uint64 `gorm:"column:notice_id;primaryKey;autoIncrement:false" json:"notice_id"`
+	Locale    string `gorm:"column:locale;primaryKey" json:"locale"` // 语言，如 en、ja、zh-tw
+	Title     string `gorm:"column:title" json:"title"`
+	Content   string `gorm:"column:content" json:"content"`
+	BannerURL string `gorm:"column:banner_url" json:"banner_url"` // 为空时沿用默认语言的 Banner
+	Operator  string `gorm:"column:operator" json:"operator"`
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// LoadNoticeI18n 加载指定公告的全部翻译
+func LoadNoticeI18n(noticeIDs []uint64) ([]LoginNoticeI18n, error) {
+	var list []LoginNoticeI18n
+	if len(noticeIDs) == 0 {
+		return list, nil
+	}
+	err := DB.Where("notice_id IN ?", noticeIDs).Order("notice_id ASC, locale ASC").Find(&list).Error
+	return list, err
+}
+
+// ErrNoticeI18nNotFound 要删除的翻译不存在
+var ErrNoticeI18nNotFound = errors.New("翻译不存在")
+
+// SetNoticeI18n 新增或覆盖一条翻译，返回修改后的公告
+// 翻译属于公告内容，与 UpdateLoginNotice 相同：version 不一致时返回 ErrNoticeConflict，
+// 已发布/已归档的公告不能修改，修改后公告退回草稿并记录修订
+func SetNoticeI18n(item LoginNoticeI18n, version int) (LoginNotice, error) {
+	return updateNoticeI18n(item.NoticeID, version, item.Operator, "翻译 "+item.Locale, func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"title", "content", "banner_url", "operator", "updated_at"}),
+		}).Create(&item).Error
+	})
+}
+
+// DeleteNoticeI18n 删除一条翻译，返回修改后的公告（规则同 SetNoticeI18n）
+func DeleteNoticeI18n(noticeID uint64, locale string, version int, operator string) (LoginNotice, error) {
+	return updateNoticeI18n(noticeID, version, operator, "删除翻译 "+locale, func(tx *gorm.DB) error {
+		result := tx.Where("notice_id = ? AND locale = ?", noticeID, locale).Delete(&LoginNoticeI18n{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return ErrNoticeI18nNotFound
+		}
+		return result.Error
+	})
+}
+
+// updateNoticeI18n 在公告行锁内修改翻译，公告按内容修改处理：校验版本号，退回草稿，记录修订
+func updateNoticeI18n(id uint64, version int, operator, comment string, apply func(tx *gorm.DB) error) (LoginNotice, error) {
+	var notice LoginNotice
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&notice, id).Error; err != nil {
+			return err
+		}
+		if notice.Version != version {
+			return ErrNoticeConflict
+		}
+		if err := checkNoticeEditable(notice); err != nil {
+			return err
+		}
+		if err := apply(tx); err != nil {
+			return err
+		}
+
+		notice.Status = NoticeStatusDraft
+		notice.Submitter = ""
+		notice.Approver = ""
+		notice.Operator = operator
+		notice.Version = version + 1
+		notice.UpdatedAt = time.Now().Unix()
+		if err := tx.Model(&LoginNotice{}).Where("id = ?", id).Updates(map[string]any{
+			"status":     notice.Status,
+			"submitter":  notice.Submitter,
+			"approver":   notice.Approver,
+			"operator":   notice.Operator,
+			"version":    notice.Version,
+			"updated_at": notice.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return addNoticeRevision(tx, notice, NoticeActionUpdate, operator, comment)
+	})
+	return notice, err
+}
+
+// replaceNoticeI18n 将公告的翻译替换为 items（恢复修订版本时使用）
+func replaceNoticeI18n(tx *gorm.DB, noticeID uint64, items []LoginNoticeI18n) error {
+	if err := tx.Where("notice_id = ?", noticeID).Delete(&LoginNoticeI18n{}).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	for i := range items {
+		items[i].NoticeID = noticeID
+		items[i].UpdatedAt = now
+	}
+	return tx.Create(&items).Error
+}
+
 // ========== IP白名单 ==========
 
 // IPWhitelist IP白名单结构
@@ -333,7 +1398,35 @@ type IPWhitelist struct {
 	IP        string `gorm:"column:ip;not null" json:"ip"`                                   // IP地址或CIDR
 	CreatedAt int64  `gorm:"column:created_at" json:"created_at"`                            // 创建时间
 	UpdatedAt int64  `gorm:"column:updated_at" json:"updated_at"`                            // 更新时间
-	Info      string `gorm:"column:info" json:"info"`                                        // 额外信息
+	Note      string `gorm:"column:info" json:"note"`                                        // 备注（如开放给哪个供应商、用途）
+
+	ExpireAt int64  `gorm:"column:expire_at" json:"expire_at"` // 过期时间，0 表示永不过期；过期后不再生效，由定时任务删除
+	Operator string `gorm:"column:operator" json:"operator"`   // 添加人
+}
+
+// IsGroupMarker 是否为分组占位记录（IP 为空）
+// 分组的条目全部被删除后保留一条占位记录，表示分组仍然存在、列表为空（禁止所有访问），
+// 而不是分组不存在（不限制访问）；占位记录不是白名单条目
+func (w IPWhitelist) IsGroupMarker() bool {
+	return w.IP == ""
+}
+
+// keepWhitelistGroup 分组已没有任何记录时写入占位记录，保证分组仍然存在
+func keepWhitelistGroup(tx *gorm.DB, apiGroup, operator string, now int64) error {
+	var count int64
+	if err := tx.Model(&IPWhitelist{}).Where("api_group = ?", apiGroup).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Create(&IPWhitelist{
+		APIGroup:  apiGroup,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Note:      "分组占位（条目已全部删除，分组仍禁止所有访问）",
+		Operator:  operator,
+	}).Error
 }
 
 // LoadWhitelist 从数据库加载指定分组的白名单
@@ -351,8 +1444,8 @@ func LoadAllWhitelists() ([]IPWhitelist, error) {
 }
 
 // SetWhitelist 设置指定分组的IP白名单（完全替换）
-// 先删除该分组的所有IP，然后插入新的IP列表
-func SetWhitelist(apiGroup string, ips []string) error {
+// 先删除该分组的所有IP，然后插入新的IP列表（均为永久有效）
+func SetWhitelist(apiGroup string, ips []string, operator string) error {
 	now := time.Now().Unix()
 	return DB.Transaction(func(tx *gorm.DB) error {
 		// 1. 删除该分组的所有现有IP
@@ -360,9 +1453,9 @@ func SetWhitelist(apiGroup string, ips []string) error {
 			return err
 		}
 
-		// 2. 如果IP列表为空，直接返回（表示清空白名单）
+		// 2. 如果IP列表为空，写入占位记录（表示清空白名单，禁止所有访问）
 		if len(ips) == 0 {
-			return nil
+			return keepWhitelistGroup(tx, apiGroup, operator, now)
 		}
 
 		// 3. 批量插入新的IP列表
@@ -373,6 +1466,7 @@ func SetWhitelist(apiGroup string, ips []string) error {
 				IP:        ip,
 				CreatedAt: now,
 				UpdatedAt: now,
+				Operator:  operator,
 			})
 		}
 
@@ -384,36 +1478,447 @@ func SetWhitelist(apiGroup string, ips []string) error {
 	})
 }
 
-// AddWhitelistIP 向指定分组添加IP（如果已存在则忽略）
-func AddWhitelistIP(apiGroup string, ip string) error {
+// AddWhitelistIP 向指定分组添加IP
+// 已存在时更新过期时间、备注和添加人（可用于续期或改为永久有效）
+func AddWhitelistIP(entry IPWhitelist) error {
 	now := time.Now().Unix()
 
 	// 检查是否已存在
 	var existing IPWhitelist
-	err := DB.Where("api_group = ? AND ip = ?", apiGroup, ip).First(&existing).Error
+	err := DB.Where("api_group = ? AND ip = ?", entry.APIGroup, entry.IP).First(&existing).Error
 	if err == nil {
-		// 已存在，只更新更新时间
 		existing.UpdatedAt = now
+		existing.ExpireAt = entry.ExpireAt
+		existing.Note = entry.Note
+		existing.Operator = entry.Operator
 		return DB.Save(&existing).Error
 	} else if errors.Is(err, gorm.ErrRecordNotFound) {
 		// 不存在，创建新记录
-		whitelist := IPWhitelist{
-			APIGroup:  apiGroup,
-			IP:        ip,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		return DB.Create(&whitelist).Error
+		entry.ID = 0
+		entry.CreatedAt = now
+		entry.UpdatedAt = now
+		return DB.Create(&entry).Error
 	}
 	return err
 }
 
-// RemoveWhitelistIP 从指定分组删除IP
+// RemoveWhitelistIP 从指定分组删除IP，删除最后一个IP后保留占位记录（分组变为空列表，而不是不存在）
 func RemoveWhitelistIP(apiGroup string, ip string) error {
-	return DB.Where("api_group = ? AND ip = ?", apiGroup, ip).Delete(&IPWhitelist{}).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("api_group = ? AND ip = ?", apiGroup, ip).Delete(&IPWhitelist{}).Error; err != nil {
+			return err
+		}
+		return keepWhitelistGroup(tx, apiGroup, "system", time.Now().Unix())
+	})
 }
 
 // RemoveWhitelistGroup 删除整个分组的所有IP
 func RemoveWhitelistGroup(apiGroup string) error {
 	return DB.Where("api_group = ?", apiGroup).Delete(&IPWhitelist{}).Error
 }
+
+// PurgeExpiredWhitelist 删除已过期的白名单记录，返回删除的记录（用于记录日志）
+// 分组的条目全部过期时保留占位记录：过期只会收紧访问，不会让分组变为不限制访问
+func PurgeExpiredWhitelist(now int64) ([]IPWhitelist, error) {
+	var expired []IPWhitelist
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expire_at > 0 AND expire_at <= ?", now).Find(&expired).Error; err != nil {
+			return err
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+		ids := make([]uint64, 0, len(expired))
+		groups := make([]string, 0)
+		for _, item := range expired {
+			ids = append(ids, item.ID)
+			if !slices.Contains(groups, item.APIGroup) {
+				groups = append(groups, item.APIGroup)
+			}
+		}
+		if err := tx.Delete(&IPWhitelist{}, ids).Error; err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if err := keepWhitelistGroup(tx, group, "system", now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return expired, err
+}
+
+// ========== IP黑名单 ==========
+
+// IPDenylist 手动添加的IP黑名单（自动封禁不落库，保存在 Redis 中）
+type IPDenylist struct {
+	ID        uint64 `gorm:"primaryKey;column:id" json:"id"`
+	IP        string `gorm:"column:ip;not null;uniqueIndex:uk_ip" json:"ip"` // IP地址或CIDR
+	Reason    string `gorm:"column:reason" json:"reason"`                    // 封禁原因
+	ExpireAt  int64  `gorm:"column:expire_at" json:"expire_at"`              // 过期时间，0 表示永不过期
+	Operator  string `gorm:"column:operator" json:"operator"`                // 添加人
+	CreatedAt int64  `gorm:"column:created_at" json:"created_at"`            // 创建时间
+	UpdatedAt int64  `gorm:"column:updated_at" json:"updated_at"`            // 更新时间
+}
+
+// LoadDenylist 从数据库加载全部黑名单
+func LoadDenylist() ([]IPDenylist, error) {
+	var list []IPDenylist
+	err := DB.Order("id ASC").Find(&list).Error
+	return list, err
+}
+
+// AddDenylistIP 添加黑名单，已存在时更新原因、过期时间和添加人
+func AddDenylistIP(entry IPDenylist) error {
+	now := time.Now().Unix()
+	entry.ID = 0
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "expire_at", "operator", "updated_at"}),
+	}).Create(&entry).Error
+}
+
+// RemoveDenylistIP 删除黑名单，返回是否存在该记录
+func RemoveDenylistIP(ip string) (bool, error) {
+	result := DB.Where("ip = ?", ip).Delete(&IPDenylist{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeExpiredDenylist 删除已过期的黑名单记录，返回删除的记录数
+func PurgeExpiredDenylist(now int64) (int64, error) {
+	result := DB.Where("expire_at > 0 AND expire_at <= ?", now).Delete(&IPDenylist{})
+	return result.RowsAffected, result.Error
+}
+
+// ========== 服务器显示分组 ==========
+
+// ServerGroup 服务器显示分组（客户端按分组分页展示，如按地区或按区服范围 1-100、101-200）
+type ServerGroup struct {
+	ID        uint64 `gorm:"primaryKey;column:id" json:"id"`
+	Name      string `gorm:"column:name" json:"name"`                 // 分组名称（页签文字）
+	Sort      int    `gorm:"column:sort" json:"sort"`                 // 排序权重：数值越大越靠前
+	IsShow    *int8  `gorm:"column:is_show;default:1" json:"is_show"` // 0否 1是，不传时为 1
+	ClusterID int64  `gorm:"column:cluster_id" json:"cluster_id"`     // 自动归组的集群限制：0 表示不限集群
+	MinGameID int64  `gorm:"column:min_game_id" json:"min_game_id"`   // 自动归组的区服范围下限（含）
+	MaxGameID int64  `gorm:"column:max_game_id" json:"max_game_id"`   // 自动归组的区服范围上限（含），0 表示不按范围归组
+	Desc      string `gorm:"column:desc" json:"desc"`
+	CreatedAt int64  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt int64  `gorm:"column:updated_at" json:"updated_at"`
+	Info      string `gorm:"column:info" json:"info"`
+}
+
+// Visible 分组是否展示给客户端
+func (g ServerGroup) Visible() bool {
+	return g.IsShow == nil || *g.IsShow != 0
+}
+
+// LoadServerGroups 加载所有服务器分组
+func LoadServerGroups() ([]ServerGroup, error) {
+	var list []ServerGroup
+	err := DB.Order("sort DESC, id ASC").Find(&list).Error
+	return list, err
+}
+
+// CreateServerGroup 创建分组
+func CreateServerGroup(group ServerGroup) error {
+	now := time.Now().Unix()
+	group.CreatedAt = now
+	group.UpdatedAt = now
+	return DB.Create(&group).Error
+}
+
+// UpdateServerGroup 更新分组（未传 is_show 时保持原值）
+func UpdateServerGroup(group ServerGroup) error {
+	var existing ServerGroup
+	if err := DB.First(&existing, group.ID).Error; err != nil {
+		return err
+	}
+	if group.IsShow == nil {
+		group.IsShow = existing.IsShow
+	}
+	group.CreatedAt = existing.CreatedAt
+	group.UpdatedAt = time.Now().Unix()
+	return DB.Save(&group).Error
+}
+
+// DeleteServerGroup 删除分组，引用该分组的服务器恢复为自动归组
+func DeleteServerGroup(id uint64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&GameList{}).Where("group_id = ?", id).Update("group_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&ServerGroup{}, id).Error
+	})
+}
+
+// ========== 账号审计与数据删除 ==========
+
+// AccountAudit 账号操作审计记录
+type AccountAudit struct {
+	ID        uint64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	AccountID string `gorm:"column:account_id" json:"account_id"`
+	Action    string `gorm:"column:action" json:"action"`     // 操作类型：set_state / remove_role / export / erasure_request / erasure_cancel
+	Operator  string `gorm:"column:operator" json:"operator"` // 操作人（GM账号或调用方）
+	Detail    string `gorm:"column:detail" json:"detail"`     // 操作详情
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// AddAccountAudit 写入一条审计记录
+func AddAccountAudit(audit AccountAudit) error {
+	return DB.Create(&audit).Error
+}
+
+// GetAccountAudits 获取账号的全部审计记录（按时间正序）
+func GetAccountAudits(accountID string) ([]AccountAudit, error) {
+	var list []AccountAudit
+	err := DB.Where("account_id = ?", accountID).Order("id ASC").Find(&list).Error
+	return list, err
+}
+
+// 数据删除申请状态
+const (
+	ErasureStatusPending   = 0 // 冷静期中，等待执行
+	ErasureStatusDone      = 1 // 已执行
+	ErasureStatusCancelled = 2 // 已撤销
+)
+
+// AccountErasure 账号数据删除申请
+// 执行后 account_id 清空，只保留 account_hash，用于证明该账号的数据已被删除
+type AccountErasure struct {
+	ID             uint64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	AccountID      string  `gorm:"column:account_id" json:"account_id"`
+	AccountHash    string  `gorm:"column:account_hash" json:"account_hash"`
+	Status         int     `gorm:"column:status" json:"status"` // 0冷静期 1已执行 2已撤销
+	Reason         string  `gorm:"column:reason" json:"reason"`
+	Operator       string  `gorm:"column:operator" json:"operator"`               // 申请人
+	CancelOperator string  `gorm:"column:cancel_operator" json:"cancel_operator"` // 撤销人
+	ExecuteAfter   int64   `gorm:"column:execute_after" json:"execute_after"`     // 冷静期结束时间，之后才会执行
+	ExecutedAt     int64   `gorm:"column:executed_at" json:"executed_at"`
+	Attempts       int     `gorm:"column:attempts" json:"attempts"`           // 通知游戏服的尝试次数
+	NotifyResult   *string `gorm:"column:notify_result" json:"notify_result"` // 最近一次通知游戏服的结果（JSON）
+	CreatedAt      int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      int64   `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// ErasureLog 数据删除执行记录（只追加，哈希链防篡改）
+// hash = sha256(prev_hash | erasure_id | account_hash | executed_at | summary)，任何一条被修改或删除都会导致后续校验失败
+type ErasureLog struct {
+	ID          uint64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	ErasureID   uint64 `gorm:"column:erasure_id" json:"erasure_id"`
+	AccountHash string `gorm:"column:account_hash" json:"account_hash"`
+	ExecutedAt  int64  `gorm:"column:executed_at" json:"executed_at"`
+	Summary     string `gorm:"column:summary" json:"summary"` // 删除内容摘要（JSON，不含个人数据）
+	PrevHash    string `gorm:"column:prev_hash" json:"prev_hash"`
+	Hash        string `gorm:"column:hash" json:"hash"`
+}
+
+// ErasureLogLock 哈希链追加锁：表中只有一行（id=1），追加记录前 SELECT ... FOR UPDATE 锁定该行，
+// 保证多实例并发执行时哈希链不分叉（erasure_log 为空时锁定链尾锁不到任何行）
+type ErasureLogLock struct {
+	ID uint8 `gorm:"column:id;primaryKey;autoIncrement:false"`
+}
+
+// lockErasureLog 在事务内锁定哈希链追加锁，锁行不存在时先插入
+func lockErasureLog(tx *gorm.DB) error {
+	var lock ErasureLogLock
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", 1).First(&lock).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ErasureLogLock{ID: 1}).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", 1).First(&lock).Error
+}
+
+// AccountHash 计算账号ID的摘要（可配置 privacy.hash_salt 加盐）
+func AccountHash(accountID string) string {
+	sum := sha256.Sum256([]byte(config.Config.GetString("privacy.hash_salt") + accountID))
+	return hex.EncodeToString(sum[:])
+}
+
+// ErasureLogHash 计算删除记录的链式哈希
+func ErasureLogHash(prevHash string, entry ErasureLog) string {
+	data := fmt.Sprintf("%s|%d|%s|%d|%s", prevHash, entry.ErasureID, entry.AccountHash, entry.ExecutedAt, entry.Summary)
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAccountErasure 创建删除申请，同一账号同时只能有一个冷静期中的申请
+func CreateAccountErasure(erasure *AccountErasure) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&AccountErasure{}).
+			Where("account_id = ? AND status = ?", erasure.AccountID, ErasureStatusPending).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("账号 %s 已有待执行的删除申请", erasure.AccountID)
+		}
+		erasure.Status = ErasureStatusPending
+		return tx.Create(erasure).Error
+	})
+}
+
+// CancelAccountErasure 撤销冷静期中的删除申请，返回被撤销的申请
+func CancelAccountErasure(id uint64, operator string) (AccountErasure, error) {
+	var erasure AccountErasure
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&erasure, id).Error; err != nil {
+			return err
+		}
+		if erasure.Status != ErasureStatusPending {
+			return fmt.Errorf("申请 %d 不在冷静期中，无法撤销", id)
+		}
+		erasure.Status = ErasureStatusCancelled
+		erasure.CancelOperator = operator
+		return tx.Model(&erasure).Select("status", "cancel_operator").Updates(&erasure).Error
+	})
+	return erasure, err
+}
+
+// GetAccountErasures 获取账号的删除申请记录
+func GetAccountErasures(accountID string) ([]AccountErasure, error) {
+	var list []AccountErasure
+	err := DB.Where("account_id = ?", accountID).Order("id ASC").Find(&list).Error
+	return list, err
+}
+
+// GetErasureList 分页查询删除申请
+func GetErasureList(page, pageSize int, status *int) ([]AccountErasure, int64, error) {
+	var list []AccountErasure
+	var total int64
+
+	tx := DB.Model(&AccountErasure{})
+	if status != nil {
+		tx = tx.Where("status = ?", *status)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := tx.Order("id DESC").Limit(pageSize).Offset(offset).Find(&list).Error
+	return list, total, err
+}
+
+// GetDueErasures 获取冷静期已结束、等待执行的删除申请（按ID分批，afterID 为上一批最后一条）
+func GetDueErasures(now int64, afterID uint64, limit int) ([]AccountErasure, error) {
+	var list []AccountErasure
+	err := DB.Where("status = ? AND execute_after <= ? AND id > ?", ErasureStatusPending, now, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// SetErasureNotifyFailed 记录一次通知游戏服失败，下次执行时重试
+func SetErasureNotifyFailed(id uint64, notifyResult string) error {
+	return DB.Model(&AccountErasure{}).
+		Where("id = ? AND status = ?", id, ErasureStatusPending).
+		Updates(map[string]any{
+			"attempts":      gorm.Expr("attempts + 1"),
+			"notify_result": notifyResult,
+		}).Error
+}
+
+// ExecuteAccountErasure 执行删除：在一个事务内删除玩家历史和角色索引、匿名化审计记录，
+// 将申请标记为已执行（清空 account_id 和可能包含账号信息的 reason），并追加一条哈希链记录
+// 申请已不在冷静期（被撤销或被其它实例执行）时返回 gorm.ErrRecordNotFound
+func ExecuteAccountErasure(id uint64, summary string, notifyResult string) (ErasureLog, error) {
+	var entry ErasureLog
+	err := withDeadlockRetry(func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			var erasure AccountErasure
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND status = ?", id, ErasureStatusPending).
+				First(&erasure).Error; err != nil {
+				return err
+			}
+			accountID := erasure.AccountID
+
+			if err := tx.Where("account_id = ?", accountID).Delete(&PlayerIndex{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("account_id = ?", accountID).Delete(&UserPlayerHistory{}).Error; err != nil {
+				return err
+			}
+			// 审计记录保留操作类型和时间，去掉账号和详情
+			if err := tx.Model(&AccountAudit{}).
+				Where("account_id = ?", accountID).
+				Updates(map[string]any{"account_id": "erased:" + erasure.AccountHash, "detail": ""}).Error; err != nil {
+				return err
+			}
+
+			now := time.Now().Unix()
+			if err := tx.Model(&erasure).Updates(map[string]any{
+				"account_id":    "",
+				"reason":        "",
+				"status":        ErasureStatusDone,
+				"executed_at":   now,
+				"notify_result": notifyResult,
+			}).Error; err != nil {
+				return err
+			}
+
+			// 锁定哈希链追加锁后读取链尾，保证多实例并发执行时哈希链不分叉
+			if err := lockErasureLog(tx); err != nil {
+				return err
+			}
+			var last ErasureLog
+			err := tx.Order("id DESC").First(&last).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			entry = ErasureLog{
+				ErasureID:   erasure.ID,
+				AccountHash: erasure.AccountHash,
+				ExecutedAt:  now,
+				Summary:     summary,
+				PrevHash:    last.Hash,
+			}
+			entry.Hash = ErasureLogHash(entry.PrevHash, entry)
+			return tx.Create(&entry).Error
+		})
+	})
+	return entry, err
+}
+
+// VerifyErasureLog 校验删除记录哈希链
+// 返回校验的条数；链断裂时返回第一条不一致记录的ID
+func VerifyErasureLog() (count int, brokenID uint64, err error) {
+	const batchSize = 1000
+	var lastID uint64
+	prevHash := ""
+
+	for {
+		var batch []ErasureLog
+		if err := DB.Where("id > ?", lastID).Order("id ASC").Limit(batchSize).Find(&batch).Error; err != nil {
+			return count, 0, err
+		}
+		if len(batch) == 0 {
+			return count, 0, nil
+		}
+
+		for _, entry := range batch {
+			if entry.PrevHash != prevHash || ErasureLogHash(prevHash, entry) != entry.Hash {
+				return count, entry.ID, nil
+			}
+			prevHash = entry.Hash
+			lastID = entry.ID
+			count++
+		}
+	}
+}
+
+// GetPlayerIndexByAccount 获取账号下的全部角色索引
+func GetPlayerIndexByAccount(accountID string) ([]PlayerIndex, error) {
+	var list []PlayerIndex
+	err := DB.Where("account_id = ?", accountID).Order("cluster_id ASC, game_id ASC, player_id ASC").Find(&list).Error
+	return list, err
+}
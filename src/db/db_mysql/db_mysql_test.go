@@ -0,0 +1,163 @@
+package db_mysql
+
+import (
+	"loginServer/config"
+	"reflect"
+	"testing"
+)
+
+func intPtr(v int) *int { return &v }
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func strPtr(v string) *string { return &v }
+
+// historyServers 按列表顺序返回 game_id，便于比较顺序
+func historyServers(list []PlayerHistoryItem) []int {
+	servers := make([]int, 0, len(list))
+	for _, item := range list {
+		servers = append(servers, item.GameID)
+	}
+	return servers
+}
+
+func TestMergeAndSortList(t *testing.T) {
+	// 三个服，列表头部为最近玩过的服
+	base := func() []PlayerHistoryItem {
+		return []PlayerHistoryItem{
+			{ClusterID: 1, GameID: 3, PlayerID: 300, RoleName: "c", Level: 30, LastLoginTime: 300},
+			{ClusterID: 1, GameID: 2, PlayerID: 200, RoleName: "b", Level: 20, LastLoginTime: 200},
+			{ClusterID: 1, GameID: 1, PlayerID: 100, RoleName: "a", Level: 10, LastLoginTime: 100},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		list        []PlayerHistoryItem
+		update      PlayerHistoryUpdate
+		maxItems    int
+		prunePolicy string
+		wantServers []int
+		check       func(t *testing.T, list []PlayerHistoryItem)
+	}{
+		{
+			name:        "新服插入到头部",
+			list:        base(),
+			update:      PlayerHistoryUpdate{ClusterID: 1, GameID: 4, PlayerID: 400, RoleName: strPtr("d"), MoveTop: true},
+			wantServers: []int{4, 3, 2, 1},
+			check: func(t *testing.T, list []PlayerHistoryItem) {
+				if list[0].PlayerID != 400 || list[0].RoleName != "d" {
+					t.Errorf("新条目字段错误: %+v", list[0])
+				}
+			},
+		},
+		{
+			name:        "空列表插入",
+			list:        nil,
+			update:      PlayerHistoryUpdate{ClusterID: 2, GameID: 1, Level: intPtr(5)},
+			wantServers: []int{1},
+			check: func(t *testing.T, list []PlayerHistoryItem) {
+				if list[0].ClusterID != 2 || list[0].Level != 5 {
+					t.Errorf("新条目字段错误: %+v", list[0])
+				}
+			},
+		},
+		{
+			name:        "已存在且不置顶：原地更新，不改变顺序",
+			list:        base(),
+			update:      PlayerHistoryUpdate{ClusterID: 1, GameID: 1, Level: intPtr(11)},
+			wantServers: []int{3, 2, 1},
+			check: func(t *testing.T, list []PlayerHistoryItem) {
+				if list[2].Level != 11 || list[2].RoleName != "a" || list[2].PlayerID != 100 {
+					t.Errorf("原地更新错误: %+v", list[2])
+				}
+			},
+		},
+		{
+			name:        "已存在且置顶：移到头部并保留未更新的字段",
+			list:        base(),
+			update:      PlayerHistoryUpdate{ClusterID: 1, GameID: 1, LastLoginTime: int64Ptr(400), MoveTop: true},
+			wantServers: []int{1, 3, 2},
+			check: func(t *testing.T, list []PlayerHistoryItem) {
+				want := PlayerHistoryItem{ClusterID: 1, GameID: 1, PlayerID: 100, RoleName: "a", Level: 10, LastLoginTime: 400}
+				if list[0] != want {
+					t.Errorf("置顶条目 = %+v, want %+v", list[0], want)
+				}
+			},
+		},
+		{
+			name:        "不同 cluster 的同 game_id 视为不同服",
+			list:        base(),
+			update:      PlayerHistoryUpdate{ClusterID: 2, GameID: 1, MoveTop: true},
+			wantServers: []int{1, 3, 2, 1},
+		},
+		{
+			name:        "超过上限按 recent 裁掉末尾",
+			list:        base(),
+			update:      PlayerHistoryUpdate{ClusterID: 1, GameID: 4, MoveTop: true},
+			maxItems:    2,
+			wantServers: []int{4, 3},
+		},
+		{
+			name:        "超过上限按 level 裁掉等级最低的，本次更新的服始终保留",
+			list:        base(),
+			update:      PlayerHistoryUpdate{ClusterID: 1, GameID: 4, Level: intPtr(1), MoveTop: true},
+			maxItems:    2,
+			prunePolicy: PrunePolicyLevel,
+			wantServers: []int{4, 3},
+		},
+		{
+			name:        "未超过上限不裁剪",
+			list:        base(),
+			update:      PlayerHistoryUpdate{ClusterID: 1, GameID: 2, MoveTop: true},
+			maxItems:    3,
+			wantServers: []int{2, 3, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.Set("player_history.max_items", tt.maxItems)
+			config.Config.Set("player_history.prune_policy", tt.prunePolicy)
+			t.Cleanup(func() {
+				config.Config.Set("player_history.max_items", 0)
+				config.Config.Set("player_history.prune_policy", "")
+			})
+
+			got := mergeAndSortList(tt.list, tt.update)
+			if servers := historyServers(got); !reflect.DeepEqual(servers, tt.wantServers) {
+				t.Fatalf("顺序 = %v, want %v", servers, tt.wantServers)
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestApplyHistoryUpdates(t *testing.T) {
+	config.Config.Set("player_history.max_items", 0)
+
+	// 逐条应用与一次性应用的结果一致
+	updates := []PlayerHistoryUpdate{
+		{ClusterID: 1, GameID: 1, Level: intPtr(1), MoveTop: true},
+		{ClusterID: 1, GameID: 2, Level: intPtr(1), MoveTop: true},
+		{ClusterID: 1, GameID: 1, Level: intPtr(2)},
+		{ClusterID: 1, GameID: 3, MoveTop: true},
+		{ClusterID: 1, GameID: 2, MoveTop: true},
+	}
+	var stepwise []PlayerHistoryItem
+	for _, update := range updates {
+		stepwise = mergeAndSortList(stepwise, update)
+	}
+	got := ApplyHistoryUpdates(nil, updates)
+	if !reflect.DeepEqual(got, stepwise) {
+		t.Fatalf("ApplyHistoryUpdates = %+v, want %+v", got, stepwise)
+	}
+	if servers := historyServers(got); !reflect.DeepEqual(servers, []int{2, 3, 1}) {
+		t.Fatalf("顺序 = %v, want [2 3 1]", servers)
+	}
+	if got[2].Level != 2 {
+		t.Fatalf("game 1 等级 = %d, want 2", got[2].Level)
+	}
+}
@@ -1,26 +1,409 @@
 package db_redis
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"loginServer/config"
 	inredis "loginServer/pkg/redis"
+	"loginServer/src/log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	defaultOpTimeout      = 100 * time.Millisecond // 单次操作超时，Redis 变慢时快速回退到 MySQL
+	defaultBreakerCooling = 10 * time.Second       // 出错后暂停使用 Redis 的时长
+	maxPendingDel         = 100000                 // 待重试删除的 key 数量上限
+	pendingDelInterval    = time.Second            // 后台重试删除的间隔
+	pendingDelBatch       = 500                    // 每次重试删除的 key 数量上限
+	subscribePingInterval = 30 * time.Second       // 订阅连接空闲时的检测间隔
+)
+
+var errRedisUnavailable = errors.New("redis unavailable")
+
 var ctx = context.Background()
 var DB *redis.Client
 
+var (
+	opTimeout      = defaultOpTimeout
+	breakerCooling = defaultBreakerCooling
+
+	stateMu      sync.Mutex
+	downUntil    time.Time           // 熔断截止时间，期间所有操作直接返回失败
+	pendingDel   = map[string]bool{} // 删除失败、待 Redis 恢复后重试的 key（这些 key 在删除成功前不读缓存）
+	suspendUntil time.Time           // 待删除 key 溢出时暂停读缓存的截止时间
+	maxTTL       time.Duration       // 写入过的最长缓存有效期
+)
+
 func Start() {
 	redisip := config.Config.GetString("redis.ip")
 	if redisip != "" {
-		redisip := config.Config.GetString("redis.ip")
+		if ms := config.Config.GetInt("redis.op_timeout_ms"); ms > 0 {
+			opTimeout = time.Duration(ms) * time.Millisecond
+		}
 		redislink := inredis.Link{
-			Password: config.Config.GetString("redis.password"),
-			Db:       config.Config.GetInt("redis.db"),
-			Ip:       redisip,
-			Port:     config.Config.GetString("redis.port"),
+			Password:     config.Config.GetString("redis.password"),
+			Db:           config.Config.GetInt("redis.db"),
+			Ip:           redisip,
+			Port:         config.Config.GetString("redis.port"),
+			DialTimeout:  opTimeout * 5,
+			ReadTimeout:  opTimeout,
+			WriteTimeout: opTimeout,
 		}
 		DB = inredis.Start(redislink)
+
+		// 启动时连不上不阻止启动，业务会自动回退到 MySQL
+		if err := withTimeout(func(c context.Context) error { return DB.Ping(c).Err() }); err != nil {
+			markFailure(err)
+		}
+		go retryPendingDelLoop()
+	}
+}
+
+// Available Redis 是否可用（已配置且未处于熔断期）
+func Available() bool {
+	if DB == nil {
+		return false
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return time.Now().After(downUntil)
+}
+
+// Get 读取缓存
+// 返回值：found 表示命中；Redis 不可用、出错、key 待删除时均视为未命中
+func Get(key string) (data []byte, found bool) {
+	if !Available() || !readable(key) {
+		return nil, false
+	}
+
+	err := withTimeout(func(c context.Context) error {
+		var err error
+		data, err = DB.Get(c, key).Bytes()
+		return err
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, false
+	} else if err != nil {
+		markFailure(err)
+		return nil, false
+	}
+	return data, true
+}
+
+// setIfNewerScript 缓存中没有该 key、或已有的版本号小于本次写入的版本号时才写入
+// 缓存值格式为 "版本号|数据"
+var setIfNewerScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	local v = tonumber(string.match(cur, '^(%d+)|'))
+	if v and v >= tonumber(ARGV[1]) then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1] .. '|' .. ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// GetVersioned 读取 SetIfNewer 写入的缓存，返回版本号和数据；格式不正确时视为未命中
+func GetVersioned(key string) (version int64, data []byte, found bool) {
+	raw, found := Get(key)
+	if !found {
+		return 0, nil, false
+	}
+	sep := bytes.IndexByte(raw, '|')
+	if sep <= 0 {
+		return 0, nil, false
+	}
+	version, err := strconv.ParseInt(string(raw[:sep]), 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+	return version, raw[sep+1:], true
+}
+
+// SetIfNewer 写入带版本号的缓存：缓存中已有相同或更新的版本时不覆盖，
+// 多个实例并发写入/回填时旧数据不会覆盖新数据
+// 写入失败时按 Del 处理（记录到待删除集合），避免其它实例继续读到旧数据
+func SetIfNewer(key string, version int64, data []byte, ttl time.Duration) {
+	if DB == nil || !readable(key) {
+		return
+	}
+	if Available() {
+		stateMu.Lock()
+		maxTTL = max(maxTTL, ttl)
+		stateMu.Unlock()
+		err := withTimeout(func(c context.Context) error {
+			return setIfNewerScript.Run(c, DB, []string{key}, version, data, ttl.Milliseconds()).Err()
+		})
+		if err == nil {
+			return
+		}
+		markFailure(err)
+	}
+	Del(key)
+}
+
+// Del 删除缓存（数据库写入后调用，使缓存失效）
+// 删除失败时记录到待删除集合，Redis 恢复后重试；在删除成功前这些 key 不会从缓存读取，避免读到旧数据
+func Del(keys ...string) {
+	if DB == nil || len(keys) == 0 {
+		return
+	}
+	if Available() {
+		err := withTimeout(func(c context.Context) error { return DB.Del(c, keys...).Err() })
+		if err == nil {
+			return
+		}
+		markFailure(err)
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for _, key := range keys {
+		pendingDel[key] = true
+	}
+	if len(pendingDel) > maxPendingDel {
+		// 待删除 key 过多：放弃逐个删除，在一个缓存有效期内不再读缓存，让旧数据自然过期
+		pendingDel = map[string]bool{}
+		suspendUntil = time.Now().Add(maxTTL + time.Minute)
+		log.Warn("db_redis: 待删除 key 超过 %d，暂停读取缓存至 %v", maxPendingDel, suspendUntil)
+	}
+}
+
+// Incr 自增计数器
+func Incr(key string) (int64, error) {
+	if !Available() {
+		return 0, errRedisUnavailable
+	}
+	var n int64
+	err := withTimeout(func(c context.Context) error {
+		var err error
+		n, err = DB.Incr(c, key).Result()
+		return err
+	})
+	if err != nil {
+		markFailure(err)
+	}
+	return n, err
+}
+
+// IncrExpire 计数器增加 n 并设置有效期（用于按时间窗口计数，key 中应包含窗口编号）
+func IncrExpire(key string, n int64, ttl time.Duration) (int64, error) {
+	if !Available() {
+		return 0, errRedisUnavailable
+	}
+	var incr *redis.IntCmd
+	err := withTimeout(func(c context.Context) error {
+		_, err := DB.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			incr = pipe.IncrBy(c, key, n)
+			pipe.Expire(c, key, ttl)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		markFailure(err)
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// HSet 设置哈希表字段
+func HSet(key, field string, value []byte) error {
+	if !Available() {
+		return errRedisUnavailable
 	}
+	err := withTimeout(func(c context.Context) error { return DB.HSet(c, key, field, value).Err() })
+	if err != nil {
+		markFailure(err)
+	}
+	return err
+}
+
+// HDel 删除哈希表字段
+func HDel(key string, fields ...string) error {
+	if !Available() {
+		return errRedisUnavailable
+	}
+	err := withTimeout(func(c context.Context) error { return DB.HDel(c, key, fields...).Err() })
+	if err != nil {
+		markFailure(err)
+	}
+	return err
+}
+
+// HGetAll 读取哈希表的全部字段
+func HGetAll(key string) (map[string]string, error) {
+	if !Available() {
+		return nil, errRedisUnavailable
+	}
+	var result map[string]string
+	err := withTimeout(func(c context.Context) error {
+		var err error
+		result, err = DB.HGetAll(c, key).Result()
+		return err
+	})
+	if err != nil {
+		markFailure(err)
+	}
+	return result, err
+}
+
+// Publish 发布消息到频道
+func Publish(channel string, payload []byte) error {
+	if !Available() {
+		return errRedisUnavailable
+	}
+	err := withTimeout(func(c context.Context) error { return DB.Publish(c, channel, payload).Err() })
+	if err != nil {
+		markFailure(err)
+	}
+	return err
+}
+
+// publishSequencedScript 递增序号（不小于 ARGV[3]）并发布 "序号|消息"
+// 两步在同一个脚本内原子执行，频道上消息的顺序与序号顺序一致
+var publishSequencedScript = redis.NewScript(`
+local id = redis.call('INCR', KEYS[1])
+if id < tonumber(ARGV[3]) then
+	redis.call('SET', KEYS[1], ARGV[3])
+	id = tonumber(ARGV[3])
+end
+redis.call('PUBLISH', ARGV[1], id .. '|' .. ARGV[2])
+return id
+`)
+
+// PublishSequenced 分配全局递增序号并发布消息，订阅方收到 "序号|消息"
+// floor 为序号的下限（如当前毫秒时间戳，使序号与按时间生成的本地版本号可比较），0 表示不限制
+func PublishSequenced(seqKey, channel string, payload []byte, floor int64) (int64, error) {
+	if !Available() {
+		return 0, errRedisUnavailable
+	}
+	var id int64
+	err := withTimeout(func(c context.Context) error {
+		var err error
+		id, err = publishSequencedScript.Run(c, DB, []string{seqKey}, channel, payload, floor).Int64()
+		return err
+	})
+	if err != nil {
+		markFailure(err)
+	}
+	return id, err
+}
+
+// Subscribe 订阅频道，阻塞直到 stop 关闭
+// 连接断开后自动重连并重新订阅；每次（重新）订阅成功时调用 onSubscribe，调用方可据此补齐断线期间错过的消息
+func Subscribe(stop <-chan struct{}, channel string, onSubscribe func(), onMessage func(payload string)) {
+	if DB == nil {
+		return
+	}
+	pubsub := DB.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	go func() {
+		<-stop
+		pubsub.Close()
+	}()
+
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, subscribePingInterval)
+		if err != nil {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// 长时间没有消息：发送 PING 检测连接，连接已断开时下次 Receive 会重连
+				_ = pubsub.Ping(ctx)
+				continue
+			}
+			log.Warn("db_redis: 订阅 %s 失败，稍后重连, err: %v", channel, err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" && onSubscribe != nil {
+				onSubscribe()
+			}
+		case *redis.Message:
+			onMessage(m.Payload)
+		}
+	}
+}
+
+// readable 判断 key 当前是否可以读写缓存
+func readable(key string) bool {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return !pendingDel[key] && time.Now().After(suspendUntil)
+}
+
+// retryPendingDelLoop 后台定时重试之前删除失败的 key，每次最多 pendingDelBatch 个
+func retryPendingDelLoop() {
+	ticker := time.NewTicker(pendingDelInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if Available() {
+			retryPendingDel()
+		}
+	}
+}
+
+// retryPendingDel 重试删除一批之前删除失败的 key（最多 pendingDelBatch 个）
+func retryPendingDel() {
+	stateMu.Lock()
+	if len(pendingDel) == 0 {
+		stateMu.Unlock()
+		return
+	}
+	keys := make([]string, 0, min(len(pendingDel), pendingDelBatch))
+	for key := range pendingDel {
+		if len(keys) == pendingDelBatch {
+			break
+		}
+		keys = append(keys, key)
+	}
+	stateMu.Unlock()
+
+	if err := withTimeout(func(c context.Context) error { return DB.Del(c, keys...).Err() }); err != nil {
+		markFailure(err)
+		return
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for _, key := range keys {
+		delete(pendingDel, key)
+	}
+}
+
+// markFailure 记录 Redis 故障并进入熔断期，期间业务直接走 MySQL
+func markFailure(err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if time.Now().After(downUntil) {
+		log.Warn("db_redis: Redis 操作失败，%v 内回退到 MySQL, err: %v", breakerCooling, err)
+	}
+	downUntil = time.Now().Add(breakerCooling)
+}
+
+// withTimeout 带超时执行单次 Redis 操作
+func withTimeout(fn func(c context.Context) error) error {
+	c, cancel := context.WithTimeout(ctx, opTimeout)
+	defer cancel()
+	return fn(c)
 }